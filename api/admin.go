@@ -0,0 +1,205 @@
+package api
+
+import (
+	"blockchain/p2p"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type NodeInfo struct {
+	PeerID string `json:"peerId"`
+	// Address is the configured listen address, ListenAddresses the ones it
+	// resolved to
+	Address         string   `json:"address"`
+	ListenAddresses []string `json:"listenAddresses"`
+	Peers           int      `json:"peers"`
+	Height          int      `json:"height"`
+	BlocksPaused    bool     `json:"blocksPaused"`
+}
+
+type ConnectPeerRequest struct {
+	// Address is "host:port" or "peerID@host:port" to require the peer ID
+	Address string `json:"address"`
+}
+
+type BanPeerRequest struct {
+	// Duration is a Go duration like "30m", one hour if empty
+	Duration string `json:"duration"`
+}
+
+type BanInfo struct {
+	PeerID string    `json:"peerId"`
+	Until  time.Time `json:"until"`
+}
+
+type SyncResponse struct {
+	Peers int `json:"peers"`
+}
+
+type BlocksStatusResponse struct {
+	Paused bool `json:"paused"`
+}
+
+const defaultBanDuration = time.Hour
+
+// @Success 200 {object} api.NodeInfo
+// @Failure 401 {object} api.ErrorResponse
+// @Failure 403 {object} api.ErrorResponse
+// @Router /admin/node [get]
+func (h *Handler) GetNodeInfo(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, NodeInfo{
+		PeerID:          h.Node.Identity.ID,
+		Address:         h.Node.Address,
+		ListenAddresses: h.Node.ListenAddresses(),
+		Peers:           len(h.Node.PeerInfo()),
+		Height:          h.Blockchain.Len() - 1,
+		BlocksPaused:    h.Blockchain.BlocksPaused(),
+	})
+}
+
+// @Success 200 {array} p2p.PeerInfo
+// @Failure 401 {object} api.ErrorResponse
+// @Failure 403 {object} api.ErrorResponse
+// @Router /admin/peers [get]
+func (h *Handler) GetPeers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.Node.PeerInfo())
+}
+
+// @Param request body api.ConnectPeerRequest true "Peer to connect to"
+// @Success 204
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 401 {object} api.ErrorResponse
+// @Failure 403 {object} api.ErrorResponse
+// @Failure 502 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Router /admin/peers [post]
+func (h *Handler) ConnectPeer(w http.ResponseWriter, r *http.Request) {
+	var request ConnectPeerRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeBadRequest(w, fmt.Sprintf("Invalid JSON: %v", err))
+		return
+	}
+	if request.Address == "" {
+		writeBadRequest(w, "address is required")
+		return
+	}
+	err = h.Node.ConnectToPeer(request.Address, h.Blockchain)
+	if errors.Is(err, p2p.ErrTooManyPeers) {
+		writeError(w, http.StatusServiceUnavailable, ErrorCodeUnavailable, "Too many peers", err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, ErrorCodePeerUnreachable, "Could not connect to peer", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Param id path string true "Peer ID"
+// @Success 204
+// @Failure 401 {object} api.ErrorResponse
+// @Failure 403 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Router /admin/peers/{id} [delete]
+func (h *Handler) DisconnectPeer(w http.ResponseWriter, r *http.Request) {
+	peerID := r.PathValue("id")
+	if !h.Node.RemoveConnection(peerID) {
+		writeNotFound(w, fmt.Sprintf("Not connected to peer %s", peerID))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Param id path string true "Peer ID"
+// @Param request body api.BanPeerRequest false "Ban duration"
+// @Success 204
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 401 {object} api.ErrorResponse
+// @Failure 403 {object} api.ErrorResponse
+// @Router /admin/peers/{id}/ban [post]
+func (h *Handler) BanPeer(w http.ResponseWriter, r *http.Request) {
+	var request BanPeerRequest
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			writeBadRequest(w, fmt.Sprintf("Invalid JSON: %v", err))
+			return
+		}
+	}
+	duration := defaultBanDuration
+	if request.Duration != "" {
+		var err error
+		duration, err = time.ParseDuration(request.Duration)
+		if err != nil || duration <= 0 {
+			writeBadRequest(w, fmt.Sprintf("Invalid duration: %s", request.Duration))
+			return
+		}
+	}
+	h.Node.Ban(r.PathValue("id"), duration)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Success 200 {array} api.BanInfo
+// @Failure 401 {object} api.ErrorResponse
+// @Failure 403 {object} api.ErrorResponse
+// @Router /admin/bans [get]
+func (h *Handler) GetBans(w http.ResponseWriter, r *http.Request) {
+	bans := []BanInfo{}
+	for peerID, until := range h.Node.Bans() {
+		bans = append(bans, BanInfo{PeerID: peerID, Until: until})
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].PeerID < bans[j].PeerID })
+	writeJSON(w, bans)
+}
+
+// @Param id path string true "Peer ID"
+// @Success 204
+// @Failure 401 {object} api.ErrorResponse
+// @Failure 403 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Router /admin/bans/{id} [delete]
+func (h *Handler) UnbanPeer(w http.ResponseWriter, r *http.Request) {
+	peerID := r.PathValue("id")
+	if !h.Node.Unban(peerID) {
+		writeNotFound(w, fmt.Sprintf("Peer %s is not banned", peerID))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Success 200 {object} api.SyncResponse
+// @Failure 401 {object} api.ErrorResponse
+// @Failure 403 {object} api.ErrorResponse
+// @Router /admin/sync [post]
+func (h *Handler) Resync(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, SyncResponse{Peers: h.Node.Resync(h.Blockchain)})
+}
+
+// @Success 200 {object} api.BlocksStatusResponse
+// @Failure 401 {object} api.ErrorResponse
+// @Failure 403 {object} api.ErrorResponse
+// @Router /admin/blocks/pause [post]
+func (h *Handler) PauseBlocks(w http.ResponseWriter, r *http.Request) {
+	h.Blockchain.PauseBlocks()
+	logger.Info("Block acceptance paused")
+	writeJSON(w, BlocksStatusResponse{Paused: true})
+}
+
+// ResumeBlocks also resynchronizes with the peers, to catch up with the blocks
+// refused while paused.
+//
+// @Success 200 {object} api.BlocksStatusResponse
+// @Failure 401 {object} api.ErrorResponse
+// @Failure 403 {object} api.ErrorResponse
+// @Router /admin/blocks/resume [post]
+func (h *Handler) ResumeBlocks(w http.ResponseWriter, r *http.Request) {
+	h.Blockchain.ResumeBlocks()
+	logger.Info("Block acceptance resumed")
+	h.Node.Resync(h.Blockchain)
+	writeJSON(w, BlocksStatusResponse{Paused: false})
+}
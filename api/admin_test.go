@@ -0,0 +1,203 @@
+package api_test
+
+import (
+	"blockchain/api"
+	"blockchain/chain"
+	"blockchain/p2p"
+	"blockchain/storage"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startPeer serves a node with blockchain at address on network.
+func startPeer(t *testing.T, network *p2p.MemoryNetwork, address string, blockchain *chain.Blockchain) *p2p.Node {
+	t.Helper()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := p2p.NewIdentity(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := p2p.NewNode(address, nil, identity)
+	node.Transport = network.Transport(address)
+	listener, err := node.Transport.Listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go node.Serve(listener, blockchain)
+	t.Cleanup(func() {
+		listener.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		node.Shutdown(ctx)
+	})
+	return node
+}
+
+// newAdmin returns a handler whose node is served on network, with the admin
+// routes of the node.
+func newAdmin(t *testing.T, network *p2p.MemoryNetwork) (*api.Handler, http.Handler) {
+	t.Helper()
+	h := newHandler(t, storage.NewMemoryStorage())
+	h.Node = startPeer(t, network, "admin", h.Blockchain)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/node", h.GetNodeInfo)
+	mux.HandleFunc("GET /admin/peers", h.GetPeers)
+	mux.HandleFunc("POST /admin/peers", h.ConnectPeer)
+	mux.HandleFunc("DELETE /admin/peers/{id}", h.DisconnectPeer)
+	mux.HandleFunc("POST /admin/peers/{id}/ban", h.BanPeer)
+	mux.HandleFunc("GET /admin/bans", h.GetBans)
+	mux.HandleFunc("DELETE /admin/bans/{id}", h.UnbanPeer)
+	mux.HandleFunc("POST /admin/sync", h.Resync)
+	mux.HandleFunc("POST /admin/blocks/pause", h.PauseBlocks)
+	mux.HandleFunc("POST /admin/blocks/resume", h.ResumeBlocks)
+	return h, mux
+}
+
+// send sends body to target with method and returns the status.
+func send(handler http.Handler, method, target, body string) int {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return recorder.Code
+}
+
+func TestAdminPeers(t *testing.T) {
+	network := p2p.NewMemoryNetwork()
+	h, admin := newAdmin(t, network)
+	remoteChain, err := chain.InitBlockchain(chain.RegtestParams, storage.NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := startPeer(t, network, "remote", remoteChain)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"invalid JSON", `{"address": `, http.StatusBadRequest},
+		{"missing address", `{}`, http.StatusBadRequest},
+		{"unreachable", `{"address": "nowhere"}`, http.StatusBadGateway},
+		{"connect", `{"address": "` + remote.Identity.ID + `@remote"}`, http.StatusNoContent},
+	}
+	for _, test := range tests {
+		status := send(admin, http.MethodPost, "/admin/peers", test.body)
+		if status != test.status {
+			t.Fatalf("%s: status is %d, want %d", test.name, status, test.status)
+		}
+	}
+
+	var peers []p2p.PeerInfo
+	request(t, admin, http.MethodGet, "/admin/peers", &peers)
+	if len(peers) != 1 || peers[0].ID != remote.Identity.ID {
+		t.Fatalf("peers are %+v, want %s", peers, remote.Identity.ID)
+	}
+	var info api.NodeInfo
+	request(t, admin, http.MethodGet, "/admin/node", &info)
+	if info.PeerID != h.Node.Identity.ID || info.Peers != 1 || info.Height != 0 {
+		t.Fatalf("node info is %+v", info)
+	}
+	var resync api.SyncResponse
+	if status := request(t, admin, http.MethodPost, "/admin/sync", &resync); status != http.StatusOK || resync.Peers != 1 {
+		t.Fatalf("resync: status %d, %+v", status, resync)
+	}
+
+	if status := send(admin, http.MethodDelete, "/admin/peers/"+remote.Identity.ID, ""); status != http.StatusNoContent {
+		t.Fatalf("disconnect: status is %d, want %d", status, http.StatusNoContent)
+	}
+	if status := send(admin, http.MethodDelete, "/admin/peers/"+remote.Identity.ID, ""); status != http.StatusNotFound {
+		t.Fatalf("disconnect again: status is %d, want %d", status, http.StatusNotFound)
+	}
+	request(t, admin, http.MethodGet, "/admin/peers", &peers)
+	if len(peers) != 0 {
+		t.Fatalf("peers are %+v after the disconnect", peers)
+	}
+}
+
+func TestAdminBans(t *testing.T) {
+	_, admin := newAdmin(t, p2p.NewMemoryNetwork())
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"invalid JSON", `{"duration": `, http.StatusBadRequest},
+		{"invalid duration", `{"duration": "soon"}`, http.StatusBadRequest},
+		{"negative duration", `{"duration": "-1m"}`, http.StatusBadRequest},
+		{"no body", ``, http.StatusNoContent},
+	}
+	for _, test := range tests {
+		status := send(admin, http.MethodPost, "/admin/peers/first/ban", test.body)
+		if status != test.status {
+			t.Fatalf("%s: status is %d, want %d", test.name, status, test.status)
+		}
+	}
+	before := time.Now()
+	if status := send(admin, http.MethodPost, "/admin/peers/second/ban", `{"duration": "30m"}`); status != http.StatusNoContent {
+		t.Fatalf("ban: status is %d, want %d", status, http.StatusNoContent)
+	}
+
+	var bans []api.BanInfo
+	request(t, admin, http.MethodGet, "/admin/bans", &bans)
+	if len(bans) != 2 || bans[0].PeerID != "first" || bans[1].PeerID != "second" {
+		t.Fatalf("bans are %+v, want first and second", bans)
+	}
+	if until := bans[0].Until.Sub(before); until < 59*time.Minute || until > time.Hour+time.Minute {
+		t.Fatalf("default ban ends in %s, want an hour", until)
+	}
+	if until := bans[1].Until.Sub(before); until < 29*time.Minute || until > 31*time.Minute {
+		t.Fatalf("ban ends in %s, want 30m", until)
+	}
+
+	if status := send(admin, http.MethodDelete, "/admin/bans/first", ""); status != http.StatusNoContent {
+		t.Fatalf("unban: status is %d, want %d", status, http.StatusNoContent)
+	}
+	if status := send(admin, http.MethodDelete, "/admin/bans/first", ""); status != http.StatusNotFound {
+		t.Fatalf("unban again: status is %d, want %d", status, http.StatusNotFound)
+	}
+	request(t, admin, http.MethodGet, "/admin/bans", &bans)
+	if len(bans) != 1 || bans[0].PeerID != "second" {
+		t.Fatalf("bans are %+v, want second", bans)
+	}
+}
+
+func TestAdminPauseBlocks(t *testing.T) {
+	h, admin := newAdmin(t, p2p.NewMemoryNetwork())
+	miner := chain.Wallet{}
+	miner.KeyGen()
+
+	var status api.BlocksStatusResponse
+	request(t, admin, http.MethodPost, "/admin/blocks/pause", &status)
+	if !status.Paused || !h.Blockchain.BlocksPaused() {
+		t.Fatalf("blocks are not paused: %+v", status)
+	}
+	var info api.NodeInfo
+	request(t, admin, http.MethodGet, "/admin/node", &info)
+	if !info.BlocksPaused {
+		t.Fatalf("node info is %+v, want blocks paused", info)
+	}
+	err := h.Blockchain.MinePendingTransactions(miner.PublicKey)
+	if !errors.Is(err, chain.ErrBlocksPaused) || h.Blockchain.Len() != 1 {
+		t.Fatalf("mining while paused: %v, want %v", err, chain.ErrBlocksPaused)
+	}
+
+	request(t, admin, http.MethodPost, "/admin/blocks/resume", &status)
+	if status.Paused || h.Blockchain.BlocksPaused() {
+		t.Fatalf("blocks are still paused: %+v", status)
+	}
+	err = h.Blockchain.MinePendingTransactions(miner.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,119 @@
+package api_test
+
+import (
+	"blockchain/api"
+	"blockchain/chain"
+	"blockchain/p2p"
+	"blockchain/storage"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newHandler returns a handler for a new regtest chain on s.
+func newHandler(t *testing.T, s chain.Storage) *api.Handler {
+	t.Helper()
+	blockchain, err := chain.InitBlockchain(chain.RegtestParams, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &api.Handler{Blockchain: blockchain}
+}
+
+// serve calls handle with a request for method and target and returns the
+// response.
+func serve(handle http.HandlerFunc, method, target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handle(recorder, httptest.NewRequest(method, target, nil))
+	return recorder
+}
+
+// request sends a request for method and target to handler and decodes the JSON
+// response into body, unless body is nil. It returns the status code.
+func request(t *testing.T, handler http.Handler, method, target string, body any) int {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+	if body != nil {
+		err := json.Unmarshal(recorder.Body.Bytes(), body)
+		if err != nil {
+			t.Fatalf("%s %s: body %q: %v", method, target, recorder.Body.String(), err)
+		}
+	}
+	return recorder.Code
+}
+
+// TestGetBlocksPool runs on Badger, whose storage must not end up in the JSON
+// of the chain.
+func TestGetBlocksPool(t *testing.T) {
+	s, err := storage.NewBadgerStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	h := newHandler(t, s)
+
+	response := serve(h.GetBlocksPool, http.MethodGet, "/blocks/pool/")
+	if response.Code != http.StatusOK {
+		t.Fatalf("status is %d, want %d", response.Code, http.StatusOK)
+	}
+	var body struct {
+		PendingTransactions []chain.Transaction
+		Difficulty          int     `json:"difficulty"`
+		MaxBlockSize        int     `json:"maxBlockSize"`
+		MiningReward        float64 `json:"miningReward"`
+	}
+	err = json.Unmarshal(response.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatalf("body %q: %v", response.Body.String(), err)
+	}
+	params := chain.RegtestParams
+	if body.Difficulty != params.Difficulty || body.MaxBlockSize != params.MaxBlockSize || body.MiningReward != params.MiningReward {
+		t.Fatalf("chain is %+v, want the parameters of %s", body, params.Name)
+	}
+}
+
+// TestRPCPeerInfoRequiresAdmin checks that the peers are only listed to the
+// clients that may list them with GET /admin/peers.
+func TestRPCPeerInfoRequiresAdmin(t *testing.T) {
+	h := newHandler(t, storage.NewMemoryStorage())
+	h.Node = p2p.NewNode("localhost:0", nil, nil)
+	auth, err := api.NewAuth([]api.APIKey{{Name: "operator", Key: "admin-key", Role: "admin"}}, api.RolePublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := auth.Authenticate(http.HandlerFunc(h.RPC))
+
+	tests := []struct {
+		method string
+		key    string
+		// code is the expected error code, 0 for a result
+		code int
+	}{
+		{"getpeerinfo", "", api.RPCForbidden},
+		{"getpeerinfo", "admin-key", 0},
+		{"getconnectioncount", "", 0},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(`{"jsonrpc": "2.0", "method": "`+test.method+`", "id": 1}`))
+		if test.key != "" {
+			request.Header.Set("X-API-Key", test.key)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		var response api.RPCResponse
+		err := json.Unmarshal(recorder.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatalf("%s: body %q: %v", test.method, recorder.Body.String(), err)
+		}
+		code := 0
+		if response.Error != nil {
+			code = response.Error.Code
+		}
+		if code != test.code {
+			t.Errorf("%s with key %q: got error %+v, want code %d", test.method, test.key, response.Error, test.code)
+		}
+	}
+}
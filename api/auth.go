@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Role is what a client is allowed to do, every role includes the ones below it.
+type Role int
+
+const (
+	// RolePublic reads the chain, the pool and the event stream
+	RolePublic Role = iota
+	// RoleSubmitter also submits transactions
+	RoleSubmitter
+	// RoleMiner also starts and stops mining
+	RoleMiner
+	// RoleAdmin also manages the node
+	RoleAdmin
+)
+
+var roleNames = []string{"public", "submitter", "miner", "admin"}
+
+func (role Role) String() string {
+	if role < 0 || int(role) >= len(roleNames) {
+		return fmt.Sprintf("Role(%d)", int(role))
+	}
+	return roleNames[role]
+}
+
+func ParseRole(name string) (Role, error) {
+	for i, roleName := range roleNames {
+		if name == roleName {
+			return Role(i), nil
+		}
+	}
+	return RolePublic, fmt.Errorf("unknown role %q, must be one of %s", name, strings.Join(roleNames, ", "))
+}
+
+// APIKey grants Role to the clients presenting Key.
+type APIKey struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	Role string `json:"role"`
+}
+
+// LoadAPIKeys reads a JSON array of API keys.
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []APIKey
+	err = json.Unmarshal(data, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// Auth authenticates API requests by the key in their "Authorization: Bearer"
+// or "X-API-Key" header. Requests without a key get AnonymousRole.
+type Auth struct {
+	AnonymousRole Role
+
+	// keys are indexed by their hash, so a lookup does not leak the keys through
+	// its timing
+	keys map[[sha256.Size]byte]Role
+}
+
+func NewAuth(keys []APIKey, anonymousRole Role) (*Auth, error) {
+	auth := &Auth{AnonymousRole: anonymousRole, keys: make(map[[sha256.Size]byte]Role)}
+	for _, key := range keys {
+		if key.Key == "" {
+			return nil, fmt.Errorf("API key %q is empty", key.Name)
+		}
+		role, err := ParseRole(key.Role)
+		if err != nil {
+			return nil, fmt.Errorf("API key %q: %w", key.Name, err)
+		}
+		auth.keys[sha256.Sum256([]byte(key.Key))] = role
+	}
+	return auth, nil
+}
+
+type roleContextKey struct{}
+
+// RoleFromContext returns the role of the client of a request that passed
+// Authenticate.
+func RoleFromContext(ctx context.Context) Role {
+	role, ok := ctx.Value(roleContextKey{}).(Role)
+	if !ok {
+		return RolePublic
+	}
+	return role
+}
+
+func requestKey(r *http.Request) string {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		scheme, token, found := strings.Cut(authorization, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// Authenticate resolves the role of every request. A request with an unknown key
+// is rejected instead of being treated as anonymous, so a typo does not go
+// unnoticed.
+func (auth *Auth) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := auth.AnonymousRole
+		if r.Header.Get("Authorization") != "" || r.Header.Get("X-API-Key") != "" {
+			key := requestKey(r)
+			keyRole, ok := auth.keys[sha256.Sum256([]byte(key))]
+			if !ok || key == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="blockchain"`)
+				writeError(w, http.StatusUnauthorized, ErrorCodeUnauthorized, "Invalid API key", "")
+				return
+			}
+			role = max(keyRole, auth.AnonymousRole)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), roleContextKey{}, role)))
+	})
+}
+
+// Require lets only clients with at least role call next.
+func Require(role Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if RoleFromContext(r.Context()) < role {
+			writeForbidden(w, r, role)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeForbidden(w http.ResponseWriter, r *http.Request, role Role) {
+	details := fmt.Sprintf("Requires the %s role", role)
+	if requestKey(r) == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="blockchain"`)
+		writeError(w, http.StatusUnauthorized, ErrorCodeUnauthorized, "Authentication required", details)
+		return
+	}
+	writeError(w, http.StatusForbidden, ErrorCodeForbidden, "Forbidden", details)
+}
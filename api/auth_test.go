@@ -0,0 +1,118 @@
+package api_test
+
+import (
+	"blockchain/api"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthRoles(t *testing.T) {
+	keys := []api.APIKey{
+		{Name: "wallet", Key: "submitter-key", Role: "submitter"},
+		{Name: "rig", Key: "miner-key", Role: "miner"},
+		{Name: "operator", Key: "admin-key", Role: "admin"},
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	tests := []struct {
+		name      string
+		anonymous api.Role
+		header    string
+		value     string
+		status    int
+	}{
+		{"anonymous", api.RolePublic, "", "", http.StatusUnauthorized},
+		{"too low role", api.RolePublic, "X-API-Key", "submitter-key", http.StatusForbidden},
+		{"bearer", api.RolePublic, "Authorization", "Bearer miner-key", http.StatusOK},
+		{"higher role", api.RolePublic, "X-API-Key", "admin-key", http.StatusOK},
+		{"unknown key", api.RolePublic, "X-API-Key", "guess", http.StatusUnauthorized},
+		{"other scheme", api.RolePublic, "Authorization", "Basic miner-key", http.StatusUnauthorized},
+		{"empty bearer", api.RolePublic, "Authorization", "Bearer ", http.StatusUnauthorized},
+		{"anonymous miner", api.RoleMiner, "", "", http.StatusOK},
+		// A key never lowers the role below the anonymous one
+		{"key below anonymous", api.RoleMiner, "X-API-Key", "submitter-key", http.StatusOK},
+		{"unknown key with anonymous miner", api.RoleMiner, "X-API-Key", "guess", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth, err := api.NewAuth(keys, test.anonymous)
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler := auth.Authenticate(api.Require(api.RoleMiner, ok))
+			request := httptest.NewRequest(http.MethodPost, "/blockchain/mine", nil)
+			if test.header != "" {
+				request.Header.Set(test.header, test.value)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.status {
+				t.Fatalf("status is %d, want %d: %s", recorder.Code, test.status, recorder.Body.String())
+			}
+			if challenged := recorder.Header().Get("WWW-Authenticate") != ""; challenged != (test.status == http.StatusUnauthorized) {
+				t.Fatalf("WWW-Authenticate is %q with status %d", recorder.Header().Get("WWW-Authenticate"), recorder.Code)
+			}
+		})
+	}
+}
+
+func TestNewAuthRejectsInvalidKeys(t *testing.T) {
+	for _, key := range []api.APIKey{
+		{Name: "empty", Key: "", Role: "admin"},
+		{Name: "unknown role", Key: "key", Role: "root"},
+	} {
+		_, err := api.NewAuth([]api.APIKey{key}, api.RolePublic)
+		if err == nil {
+			t.Errorf("key %q was accepted", key.Name)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		method  string
+		origin  string
+		// preflight sets Access-Control-Request-Method
+		preflight bool
+		wantAllow string
+		wantNext  bool
+	}{
+		{"allowed origin", []string{"http://localhost:3000"}, http.MethodGet, "http://localhost:3000", false, "http://localhost:3000", true},
+		{"other origin", []string{"http://localhost:3000"}, http.MethodGet, "http://evil.example", false, "", true},
+		{"any origin", []string{"*"}, http.MethodGet, "http://evil.example", false, "http://evil.example", true},
+		{"no origin", []string{"*"}, http.MethodGet, "", false, "", true},
+		{"preflight", []string{"http://localhost:3000"}, http.MethodOptions, "http://localhost:3000", true, "http://localhost:3000", false},
+		{"preflight of other origin", []string{"http://localhost:3000"}, http.MethodOptions, "http://evil.example", true, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reached := false
+			handler := api.CORS{AllowedOrigins: test.allowed}.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+			}))
+			request := httptest.NewRequest(test.method, "/blocks", nil)
+			if test.origin != "" {
+				request.Header.Set("Origin", test.origin)
+			}
+			if test.preflight {
+				request.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if allow := recorder.Header().Get("Access-Control-Allow-Origin"); allow != test.wantAllow {
+				t.Errorf("Access-Control-Allow-Origin is %q, want %q", allow, test.wantAllow)
+			}
+			if recorder.Header().Get("Vary") != "Origin" {
+				t.Errorf("Vary is %q, want Origin", recorder.Header().Get("Vary"))
+			}
+			if reached != test.wantNext {
+				t.Errorf("request reached the API: %v, want %v", reached, test.wantNext)
+			}
+			if test.preflight && recorder.Code != http.StatusNoContent {
+				t.Errorf("preflight status is %d, want %d", recorder.Code, http.StatusNoContent)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"blockchain/chain"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ErrorResponse is the body of every 4xx and 5xx response. Code is stable and
+// meant for programs, Message and Details are meant for people.
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details string `json:"details,omitempty"`
+}
+
+const (
+	ErrorCodeBadRequest           = "bad_request"
+	ErrorCodeInvalidAddress       = "invalid_address"
+	ErrorCodeInvalidAmount        = "invalid_amount"
+	ErrorCodeInvalidPrivateKey    = "invalid_private_key"
+	ErrorCodeUnauthorized         = "unauthorized"
+	ErrorCodeForbidden            = "forbidden"
+	ErrorCodeNotFound             = "not_found"
+	ErrorCodeMiningInProgress     = "mining_in_progress"
+	ErrorCodeDuplicateTransaction = "duplicate_transaction"
+	ErrorCodeUnavailable          = "unavailable"
+	ErrorCodePeerUnreachable      = "peer_unreachable"
+	ErrorCodeInternal             = "internal_error"
+)
+
+func writeError(w http.ResponseWriter, status int, code, message, details string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(ErrorResponse{Code: code, Message: message, Details: details})
+	if err != nil {
+		logger.Warn("Could not write response", "err", err)
+	}
+}
+
+func writeBadRequest(w http.ResponseWriter, details string) {
+	writeError(w, http.StatusBadRequest, ErrorCodeBadRequest, "Invalid request", details)
+}
+
+func writeNotFound(w http.ResponseWriter, details string) {
+	writeError(w, http.StatusNotFound, ErrorCodeNotFound, "Not found", details)
+}
+
+// writeInternalError logs err and hides it from the client.
+func writeInternalError(w http.ResponseWriter, err error) {
+	logger.Error("Request failed", "err", err)
+	writeError(w, http.StatusInternalServerError, ErrorCodeInternal, "Internal server error", "")
+}
+
+// writeLookupError answers a failed lookup with 404 for chain.ErrNotFound and 500
+// otherwise.
+func writeLookupError(w http.ResponseWriter, err error, details string) {
+	if errors.Is(err, chain.ErrNotFound) {
+		writeNotFound(w, details)
+		return
+	}
+	writeInternalError(w, err)
+}
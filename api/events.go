@@ -0,0 +1,103 @@
+package api
+
+import (
+	"blockchain/events"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sseKeepAlive is how often a comment is sent on an idle stream, so proxies do not
+// close it.
+const sseKeepAlive = 15 * time.Second
+
+// @Param topics query string false "Comma-separated event types or their prefixes, e.g. block,tip,transaction.accepted; all events if empty"
+// @Param lastEventId query int false "Resume after this event ID, the Last-Event-ID header takes precedence"
+// @Produce text/event-stream
+// @Success 200 {object} events.Event
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Router /events [get]
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || h.Events == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrorCodeUnavailable, "Event stream is not available", "")
+		return
+	}
+
+	var topics []string
+	for _, topic := range strings.Split(r.URL.Query().Get("topics"), ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	rawLastID := r.Header.Get("Last-Event-ID")
+	if rawLastID == "" {
+		rawLastID = r.URL.Query().Get("lastEventId")
+	}
+	var lastID uint64
+	if rawLastID != "" {
+		var err error
+		lastID, err = strconv.ParseUint(rawLastID, 10, 64)
+		if err != nil {
+			writeBadRequest(w, fmt.Sprintf("Invalid last event ID: %s", rawLastID))
+			return
+		}
+	}
+
+	subscription, missed := h.Events.Subscribe(topics, lastID, rawLastID != "")
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for _, event := range missed {
+		if !writeEvent(w, event) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-subscription.Events:
+			if !ok {
+				// The subscriber fell behind, the client reconnects with Last-Event-ID
+				return
+			}
+			if !writeEvent(w, event) {
+				return
+			}
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) bool {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		logger.Error("Could not marshal event", "type", event.Type, "err", err)
+		return true
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	if err != nil {
+		logger.Debug("Could not write event", "err", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package api_test
+
+import (
+	"blockchain/api"
+	"blockchain/events"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStreamEventsResume reconnects with Last-Event-ID and checks that the
+// stream starts with the missed events of the requested topics.
+func TestStreamEventsResume(t *testing.T) {
+	bus := events.NewBus(10)
+	h := &api.Handler{Events: bus}
+	bus.Publish(events.TipChanged, events.Tip{Hash: "first", Height: 1})
+	bus.Publish(events.PeerConnected, events.Peer{ID: "peer"})
+	bus.Publish(events.TipChanged, events.Tip{Hash: "second", Height: 2})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	stream := httptest.NewRequest(http.MethodGet, "/events?topics=tip", nil).WithContext(ctx)
+	stream.Header.Set("Last-Event-ID", "1")
+	recorder := httptest.NewRecorder()
+	h.StreamEvents(recorder, stream)
+
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got status %d and content type %q", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	want := "id: 3\nevent: tip\ndata: {\"hash\":\"second\",\"height\":2}\n\n"
+	if recorder.Body.String() != want {
+		t.Fatalf("stream is %q, want %q", recorder.Body.String(), want)
+	}
+
+	var body api.ErrorResponse
+	status := request(t, http.HandlerFunc(h.StreamEvents), http.MethodGet, "/events?lastEventId=x", &body)
+	if status != http.StatusBadRequest || !strings.Contains(body.Details, "x") {
+		t.Fatalf("invalid last event ID: got %d %+v", status, body)
+	}
+}
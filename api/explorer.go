@@ -0,0 +1,203 @@
+package api
+
+import (
+	"blockchain/chain"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type BlockResponse struct {
+	Block         chain.Block `json:"block"`
+	Height        int         `json:"height"`
+	Confirmations int         `json:"confirmations"`
+}
+
+type BlocksResponse struct {
+	Blocks []BlockResponse `json:"blocks"`
+	Total  int             `json:"total"`
+	Offset int             `json:"offset"`
+	Limit  int             `json:"limit"`
+}
+
+type TransactionResponse struct {
+	chain.TransactionLocation
+	Status string `json:"status"`
+}
+
+type AddressTransactionsResponse struct {
+	Address      string                      `json:"address"`
+	Transactions []chain.TransactionLocation `json:"transactions"`
+	Total        int                         `json:"total"`
+	Offset       int                         `json:"offset"`
+	Limit        int                         `json:"limit"`
+}
+
+type AddressBalanceResponse struct {
+	Address string `json:"address"`
+	chain.AddressSummary
+}
+
+const (
+	TransactionStatusPending   = "pending"
+	TransactionStatusConfirmed = "confirmed"
+)
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		logger.Warn("Could not write response", "err", err)
+	}
+}
+
+// pagination parses the offset and limit query parameters.
+func pagination(r *http.Request) (offset, limit int, err error) {
+	limit = defaultPageLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, fmt.Errorf("invalid limit: %s, must be between 1 and %d", raw, maxPageLimit)
+		}
+	}
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		offset, err = strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %s", raw)
+		}
+	}
+	return offset, limit, nil
+}
+
+// @Param height path int true "Block height, 0 is the genesis block"
+// @Success 200 {object} api.BlockResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Router /blocks/height/{height} [get]
+func (h *Handler) GetBlockByHeight(w http.ResponseWriter, r *http.Request) {
+	rawHeight := r.PathValue("height")
+	height, err := strconv.Atoi(rawHeight)
+	if err != nil || height < 0 {
+		writeBadRequest(w, fmt.Sprintf("Invalid height: %s", rawHeight))
+		return
+	}
+	block, err := h.Blockchain.BlockByHeight(height)
+	if err != nil {
+		writeLookupError(w, err, fmt.Sprintf("No block at height %d", height))
+		return
+	}
+	writeJSON(w, BlockResponse{Block: block, Height: height, Confirmations: h.Blockchain.Len() - height})
+}
+
+// @Param hash path string true "Block hash"
+// @Success 200 {object} api.BlockResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Router /blocks/hash/{hash} [get]
+func (h *Handler) GetBlockByHash(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	block, height, err := h.Blockchain.BlockByHash(hash)
+	if err != nil {
+		writeLookupError(w, err, fmt.Sprintf("Unknown block: %s", hash))
+		return
+	}
+	writeJSON(w, BlockResponse{Block: block, Height: height, Confirmations: h.Blockchain.Len() - height})
+}
+
+// @Param limit query int false "Number of blocks, 20 by default and at most 100"
+// @Param offset query int false "Number of blocks to skip from the tip"
+// @Success 200 {object} api.BlocksResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Router /blocks [get]
+func (h *Handler) GetLatestBlocks(w http.ResponseWriter, r *http.Request) {
+	offset, limit, err := pagination(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	total := h.Blockchain.Len()
+	blocks, err := h.Blockchain.LatestBlocks(offset, limit)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	response := BlocksResponse{Blocks: []BlockResponse{}, Total: total, Offset: offset, Limit: limit}
+	for i, block := range blocks {
+		height := total - 1 - offset - i
+		response.Blocks = append(response.Blocks, BlockResponse{Block: block, Height: height, Confirmations: total - height})
+	}
+	writeJSON(w, response)
+}
+
+// @Param id path string true "Transaction ID"
+// @Success 200 {object} api.TransactionResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Router /transactions/{id} [get]
+func (h *Handler) GetTransaction(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	location, pending, err := h.Blockchain.TransactionByID(id)
+	if err != nil {
+		writeLookupError(w, err, fmt.Sprintf("Unknown transaction: %s", id))
+		return
+	}
+	status := TransactionStatusConfirmed
+	if pending {
+		status = TransactionStatusPending
+	}
+	writeJSON(w, TransactionResponse{TransactionLocation: location, Status: status})
+}
+
+// @Param address query string true "Address"
+// @Param limit query int false "Number of transactions, 20 by default and at most 100"
+// @Param offset query int false "Number of transactions to skip from the newest"
+// @Success 200 {object} api.AddressTransactionsResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Router /address/transactions [get]
+func (h *Handler) GetAddressTransactions(w http.ResponseWriter, r *http.Request) {
+	// Addresses are PEM encoded keys, they contain slashes and cannot be a path value
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		writeBadRequest(w, "Missing address")
+		return
+	}
+	offset, limit, err := pagination(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	transactions, total, err := h.Blockchain.AddressTransactions(address, offset, limit)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	writeJSON(w, AddressTransactionsResponse{
+		Address:      address,
+		Transactions: transactions,
+		Total:        total,
+		Offset:       offset,
+		Limit:        limit,
+	})
+}
+
+// @Param address query string true "Address"
+// @Success 200 {object} api.AddressBalanceResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Router /address/balance [get]
+func (h *Handler) GetAddressBalance(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		writeBadRequest(w, "Missing address")
+		return
+	}
+	summary, err := h.Blockchain.AddressSummary(address)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	writeJSON(w, AddressBalanceResponse{Address: address, AddressSummary: summary})
+}
@@ -0,0 +1,143 @@
+package api_test
+
+import (
+	"blockchain/api"
+	"blockchain/chain"
+	"blockchain/storage"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// newExplorer returns the explorer routes of a regtest chain with blocks mined
+// blocks and the address of their miner.
+func newExplorer(t *testing.T, blocks int) (*api.Handler, http.Handler, string) {
+	t.Helper()
+	h := newHandler(t, storage.NewMemoryStorage())
+	miner := chain.Wallet{}
+	miner.KeyGen()
+	for i := 0; i < blocks; i++ {
+		err := h.Blockchain.MinePendingTransactions(miner.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /blocks", h.GetLatestBlocks)
+	mux.HandleFunc("GET /blocks/height/{height}", h.GetBlockByHeight)
+	mux.HandleFunc("GET /blocks/hash/{hash}", h.GetBlockByHash)
+	mux.HandleFunc("GET /transactions/{id}", h.GetTransaction)
+	mux.HandleFunc("GET /address/transactions", h.GetAddressTransactions)
+	return h, mux, miner.PublicKey
+}
+
+func TestLatestBlocksPagination(t *testing.T) {
+	_, explorer, _ := newExplorer(t, 5)
+	tests := []struct {
+		query       string
+		wantHeights []int
+		wantLimit   int
+	}{
+		{"", []int{5, 4, 3, 2, 1, 0}, 20},
+		{"?limit=2", []int{5, 4}, 2},
+		{"?limit=2&offset=3", []int{2, 1}, 2},
+		{"?offset=5", []int{0}, 20},
+		{"?offset=6", []int{}, 20},
+	}
+	for _, test := range tests {
+		var page api.BlocksResponse
+		status := request(t, explorer, http.MethodGet, "/blocks"+test.query, &page)
+		if status != http.StatusOK {
+			t.Fatalf("%s: status is %d", test.query, status)
+		}
+		heights := []int{}
+		for _, block := range page.Blocks {
+			heights = append(heights, block.Height)
+			if block.Confirmations != 6-block.Height {
+				t.Errorf("%s: block at height %d has %d confirmations", test.query, block.Height, block.Confirmations)
+			}
+		}
+		if !reflect.DeepEqual(heights, test.wantHeights) || page.Total != 6 || page.Limit != test.wantLimit {
+			t.Errorf("%s: got heights %v of %d with limit %d, want %v of 6 with limit %d", test.query, heights, page.Total, page.Limit, test.wantHeights, test.wantLimit)
+		}
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=101", "?limit=x", "?offset=-1"} {
+		var body api.ErrorResponse
+		status := request(t, explorer, http.MethodGet, "/blocks"+query, &body)
+		if status != http.StatusBadRequest || body.Code != api.ErrorCodeBadRequest {
+			t.Errorf("%s: got %d %+v, want %d %s", query, status, body, http.StatusBadRequest, api.ErrorCodeBadRequest)
+		}
+	}
+}
+
+func TestBlockAndTransactionLookup(t *testing.T) {
+	h, explorer, miner := newExplorer(t, 3)
+	block, err := h.Blockchain.BlockByHeight(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var byHeight, byHash api.BlockResponse
+	if status := request(t, explorer, http.MethodGet, "/blocks/height/2", &byHeight); status != http.StatusOK {
+		t.Fatalf("block by height: status is %d", status)
+	}
+	if status := request(t, explorer, http.MethodGet, "/blocks/hash/"+block.Hash, &byHash); status != http.StatusOK {
+		t.Fatalf("block by hash: status is %d", status)
+	}
+	for _, response := range []api.BlockResponse{byHeight, byHash} {
+		if response.Block.Hash != block.Hash || response.Height != 2 || response.Confirmations != 2 {
+			t.Errorf("got block %s at height %d with %d confirmations, want %s at 2 with 2", response.Block.Hash, response.Height, response.Confirmations, block.Hash)
+		}
+	}
+	missing := []struct {
+		target string
+		status int
+	}{
+		{"/blocks/height/4", http.StatusNotFound},
+		{"/blocks/height/-1", http.StatusBadRequest},
+		{"/blocks/hash/unknown", http.StatusNotFound},
+		{"/transactions/unknown", http.StatusNotFound},
+	}
+	for _, test := range missing {
+		var body api.ErrorResponse
+		if status := request(t, explorer, http.MethodGet, test.target, &body); status != test.status || body.Code == "" {
+			t.Errorf("%s: got %d %+v, want %d", test.target, status, body, test.status)
+		}
+	}
+
+	reward := block.Transactions[len(block.Transactions)-1]
+	var confirmed api.TransactionResponse
+	request(t, explorer, http.MethodGet, "/transactions/"+reward.TransactionId, &confirmed)
+	if confirmed.Status != api.TransactionStatusConfirmed || confirmed.BlockHeight != 2 || confirmed.Confirmations != 2 {
+		t.Errorf("mined transaction is %+v", confirmed)
+	}
+	receiver := chain.Wallet{}
+	receiver.KeyGen()
+	sender := chain.Wallet{}
+	sender.KeyGen()
+	transaction, err := chain.NewTransaction(sender.PrivateKey, sender.PublicKey, receiver.PublicKey, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = h.Blockchain.AddTransactionToPool(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pending api.TransactionResponse
+	request(t, explorer, http.MethodGet, "/transactions/"+transaction.TransactionId, &pending)
+	if pending.Status != api.TransactionStatusPending || pending.BlockHeight != -1 {
+		t.Errorf("pending transaction is %+v", pending)
+	}
+
+	var history api.AddressTransactionsResponse
+	request(t, explorer, http.MethodGet, "/address/transactions?limit=2&offset=1&address="+url.QueryEscape(miner), &history)
+	if history.Total != 3 || len(history.Transactions) != 2 || history.Address != miner {
+		t.Fatalf("history of the miner has %d of %d transactions, want 2 of 3", len(history.Transactions), history.Total)
+	}
+	// The newest transaction comes first, the offset skips the reward of block 3
+	if history.Transactions[0].BlockHeight != 2 || history.Transactions[1].BlockHeight != 1 {
+		t.Errorf("history holds the transactions of heights %d and %d, want 2 and 1", history.Transactions[0].BlockHeight, history.Transactions[1].BlockHeight)
+	}
+}
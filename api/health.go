@@ -0,0 +1,119 @@
+package api
+
+import (
+	"blockchain/chain"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StorageChecker reports whether the storage still accepts writes.
+type StorageChecker interface {
+	CheckWritable() error
+}
+
+// Readiness are the conditions of GetReadiness.
+type Readiness struct {
+	// MaxLag is how many blocks the node may be behind the best peer tip
+	MaxLag int
+	// MinPeers is the number of peers the node needs
+	MinPeers int
+}
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+type ReadinessResponse struct {
+	Status string `json:"status"`
+	Height int    `json:"height"`
+	// BestPeerHeight is the highest tip among the peers, -1 if none is known
+	BestPeerHeight int `json:"bestPeerHeight"`
+	Peers          int `json:"peers"`
+}
+
+type TipInfo struct {
+	Hash      string `json:"hash"`
+	Height    int    `json:"height"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type InfoResponse struct {
+	Version       string            `json:"version"`
+	NetworkID     string            `json:"networkId"`
+	PeerID        string            `json:"peerId"`
+	Params        chain.ChainParams `json:"params"`
+	Tip           TipInfo           `json:"tip"`
+	Peers         int               `json:"peers"`
+	UptimeSeconds int64             `json:"uptimeSeconds"`
+}
+
+const StatusOK = "ok"
+
+// @Success 200 {object} api.HealthResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Router /healthz [get]
+func (h *Handler) GetHealth(w http.ResponseWriter, r *http.Request) {
+	err := h.Storage.CheckWritable()
+	if err != nil {
+		logger.Error("Storage is not writable", "err", err)
+		writeError(w, http.StatusServiceUnavailable, ErrorCodeUnavailable, "Storage is not writable", err.Error())
+		return
+	}
+	writeJSON(w, HealthResponse{Status: StatusOK})
+}
+
+// GetReadiness reports whether the node is synchronized with its peers and has
+// enough of them to serve traffic.
+//
+// @Success 200 {object} api.ReadinessResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Router /readyz [get]
+func (h *Handler) GetReadiness(w http.ResponseWriter, r *http.Request) {
+	height := h.Blockchain.Len() - 1
+	bestPeerHeight, known := h.Node.BestPeerHeight()
+	peers := len(h.Node.PeerInfo())
+
+	var reasons []string
+	if peers < h.Readiness.MinPeers {
+		reasons = append(reasons, fmt.Sprintf("%d peers connected, %d required", peers, h.Readiness.MinPeers))
+	}
+	if h.Readiness.MinPeers > 0 && !known {
+		reasons = append(reasons, "no peer has reported its tip yet")
+	}
+	if bestPeerHeight-height > h.Readiness.MaxLag {
+		reasons = append(reasons, fmt.Sprintf("%d blocks behind the best peer at height %d", bestPeerHeight-height, bestPeerHeight))
+	}
+	if len(reasons) > 0 {
+		writeError(w, http.StatusServiceUnavailable, ErrorCodeUnavailable, "Node is not ready", strings.Join(reasons, "; "))
+		return
+	}
+	writeJSON(w, ReadinessResponse{
+		Status:         StatusOK,
+		Height:         height,
+		BestPeerHeight: bestPeerHeight,
+		Peers:          peers,
+	})
+}
+
+// @Success 200 {object} api.InfoResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Router /info [get]
+func (h *Handler) GetInfo(w http.ResponseWriter, r *http.Request) {
+	height := h.Blockchain.Len() - 1
+	tip, err := h.Blockchain.BlockByHeight(height)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	writeJSON(w, InfoResponse{
+		Version:       h.Version,
+		NetworkID:     h.NetworkID,
+		PeerID:        h.Node.Identity.ID,
+		Params:        h.Blockchain.Params,
+		Tip:           TipInfo{Hash: tip.Hash, Height: height, Timestamp: tip.Timestamp},
+		Peers:         len(h.Node.PeerInfo()),
+		UptimeSeconds: int64(time.Since(h.StartedAt).Seconds()),
+	})
+}
@@ -0,0 +1,98 @@
+package api_test
+
+import (
+	"blockchain/api"
+	"blockchain/chain"
+	"blockchain/p2p"
+	"blockchain/storage"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type storageCheck struct{ err error }
+
+func (check storageCheck) CheckWritable() error { return check.err }
+
+func TestGetHealth(t *testing.T) {
+	h := newHandler(t, storage.NewMemoryStorage())
+	h.Storage = storageCheck{}
+	var health api.HealthResponse
+	if status := request(t, http.HandlerFunc(h.GetHealth), http.MethodGet, "/healthz", &health); status != http.StatusOK || health.Status != api.StatusOK {
+		t.Fatalf("status %d, %+v", status, health)
+	}
+
+	h.Storage = storageCheck{errors.New("disk full")}
+	var body api.ErrorResponse
+	status := request(t, http.HandlerFunc(h.GetHealth), http.MethodGet, "/healthz", &body)
+	if status != http.StatusServiceUnavailable || body.Code != api.ErrorCodeUnavailable || body.Details != "disk full" {
+		t.Fatalf("status %d, %+v", status, body)
+	}
+}
+
+// TestGetReadiness keeps the node behind a peer by pausing block acceptance,
+// then lets it catch up.
+func TestGetReadiness(t *testing.T) {
+	network := p2p.NewMemoryNetwork()
+	h := newHandler(t, storage.NewMemoryStorage())
+	h.Node = startPeer(t, network, "local", h.Blockchain)
+	readiness := http.HandlerFunc(h.GetReadiness)
+
+	var ready api.ReadinessResponse
+	if status := request(t, readiness, http.MethodGet, "/readyz", &ready); status != http.StatusOK || ready.BestPeerHeight != -1 {
+		t.Fatalf("without requirements: status %d, %+v", status, ready)
+	}
+
+	h.Readiness = api.Readiness{MaxLag: 2, MinPeers: 1}
+	var body api.ErrorResponse
+	if status := request(t, readiness, http.MethodGet, "/readyz", &body); status != http.StatusServiceUnavailable || !strings.Contains(body.Details, "0 peers connected, 1 required") {
+		t.Fatalf("without peers: status %d, %+v", status, body)
+	}
+
+	remoteChain, err := chain.InitBlockchain(chain.RegtestParams, storage.NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	miner := chain.Wallet{}
+	miner.KeyGen()
+	for i := 0; i < 5; i++ {
+		err = remoteChain.MinePendingTransactions(miner.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	remote := startPeer(t, network, "remote", remoteChain)
+	h.Blockchain.PauseBlocks()
+	err = h.Node.ConnectToPeer(remote.Identity.ID+"@remote", h.Blockchain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForReadiness(t, readiness, http.StatusServiceUnavailable, "5 blocks behind the best peer at height 5")
+
+	h.Blockchain.ResumeBlocks()
+	h.Node.Resync(h.Blockchain)
+	waitForReadiness(t, readiness, http.StatusOK, "")
+	request(t, readiness, http.MethodGet, "/readyz", &ready)
+	if ready.Height < 3 || ready.BestPeerHeight != 5 || ready.Peers != 1 {
+		t.Fatalf("ready: %+v", ready)
+	}
+}
+
+// waitForReadiness polls readiness until it answers status with details.
+func waitForReadiness(t *testing.T, readiness http.Handler, status int, details string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var body api.ErrorResponse
+		got := request(t, readiness, http.MethodGet, "/readyz", &body)
+		if got == status && body.Details == details {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("readiness is %d %+v, want %d %q", got, body, status, details)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
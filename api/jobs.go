@@ -0,0 +1,93 @@
+package api
+
+import (
+	"blockchain/chain"
+	"blockchain/events"
+	"net/http"
+	"time"
+)
+
+// MiningJobStore keeps mining jobs until their TTL runs out. Lookups of unknown
+// or expired jobs return chain.ErrNotFound.
+type MiningJobStore interface {
+	SaveMiningJob(job chain.MiningJob, ttl time.Duration) error
+	MiningJob(id string) (chain.MiningJob, error)
+	// MiningJobs lists the jobs newest first, along with their total number
+	MiningJobs(offset, limit int) ([]chain.MiningJob, int, error)
+}
+
+const DefaultMiningJobTTL = 24 * time.Hour
+
+type MiningJobsResponse struct {
+	Jobs   []chain.MiningJob `json:"jobs"`
+	Total  int               `json:"total"`
+	Offset int               `json:"offset"`
+	Limit  int               `json:"limit"`
+}
+
+func (h *Handler) miningJobTTL() time.Duration {
+	if h.MiningJobTTL <= 0 {
+		return DefaultMiningJobTTL
+	}
+	return h.MiningJobTTL
+}
+
+// saveMiningJob stores job and publishes it as an events.MiningStatus event.
+func (h *Handler) saveMiningJob(job chain.MiningJob) error {
+	err := h.MiningJobs.SaveMiningJob(job, h.miningJobTTL())
+	if err != nil {
+		return err
+	}
+	h.Events.Publish(events.MiningStatus, job)
+	return nil
+}
+
+func (h *Handler) finishMiningJob(job chain.MiningJob, status string) {
+	finishedAt := time.Now()
+	job.Status = status
+	job.FinishedAt = &finishedAt
+	err := h.saveMiningJob(job)
+	if err != nil {
+		logger.Error("Could not save mining job", "job", job.ID, "err", err)
+	}
+}
+
+// FailInterruptedMiningJobs marks the jobs left pending by a previous run of the
+// node as failed, their blocks were never finished.
+func (h *Handler) FailInterruptedMiningJobs() error {
+	for offset := 0; ; offset += maxPageLimit {
+		jobs, total, err := h.MiningJobs.MiningJobs(offset, maxPageLimit)
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			if job.Status != StatusPending {
+				continue
+			}
+			job.Error = "interrupted by node restart"
+			h.finishMiningJob(job, StatusFailed)
+		}
+		if offset+maxPageLimit >= total {
+			return nil
+		}
+	}
+}
+
+// @Param offset query int false "Number of jobs to skip"
+// @Param limit query int false "Maximum number of jobs, 20 by default"
+// @Success 200 {object} api.MiningJobsResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Router /blockchain/mine [get]
+func (h *Handler) GetMiningJobs(w http.ResponseWriter, r *http.Request) {
+	offset, limit, err := pagination(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	jobs, total, err := h.MiningJobs.MiningJobs(offset, limit)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	writeJSON(w, MiningJobsResponse{Jobs: jobs, Total: total, Offset: offset, Limit: limit})
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"blockchain/metrics"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var requestDuration = metrics.NewHistogram("api_request_duration_seconds", "Latency of API requests by route and status.",
+	metrics.DefaultBuckets, "method", "route", "status")
+
+// statusRecorder remembers the status written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Write(data []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	return recorder.ResponseWriter.Write(data)
+}
+
+// Flush keeps the event stream working behind the recorder.
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+// Instrument records the latency of the requests served by mux, labelled with the
+// pattern of the route instead of the path to keep the number of series bounded.
+func Instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		_, route := mux.Handler(r)
+		recorder := &statusRecorder{ResponseWriter: w}
+		mux.ServeHTTP(recorder, r)
+
+		if route == "" {
+			route = "unmatched"
+		}
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		duration := time.Since(started)
+		requestDuration.Observe(duration.Seconds(), r.Method, route, strconv.Itoa(recorder.status))
+		logger.Debug("Served request", "method", r.Method, "path", r.URL.Path, "status", recorder.status, "duration", duration)
+	})
+}
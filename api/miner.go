@@ -0,0 +1,111 @@
+package api
+
+import (
+	"blockchain/chain"
+	"context"
+	"errors"
+	"time"
+)
+
+// StartMining mines blocks paying the reward to address one after another until
+// StopMining or Shutdown is called. It reports false if mining is already in
+// progress.
+func (h *Handler) StartMining(address string) bool {
+	if !h.MiningLock.TryLock() {
+		return false
+	}
+	ctx, cancel := context.WithCancel(h.context())
+	h.minerMutex.Lock()
+	h.minerCancel = cancel
+	h.minerAddress = address
+	h.minerMutex.Unlock()
+
+	h.mining.Add(1)
+	go func() {
+		defer h.mining.Done()
+		defer h.MiningLock.Unlock()
+		for ctx.Err() == nil {
+			result, err := h.Blockchain.Mine(ctx, address)
+			if err == nil {
+				h.Node.BroadcastBlock(result.Block)
+				continue
+			}
+			switch {
+			case ctx.Err() != nil:
+			case errors.Is(err, chain.ErrChainChanged):
+			case errors.Is(err, chain.ErrBlocksPaused):
+				sleep(ctx, time.Second)
+			default:
+				logger.Error("Mining failed", "address", address, "err", err)
+				sleep(ctx, time.Second)
+			}
+		}
+	}()
+	return true
+}
+
+// StopMining stops the miner started by StartMining, abandoning the block it is
+// working on. It reports false if the miner was not running.
+func (h *Handler) StopMining() bool {
+	h.minerMutex.Lock()
+	defer h.minerMutex.Unlock()
+
+	if h.minerCancel == nil {
+		return false
+	}
+	h.minerCancel()
+	h.minerCancel = nil
+	h.minerAddress = ""
+	return true
+}
+
+func (h *Handler) miningState() (bool, string) {
+	h.minerMutex.Lock()
+	defer h.minerMutex.Unlock()
+
+	return h.minerCancel != nil, h.minerAddress
+}
+
+// context returns the context of the background work of the handler, which is
+// canceled by Shutdown.
+func (h *Handler) context() context.Context {
+	h.minerMutex.Lock()
+	defer h.minerMutex.Unlock()
+
+	if h.ctx == nil {
+		h.ctx, h.cancel = context.WithCancel(context.Background())
+	}
+	return h.ctx
+}
+
+// Shutdown stops the miner and the mining jobs and waits until they are done or
+// ctx is.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	h.context()
+	h.minerMutex.Lock()
+	h.cancel()
+	h.minerCancel = nil
+	h.minerAddress = ""
+	h.minerMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.mining.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func sleep(ctx context.Context, duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,365 @@
+package api
+
+import (
+	"blockchain/chain"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// JSON-RPC 2.0 error codes. The application codes follow the ones of bitcoind, so
+// existing tooling can interpret them.
+const (
+	RPCParseError       = -32700
+	RPCInvalidRequest   = -32600
+	RPCMethodNotFound   = -32601
+	RPCInvalidParams    = -32602
+	RPCInternalError    = -32603
+	RPCNotFound         = -5
+	RPCVerifyRejected   = -26
+	RPCAlreadyInPool    = -27
+	RPCMiningInProgress = -32
+	RPCForbidden        = -32001
+)
+
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty" swaggertype:"object"`
+	// A request without ID is a notification and gets no response
+	ID json.RawMessage `json:"id,omitempty" swaggertype:"string"`
+}
+
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id" swaggertype:"string"`
+}
+
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+func invalidParams(format string, args ...any) *RPCError {
+	return &RPCError{Code: RPCInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
+
+// rpcMethod can be called by clients with at least role. call handles the params,
+// a returned *RPCError is sent as is, other errors are mapped by rpcError.
+type rpcMethod struct {
+	role Role
+	call func(h *Handler, params json.RawMessage) (any, error)
+}
+
+var rpcMethods map[string]rpcMethod
+
+func init() {
+	rpcMethods = map[string]rpcMethod{
+		"getblockcount":      {RolePublic, rpcGetBlockCount},
+		"getbestblockhash":   {RolePublic, rpcGetBestBlockHash},
+		"getblockhash":       {RolePublic, rpcGetBlockHash},
+		"getblock":           {RolePublic, rpcGetBlock},
+		"gettransaction":     {RolePublic, rpcGetTransaction},
+		"getbalance":         {RolePublic, rpcGetBalance},
+		"sendrawtransaction": {RoleSubmitter, rpcSendRawTransaction},
+		"getmempoolinfo":     {RolePublic, rpcGetMempoolInfo},
+		"getrawmempool":      {RolePublic, rpcGetRawMempool},
+		"getpeerinfo":        {RoleAdmin, rpcGetPeerInfo},
+		"getconnectioncount": {RolePublic, rpcGetConnectionCount},
+		"getmininginfo":      {RolePublic, rpcGetMiningInfo},
+		"startmining":        {RoleMiner, rpcStartMining},
+		"stopmining":         {RoleMiner, rpcStopMining},
+	}
+}
+
+// @Description JSON-RPC 2.0 endpoint, a batch of requests can be sent as an array
+// @Param request body api.RPCRequest true "JSON-RPC request"
+// @Success 200 {object} api.RPCResponse
+// @Router /rpc [post]
+func (h *Handler) RPC(w http.ResponseWriter, r *http.Request) {
+	var body json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeJSON(w, RPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: RPCParseError, Message: err.Error()}, ID: json.RawMessage("null")})
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '[' {
+		response, ok := h.call(r, body)
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, response)
+		return
+	}
+
+	var batch []json.RawMessage
+	err = json.Unmarshal(body, &batch)
+	if err != nil || len(batch) == 0 {
+		writeJSON(w, RPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: RPCInvalidRequest, Message: "Invalid batch"}, ID: json.RawMessage("null")})
+		return
+	}
+	responses := make([]RPCResponse, 0, len(batch))
+	for _, raw := range batch {
+		response, ok := h.call(r, raw)
+		if ok {
+			responses = append(responses, response)
+		}
+	}
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, responses)
+}
+
+// call runs a single request. It reports false for notifications, which get no
+// response.
+func (h *Handler) call(r *http.Request, raw json.RawMessage) (RPCResponse, bool) {
+	var request RPCRequest
+	err := json.Unmarshal(raw, &request)
+	if err != nil || request.JSONRPC != "2.0" || request.Method == "" {
+		return RPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: RPCInvalidRequest, Message: "Invalid request"}, ID: json.RawMessage("null")}, true
+	}
+	response := RPCResponse{JSONRPC: "2.0", ID: request.ID}
+
+	method, ok := rpcMethods[request.Method]
+	if !ok {
+		response.Error = &RPCError{Code: RPCMethodNotFound, Message: "Method not found: " + request.Method}
+	} else if RoleFromContext(r.Context()) < method.role {
+		response.Error = &RPCError{Code: RPCForbidden, Message: fmt.Sprintf("%s requires the %s role", request.Method, method.role)}
+	} else {
+		result, err := method.call(h, request.Params)
+		if err != nil {
+			response.Error = rpcError(err)
+		} else {
+			response.Result = result
+		}
+	}
+	return response, request.ID != nil
+}
+
+func rpcError(err error) *RPCError {
+	var rpcErr *RPCError
+	switch {
+	case errors.As(err, &rpcErr):
+		return rpcErr
+	case errors.Is(err, chain.ErrNotFound):
+		return &RPCError{Code: RPCNotFound, Message: err.Error()}
+	case errors.Is(err, chain.ErrKnownTransaction):
+		return &RPCError{Code: RPCAlreadyInPool, Message: err.Error()}
+	case errors.Is(err, chain.ErrInvalidTransaction):
+		return &RPCError{Code: RPCVerifyRejected, Message: err.Error()}
+	default:
+		logger.Error("RPC request failed", "err", err)
+		return &RPCError{Code: RPCInternalError, Message: err.Error()}
+	}
+}
+
+// decodeParams decodes params given either by name as an object or by position as
+// an array, names lists the fields of target in positional order.
+func decodeParams(params json.RawMessage, target any, names ...string) error {
+	params = bytes.TrimSpace(params)
+	if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+		params = []byte("{}")
+	}
+	if params[0] == '[' {
+		var positional []json.RawMessage
+		err := json.Unmarshal(params, &positional)
+		if err != nil {
+			return invalidParams("%v", err)
+		}
+		if len(positional) > len(names) {
+			return invalidParams("expected at most %d params", len(names))
+		}
+		named := make(map[string]json.RawMessage, len(positional))
+		for i, value := range positional {
+			named[names[i]] = value
+		}
+		params, err = json.Marshal(named)
+		if err != nil {
+			return invalidParams("%v", err)
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(target)
+	if err != nil {
+		return invalidParams("%v", err)
+	}
+	return nil
+}
+
+func rpcGetBlockCount(h *Handler, params json.RawMessage) (any, error) {
+	return h.Blockchain.Len() - 1, nil
+}
+
+func rpcGetBestBlockHash(h *Handler, params json.RawMessage) (any, error) {
+	return h.Blockchain.LastBlock().Hash, nil
+}
+
+func rpcGetBlockHash(h *Handler, params json.RawMessage) (any, error) {
+	var p struct {
+		Height *int `json:"height"`
+	}
+	err := decodeParams(params, &p, "height")
+	if err != nil {
+		return nil, err
+	}
+	if p.Height == nil {
+		return nil, invalidParams("missing height")
+	}
+	block, err := h.Blockchain.BlockByHeight(*p.Height)
+	if err != nil {
+		return nil, err
+	}
+	return block.Hash, nil
+}
+
+func rpcGetBlock(h *Handler, params json.RawMessage) (any, error) {
+	var p struct {
+		Hash string `json:"hash"`
+	}
+	err := decodeParams(params, &p, "hash")
+	if err != nil {
+		return nil, err
+	}
+	block, height, err := h.Blockchain.BlockByHash(p.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return BlockResponse{Block: block, Height: height, Confirmations: h.Blockchain.Len() - height}, nil
+}
+
+func rpcGetTransaction(h *Handler, params json.RawMessage) (any, error) {
+	var p struct {
+		ID string `json:"id"`
+	}
+	err := decodeParams(params, &p, "id")
+	if err != nil {
+		return nil, err
+	}
+	location, pending, err := h.Blockchain.TransactionByID(p.ID)
+	if err != nil {
+		return nil, err
+	}
+	status := TransactionStatusConfirmed
+	if pending {
+		status = TransactionStatusPending
+	}
+	return TransactionResponse{TransactionLocation: location, Status: status}, nil
+}
+
+func rpcGetBalance(h *Handler, params json.RawMessage) (any, error) {
+	var p struct {
+		Address string `json:"address"`
+	}
+	err := decodeParams(params, &p, "address")
+	if err != nil {
+		return nil, err
+	}
+	if p.Address == "" {
+		return nil, invalidParams("missing address")
+	}
+	summary, err := h.Blockchain.AddressSummary(p.Address)
+	if err != nil {
+		return nil, err
+	}
+	return summary.Balance, nil
+}
+
+// rpcSendRawTransaction accepts a transaction signed by the client, so the private
+// key never has to be sent to the node.
+func rpcSendRawTransaction(h *Handler, params json.RawMessage) (any, error) {
+	var p struct {
+		Transaction *chain.Transaction `json:"transaction"`
+	}
+	err := decodeParams(params, &p, "transaction")
+	if err != nil {
+		return nil, err
+	}
+	if p.Transaction == nil {
+		return nil, invalidParams("missing transaction")
+	}
+	transaction := *p.Transaction
+	err = h.Blockchain.AddTransactionToPool(transaction)
+	if err != nil {
+		return nil, err
+	}
+	go h.Node.BroadcastTransaction(transaction)
+	return transaction.TransactionId, nil
+}
+
+type MempoolInfo struct {
+	Size         int `json:"size"`
+	MaxBlockSize int `json:"maxBlockSize"`
+}
+
+func rpcGetMempoolInfo(h *Handler, params json.RawMessage) (any, error) {
+	return MempoolInfo{Size: len(h.Blockchain.GetPendingTransactions()), MaxBlockSize: h.Blockchain.MaxBlockSize}, nil
+}
+
+func rpcGetRawMempool(h *Handler, params json.RawMessage) (any, error) {
+	ids := []string{}
+	for _, t := range h.Blockchain.GetPendingTransactions() {
+		ids = append(ids, t.TransactionId)
+	}
+	return ids, nil
+}
+
+func rpcGetPeerInfo(h *Handler, params json.RawMessage) (any, error) {
+	return h.Node.PeerInfo(), nil
+}
+
+func rpcGetConnectionCount(h *Handler, params json.RawMessage) (any, error) {
+	return len(h.Node.PeerInfo()), nil
+}
+
+type MiningInfo struct {
+	Mining       bool    `json:"mining"`
+	Address      string  `json:"address"`
+	Blocks       int     `json:"blocks"`
+	Difficulty   int     `json:"difficulty"`
+	MiningReward float64 `json:"miningReward"`
+	PooledTx     int     `json:"pooledtx"`
+}
+
+func rpcGetMiningInfo(h *Handler, params json.RawMessage) (any, error) {
+	mining, address := h.miningState()
+	return MiningInfo{
+		Mining:       mining,
+		Address:      address,
+		Blocks:       h.Blockchain.Len() - 1,
+		Difficulty:   h.Blockchain.Difficulty,
+		MiningReward: h.Blockchain.MiningReward,
+		PooledTx:     len(h.Blockchain.GetPendingTransactions()),
+	}, nil
+}
+
+func rpcStartMining(h *Handler, params json.RawMessage) (any, error) {
+	var p struct {
+		Address string `json:"address"`
+	}
+	err := decodeParams(params, &p, "address")
+	if err != nil {
+		return nil, err
+	}
+	if !h.StartMining(p.Address) {
+		return nil, &RPCError{Code: RPCMiningInProgress, Message: "Mining already started"}
+	}
+	return true, nil
+}
+
+func rpcStopMining(h *Handler, params json.RawMessage) (any, error) {
+	return h.StopMining(), nil
+}
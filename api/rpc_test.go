@@ -0,0 +1,178 @@
+package api_test
+
+import (
+	"blockchain/api"
+	"blockchain/chain"
+	"blockchain/p2p"
+	"blockchain/storage"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newRPC returns the RPC endpoint of a regtest chain with two mined blocks,
+// called with the admin role.
+func newRPC(t *testing.T) (*api.Handler, http.Handler) {
+	t.Helper()
+	h := newHandler(t, storage.NewMemoryStorage())
+	h.Node = p2p.NewNode("localhost:0", nil, nil)
+	miner := chain.Wallet{}
+	miner.KeyGen()
+	for i := 0; i < 2; i++ {
+		err := h.Blockchain.MinePendingTransactions(miner.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	auth, err := api.NewAuth(nil, api.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, auth.Authenticate(http.HandlerFunc(h.RPC))
+}
+
+// call posts body to the RPC endpoint and returns the status and response body.
+func call(handler http.Handler, body string) (int, string) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body)))
+	return recorder.Code, recorder.Body.String()
+}
+
+func TestRPCParams(t *testing.T) {
+	h, rpc := newRPC(t)
+	block, err := h.Blockchain.BlockByHeight(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		params string
+		// result is the expected result, code the expected error code otherwise
+		result any
+		code   int
+	}{
+		{"positional", `[1]`, block.Hash, 0},
+		{"named", `{"height": 1}`, block.Hash, 0},
+		{"missing", `{}`, nil, api.RPCInvalidParams},
+		{"too many positional", `[1, 2]`, nil, api.RPCInvalidParams},
+		{"unknown name", `{"height": 1, "verbose": true}`, nil, api.RPCInvalidParams},
+		{"wrong type", `["one"]`, nil, api.RPCInvalidParams},
+		{"unknown block", `[99]`, nil, api.RPCNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, body := call(rpc, `{"jsonrpc": "2.0", "method": "getblockhash", "params": `+test.params+`, "id": "request"}`)
+			var response api.RPCResponse
+			err := json.Unmarshal([]byte(body), &response)
+			if err != nil {
+				t.Fatalf("body %q: %v", body, err)
+			}
+			if string(response.ID) != `"request"` {
+				t.Errorf("response has ID %s", response.ID)
+			}
+			if test.code != 0 {
+				if response.Error == nil || response.Error.Code != test.code {
+					t.Fatalf("got %s, want error code %d", body, test.code)
+				}
+				return
+			}
+			if response.Error != nil || response.Result != test.result {
+				t.Fatalf("got %s, want result %v", body, test.result)
+			}
+		})
+	}
+}
+
+func TestRPCBatch(t *testing.T) {
+	_, rpc := newRPC(t)
+	status, body := call(rpc, `[
+		{"jsonrpc": "2.0", "method": "getblockcount", "id": 1},
+		{"jsonrpc": "2.0", "method": "getblockcount"},
+		{"jsonrpc": "2.0", "method": "unknown", "id": 2},
+		{"method": "getblockcount", "id": 3}
+	]`)
+	var responses []api.RPCResponse
+	err := json.Unmarshal([]byte(body), &responses)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("got %d %q: %v", status, body, err)
+	}
+	// The notification gets no response
+	if len(responses) != 3 {
+		t.Fatalf("got %d responses, want 3: %s", len(responses), body)
+	}
+	if string(responses[0].ID) != "1" || responses[0].Result != float64(2) {
+		t.Errorf("getblockcount answered %+v", responses[0])
+	}
+	if string(responses[1].ID) != "2" || responses[1].Error == nil || responses[1].Error.Code != api.RPCMethodNotFound {
+		t.Errorf("unknown method answered %+v", responses[1])
+	}
+	if responses[2].Error == nil || responses[2].Error.Code != api.RPCInvalidRequest {
+		t.Errorf("request without version answered %+v", responses[2])
+	}
+
+	status, body = call(rpc, `[{"jsonrpc": "2.0", "method": "getblockcount"}]`)
+	if status != http.StatusNoContent || body != "" {
+		t.Errorf("batch of notifications: got %d %q, want %d", status, body, http.StatusNoContent)
+	}
+	for _, invalid := range []struct {
+		body string
+		code int
+	}{
+		{`[]`, api.RPCInvalidRequest},
+		{`{"jsonrpc": "2.0", "method": "getblockcount", "id": 1`, api.RPCParseError},
+	} {
+		var response api.RPCResponse
+		_, body := call(rpc, invalid.body)
+		err := json.Unmarshal([]byte(body), &response)
+		if err != nil || response.Error == nil || response.Error.Code != invalid.code || string(response.ID) != "null" {
+			t.Errorf("%s: got %q, want error code %d", invalid.body, body, invalid.code)
+		}
+	}
+}
+
+func TestRPCSendRawTransaction(t *testing.T) {
+	_, rpc := newRPC(t)
+	sender, receiver := chain.Wallet{}, chain.Wallet{}
+	sender.KeyGen()
+	receiver.KeyGen()
+	transaction, err := chain.NewTransaction(sender.PrivateKey, sender.PublicKey, receiver.PublicKey, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := transaction
+	forged.Amount = 100
+	forgedData, err := json.Marshal(forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		params string
+		code   int
+	}{
+		{`[` + string(data) + `]`, 0},
+		{`{"transaction": ` + string(data) + `}`, api.RPCAlreadyInPool},
+		{`[` + string(forgedData) + `]`, api.RPCVerifyRejected},
+	}
+	for _, test := range tests {
+		var response api.RPCResponse
+		_, body := call(rpc, `{"jsonrpc": "2.0", "method": "sendrawtransaction", "params": `+test.params+`, "id": 1}`)
+		err := json.Unmarshal([]byte(body), &response)
+		if err != nil {
+			t.Fatalf("body %q: %v", body, err)
+		}
+		code := 0
+		if response.Error != nil {
+			code = response.Error.Code
+		}
+		if code != test.code {
+			t.Errorf("got %s, want error code %d", body, test.code)
+		}
+	}
+}
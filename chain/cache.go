@@ -0,0 +1,71 @@
+package chain
+
+import (
+	"container/list"
+	"sync"
+)
+
+// blockCacheSize is the number of blocks kept in memory. Blocks near the tip are
+// asked for most often, by peers syncing and by the explorer.
+const blockCacheSize = 512
+
+// blockCache keeps the most recently used blocks of the chain by height. It has
+// its own lock, as readers holding the read lock of the chain update it.
+type blockCache struct {
+	mutex    sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[int]*list.Element
+}
+
+type cachedBlock struct {
+	height int
+	block  Block
+}
+
+func newBlockCache(capacity int) *blockCache {
+	return &blockCache{capacity: capacity, order: list.New(), items: make(map[int]*list.Element)}
+}
+
+func (cache *blockCache) get(height int) (Block, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, ok := cache.items[height]
+	if !ok {
+		return Block{}, false
+	}
+	cache.order.MoveToFront(element)
+	return element.Value.(*cachedBlock).block, true
+}
+
+func (cache *blockCache) add(height int, block Block) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.items[height]; ok {
+		element.Value.(*cachedBlock).block = block
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.items[height] = cache.order.PushFront(&cachedBlock{height: height, block: block})
+	for cache.order.Len() > cache.capacity {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.items, oldest.Value.(*cachedBlock).height)
+	}
+}
+
+// removeAbove drops the blocks above height, after they were replaced by a
+// reorganization.
+func (cache *blockCache) removeAbove(height int) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	for h, element := range cache.items {
+		if h > height {
+			cache.order.Remove(element)
+			delete(cache.items, h)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package chain
 
 import (
+	"blockchain/events"
+	"blockchain/logging"
+	"context"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/sha256"
@@ -8,12 +11,15 @@ import (
 	"encoding/asn1"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -28,39 +34,92 @@ type Block struct {
 	Capacity     int           `json:"capacity"`
 }
 
-func (b *Block) CalculateHash() string {
+// BlockHeader is the part of a block the hash is calculated from. The transactions
+// are committed to by TransactionsHash, so the proof of work of a header can be
+// checked without downloading the block body.
+type BlockHeader struct {
+	Hash             string `json:"hash"`
+	PreviousHash     string `json:"previousHash"`
+	Timestamp        int64  `json:"timestamp"`
+	Nonce            int    `json:"nonce"`
+	TransactionsHash string `json:"transactionsHash"`
+	Capacity         int    `json:"capacity"`
+	TransactionCount int    `json:"transactionCount"`
+}
+
+func (h *BlockHeader) CalculateHash() string {
+	// Создаем byte array из полей заголовка
+	headerBytes := []byte(fmt.Sprintf("%d%s%s%d", h.Timestamp, h.PreviousHash, h.TransactionsHash, h.Nonce))
+
+	// Получаем хэш блока с использованием SHA256
+	hash := sha256.Sum256(headerBytes)
+
+	// Возвращаем хэш в виде строки
+	return hex.EncodeToString(hash[:])
+}
+
+// HasValidProofOfWork checks that the hash matches the header fields and starts
+// with difficulty zeros.
+func (h *BlockHeader) HasValidProofOfWork(difficulty int) bool {
+	return h.Hash == h.CalculateHash() && strings.HasPrefix(h.Hash, strings.Repeat("0", difficulty))
+}
+
+func (b *Block) TransactionsHash() string {
 	// Объединяем содержимое блока, включая транзакции
 	blockContent := ""
 	for _, tx := range b.Transactions {
 		blockContent += tx.GetDataString()
 	}
 
-	// Создаем byte array с blockContent
-	blockBytes := []byte(fmt.Sprintf("%d%s%s%d", b.Timestamp, b.PreviousHash, blockContent, b.Nonce))
+	hash := sha256.Sum256([]byte(blockContent))
+	return hex.EncodeToString(hash[:])
+}
 
-	// Получаем хэш блока с использованием SHA256
-	hash := sha256.Sum256(blockBytes)
-	// Кодируем хэш в строку
-	hashHex := hex.EncodeToString(hash[:])
+func (b *Block) Header() BlockHeader {
+	return BlockHeader{
+		Hash:             b.Hash,
+		PreviousHash:     b.PreviousHash,
+		Timestamp:        b.Timestamp,
+		Nonce:            b.Nonce,
+		TransactionsHash: b.TransactionsHash(),
+		Capacity:         b.Capacity,
+		TransactionCount: len(b.Transactions),
+	}
+}
 
-	// Возвращаем хэш в виде строки
-	return hashHex
+func (b *Block) CalculateHash() string {
+	header := b.Header()
+	return header.CalculateHash()
+}
+
+// MineBlock searches the nonce and returns the number of hashes it tried.
+func (b *Block) MineBlock(difficulty int) int {
+	attempts, _ := b.MineBlockContext(context.Background(), difficulty)
+	return attempts
 }
 
-func (b *Block) MineBlock(difficulty int) {
+// MineBlockContext searches the nonce like MineBlock, but gives up with the error
+// of ctx once it is done. The block is left unchanged then.
+func (b *Block) MineBlockContext(ctx context.Context, difficulty int) (int, error) {
+	header := b.Header()
+	// Берем первые несколько символов (размера difficulty) из хэша
+	prefix := strings.Repeat("0", difficulty)
 	for {
-		// Вычисляем хэш блока
-		hash := b.CalculateHash()
+		// Вычисляем хэш заголовка
+		hash := header.CalculateHash()
 
-		// Берем первые несколько битов (размера difficulty) из хэша
-		prefix := strings.Repeat("0", difficulty)
 		if strings.HasPrefix(hash, prefix) {
-			// Nonce найден, блок майнится
+			// Nonce найден, блок майнится
+			attempts := header.Nonce - b.Nonce + 1
+			b.Nonce = header.Nonce
 			b.Hash = hash
-			return
-		} else {
-			// Увеличиваем Nonce и пробуем снова
-			b.Nonce++
+			return attempts, nil
+		}
+		// Увеличиваем Nonce и пробуем снова
+		header.Nonce++
+		// Checking the context on every hash would slow mining down noticeably
+		if (header.Nonce-b.Nonce)%4096 == 0 && ctx.Err() != nil {
+			return header.Nonce - b.Nonce, ctx.Err()
 		}
 	}
 }
@@ -110,19 +169,44 @@ func (t *Transaction) IsValid() bool {
 	}
 
 	if t.Signature == "" {
-		fmt.Println("Transaction is not signed")
+		logger.Debug("Transaction is not signed", "tx", t.TransactionId)
 		return false
 	}
 
 	isValid, err := t.verifySignature()
 	if err != nil {
-		fmt.Println("Error verifying signature:", err)
+		logger.Debug("Could not verify signature", "tx", t.TransactionId, "err", err)
 		return false
 	}
 
 	return isValid
 }
 
+// Validate checks a transaction before it enters the pool, wherever it comes
+// from: it must move a positive amount between valid addresses and be signed by
+// its sender. Rewards have no sender and are only created by Mine.
+func (t *Transaction) Validate() error {
+	if t.TransactionId == "" {
+		return fmt.Errorf("%w: missing id", ErrInvalidTransaction)
+	}
+	if t.FromAddress == "" {
+		return fmt.Errorf("%w: %s has no sender", ErrInvalidTransaction, t.TransactionId)
+	}
+	for _, address := range []string{t.FromAddress, t.ToAddress} {
+		err := ValidateAddress(address)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrInvalidTransaction, t.TransactionId, err)
+		}
+	}
+	if math.IsNaN(t.Amount) || math.IsInf(t.Amount, 0) || t.Amount <= 0 {
+		return fmt.Errorf("%w: %s has an invalid amount", ErrInvalidTransaction, t.TransactionId)
+	}
+	if !t.IsValid() {
+		return fmt.Errorf("%w: %s has an invalid signature", ErrInvalidTransaction, t.TransactionId)
+	}
+	return nil
+}
+
 func (t *Transaction) Sign(PrivateKeyPEMStr string) error {
 	pemBlock, _ := pem.Decode([]byte(PrivateKeyPEMStr))
 	if pemBlock == nil {
@@ -213,55 +297,233 @@ func NewTransaction(PrivateKey, fromAddress, toAddress string, amount float64) (
 	return t, nil
 }
 
+var logger = logging.For(logging.SubsystemChain)
+
+// Blockchain is safe for concurrent use. PendingTransactions must not be accessed
+// directly once the chain is shared, use the accessor methods instead. Only the
+// tip is kept in memory, other blocks are read from Storage when they are needed.
 type Blockchain struct {
-	Blocks              []Block `json:"blocks"`
 	PendingTransactions []Transaction
 	Difficulty          int     `json:"difficulty"`
 	MaxBlockSize        int     `json:"maxBlockSize"`
 	MiningReward        float64 `json:"miningReward"`
-	Storage             Storage
+	// Params are the rules Difficulty, MaxBlockSize and MiningReward come from
+	Params  ChainParams `json:"-"`
+	Storage Storage     `json:"-"`
+	// Events receives the changes of the chain and the pool, it may be nil
+	Events *events.Bus `json:"-"`
+	mutex  sync.RWMutex
+	paused bool
+	// tip is the last block, at height. height is -1 until the genesis block
+	// is added.
+	tip     Block
+	height  int
+	genesis string
+	blocks  *blockCache
+	// mining holds the IDs of the transactions running Mine calls took out of
+	// the pool
+	mining map[string]bool
 }
 
-func (chain *Blockchain) AddBlock(block Block) {
-	if len(chain.Blocks) != 0 {
-		block.PreviousHash = chain.Blocks[len(chain.Blocks)-1].Hash
+var (
+	ErrChainChanged       = errors.New("blockchain changed while mining")
+	ErrKnownTransaction   = errors.New("transaction is already known")
+	ErrInvalidTransaction = errors.New("invalid transaction")
+	ErrBlocksPaused       = errors.New("block acceptance is paused")
+)
+
+// SetParams applies params to a chain that is not shared yet.
+func (chain *Blockchain) SetParams(params ChainParams) {
+	chain.Params = params
+	chain.Difficulty = params.Difficulty
+	chain.MaxBlockSize = params.MaxBlockSize
+	chain.MiningReward = params.MiningReward
+}
+
+// PauseBlocks makes the chain refuse new blocks, mined or received, with
+// ErrBlocksPaused until ResumeBlocks is called. Transactions are still accepted.
+func (chain *Blockchain) PauseBlocks() {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	chain.paused = true
+}
+
+func (chain *Blockchain) ResumeBlocks() {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	chain.paused = false
+}
+
+func (chain *Blockchain) BlocksPaused() bool {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	return chain.paused
+}
+
+// blockchainJSON has the fields of Blockchain without its methods, so MarshalJSON
+// can encode it without recursion.
+type blockchainJSON Blockchain
+
+func (chain *Blockchain) MarshalJSON() ([]byte, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	return json.Marshal((*blockchainJSON)(chain))
+}
+
+// AddBlock appends block to the chain and stores it.
+func (chain *Blockchain) AddBlock(block Block) error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	if chain.height >= 0 {
+		block.PreviousHash = chain.tip.Hash
 	}
-	chain.Blocks = append(chain.Blocks, block)
+	return chain.connect(block)
 }
 
-func (chain *Blockchain) AddTransactionToPool(t Transaction) error {
+// open reads the tip from Storage, it is called before the chain is shared.
+func (chain *Blockchain) open() error {
+	chain.blocks = newBlockCache(blockCacheSize)
+	chain.height = -1
+	tip, height, err := chain.Storage.Tip()
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	genesis, err := chain.Storage.BlockByHeight(0)
+	if err != nil {
+		return err
+	}
+	chain.tip, chain.height, chain.genesis = tip, height, genesis.Hash
+	chain.blocks.add(height, tip)
+	return nil
+}
+
+// connect stores block on top of the tip and makes it the new tip. It must be
+// called with the lock held.
+func (chain *Blockchain) connect(block Block) error {
+	err := chain.Storage.AddBlock(block)
+	if err != nil {
+		return err
+	}
+	chain.height++
+	chain.tip = block
+	if chain.height == 0 {
+		chain.genesis = block.Hash
+	}
+	chain.blocks.add(chain.height, block)
+	return nil
+}
+
+// blockAt returns the block at height of the main chain. It must be called with
+// the lock held.
+func (chain *Blockchain) blockAt(height int) (Block, error) {
+	if height < 0 || height > chain.height {
+		return Block{}, ErrNotFound
+	}
+	if block, ok := chain.blocks.get(height); ok {
+		return block, nil
+	}
+	block, err := chain.Storage.BlockByHeight(height)
+	if err != nil {
+		return Block{}, err
+	}
+	chain.blocks.add(height, block)
+	return block, nil
+}
+
+func (chain *Blockchain) AddTransactionToPool(t Transaction) (err error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	defer func() { countTransaction(err) }()
+
+	err = t.Validate()
+	if err != nil {
+		return err
+	}
+	for _, pending := range chain.PendingTransactions {
+		if pending.TransactionId == t.TransactionId {
+			return ErrKnownTransaction
+		}
+	}
+	if chain.mining[t.TransactionId] {
+		return ErrKnownTransaction
+	}
+	_, err = chain.Storage.TransactionByID(t.TransactionId)
+	if err == nil {
+		return ErrKnownTransaction
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
 	chain.PendingTransactions = append(chain.PendingTransactions, t)
-	err := chain.Storage.AddTransaction(t)
+	err = chain.Storage.AddTransaction(t)
 	if err != nil {
 		return err
 	}
+	chain.Events.Publish(events.TransactionAccepted, t)
 	return nil
 }
 
+// GetPendingTransactions returns a copy of the transaction pool.
+func (chain *Blockchain) GetPendingTransactions() []Transaction {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	return append([]Transaction(nil), chain.PendingTransactions...)
+}
+
+func (chain *Blockchain) LastBlock() Block {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	return chain.tip
+}
+
+func (chain *Blockchain) Len() int {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	return chain.height + 1
+}
+
+// GetBalance returns the balance of address after all mined blocks, taken from
+// the address index of Storage.
 func (chain *Blockchain) GetBalance(address string) float64 {
-	var balance float64 = 0
-	for _, block := range chain.Blocks {
-		for _, t := range block.Transactions {
-			switch address {
-			case t.ToAddress:
-				balance += t.Amount
-			case t.FromAddress:
-				balance -= t.Amount
-			default:
-				balance += 0
-			}
-		}
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	summary, err := chain.Storage.AddressSummary(address)
+	if err != nil {
+		logger.Warn("Could not read balance", "err", err)
+		return 0
 	}
-	return balance
+	return summary.Balance
 }
 
+// IsValid checks every block of the chain. The blocks are read one by one and
+// bypass the cache, so checking does not evict the recent blocks.
 func (chain *Blockchain) IsValid() bool {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
 	previousHash := ""
-	for index, block := range chain.Blocks {
+	for height := 0; height <= chain.height; height++ {
+		block, err := chain.Storage.BlockByHeight(height)
+		if err != nil {
+			logger.Warn("Could not read block", "height", height, "err", err)
+			return false
+		}
 		if !block.IsValid() {
 			return false
 		}
-		if index == 0 {
+		if height == 0 {
 			previousHash = block.Hash
 			continue
 		}
@@ -273,7 +535,33 @@ func (chain *Blockchain) IsValid() bool {
 	return true
 }
 
+// MiningResult describes a block mined by Mine.
+type MiningResult struct {
+	Block  Block
+	Height int
+	// Attempts is the number of nonces tried
+	Attempts int
+}
+
+// MinePendingTransactions mines the pending transactions like Mine, for callers
+// that do not need the mined block.
 func (chain *Blockchain) MinePendingTransactions(minerAddress string) error {
+	_, err := chain.Mine(context.Background(), minerAddress)
+	return err
+}
+
+// Mine takes transactions out of the pool and mines them into a new block. The
+// lock is not held during proof of work, so if another block is added in the
+// meantime the transactions are returned to the pool and ErrChainChanged is
+// reported. The same happens with the error of ctx if it is done before a nonce
+// is found. Attempts is set in the result even when the block is not added.
+func (chain *Blockchain) Mine(ctx context.Context, minerAddress string) (result MiningResult, err error) {
+	defer func() { countBlocks(blockSourceMined, 1, err) }()
+	chain.mutex.Lock()
+	if chain.paused {
+		chain.mutex.Unlock()
+		return MiningResult{}, ErrBlocksPaused
+	}
 	currentPoolSize := len(chain.PendingTransactions)
 	var transactions []Transaction
 
@@ -284,6 +572,16 @@ func (chain *Blockchain) MinePendingTransactions(minerAddress string) error {
 		transactions = chain.PendingTransactions[0 : chain.MaxBlockSize-1]
 		chain.PendingTransactions = chain.PendingTransactions[chain.MaxBlockSize-1:]
 	}
+	transactions = append([]Transaction(nil), transactions...)
+	if chain.mining == nil {
+		chain.mining = make(map[string]bool)
+	}
+	for _, t := range transactions {
+		chain.mining[t.TransactionId] = true
+	}
+	previousHash := chain.tip.Hash
+	difficulty := chain.Difficulty
+	chain.mutex.Unlock()
 
 	rewardTx := Transaction{
 		FromAddress:   "",
@@ -292,48 +590,145 @@ func (chain *Blockchain) MinePendingTransactions(minerAddress string) error {
 		Timestamp:     int(time.Now().Unix()),
 		TransactionId: uuid.New().String(),
 	}
-	transactions = append(transactions, rewardTx)
 
 	block := Block{
-		Transactions: transactions,
+		Transactions: append(transactions, rewardTx),
 		Timestamp:    time.Now().Unix(),
 		Capacity:     chain.MaxBlockSize,
-		PreviousHash: chain.Blocks[len(chain.Blocks)-1].Hash,
+		PreviousHash: previousHash,
 	}
 	block.Hash = block.CalculateHash()
 
-	block.MineBlock(chain.Difficulty)
-	chain.AddBlock(block)
-	err := chain.Storage.AddBlock(block)
+	started := time.Now()
+	result.Attempts, err = block.MineBlockContext(ctx, difficulty)
+	countMining(result.Attempts, time.Since(started))
+
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	for _, t := range transactions {
+		delete(chain.mining, t.TransactionId)
+	}
+
 	if err != nil {
-		return err
+		chain.restoreTransactions(transactions)
+		return result, err
 	}
-	return nil
+	if chain.tip.Hash != previousHash {
+		chain.restoreTransactions(transactions)
+		return result, ErrChainChanged
+	}
+	if chain.paused {
+		chain.restoreTransactions(transactions)
+		return result, ErrBlocksPaused
+	}
+	err = chain.connect(block)
+	if err != nil {
+		chain.restoreTransactions(transactions)
+		return result, err
+	}
+	result.Block = block
+	result.Height = chain.height
+	logger.Info("Mined block", "block", block.Hash, "height", result.Height, "attempts", result.Attempts)
+	chain.publishConnected(block, result.Height)
+	chain.publishTip()
+	for _, t := range transactions {
+		chain.Events.Publish(events.TransactionEvicted, events.Eviction{
+			TransactionId: t.TransactionId,
+			Reason:        events.EvictedMined,
+		})
+	}
+	return result, nil
 }
 
+// restoreTransactions puts transactions Mine took out of the pool back in front
+// of it. Blocks connected in the meantime may have confirmed some of them, and a
+// reorganization may have returned them to the pool already, those are skipped.
+// It must be called with the lock held.
+func (chain *Blockchain) restoreTransactions(transactions []Transaction) {
+	pending := make(map[string]bool, len(chain.PendingTransactions))
+	for _, t := range chain.PendingTransactions {
+		pending[t.TransactionId] = true
+	}
+	restored := make([]Transaction, 0, len(transactions))
+	for _, t := range transactions {
+		if pending[t.TransactionId] {
+			continue
+		}
+		_, err := chain.Storage.TransactionByID(t.TransactionId)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ErrNotFound) {
+			// Keeping a transaction is safer than losing it, a block that
+			// includes it again is rejected by nobody
+			logger.Warn("Could not look up transaction", "tx", t.TransactionId, "err", err)
+		}
+		restored = append(restored, t)
+	}
+	chain.PendingTransactions = append(restored, chain.PendingTransactions...)
+}
+
+// Storage keeps the blocks of the main chain by height together with the pool.
+// Blocks are only ever added on top of the tip or replaced above a height, each
+// change is committed atomically with the indexes it affects.
 type Storage interface {
-	Load(difficulty, maxBlockSize int, miningReward float64) (*Blockchain, error)
+	// Load returns the chain with the pool of the storage, the blocks are read
+	// on demand
+	Load(params ChainParams) (*Blockchain, error)
+	// AddBlock stores b on top of the tip and removes its transactions from the
+	// pool
 	AddBlock(b Block) error
 	AddTransaction(t Transaction) error
-	Reset(chain *Blockchain) error
+	// ReplaceBlocks removes the blocks above forkHeight, stores blocks after it
+	// and adds restored, the transactions of the removed blocks, back to the pool
+	ReplaceBlocks(forkHeight int, blocks []Block, restored []Transaction) error
+	// Reset replaces everything stored with blocks and pool
+	Reset(blocks []Block, pool []Transaction) error
+	// Tip returns the last block and its height, or ErrNotFound if there are no
+	// blocks
+	Tip() (Block, int, error)
+
+	// Lookups of the explorer, answered from indexes kept by the storage. They
+	// return ErrNotFound for unknown blocks and transactions.
+	BlockByHeight(height int) (Block, error)
+	BlockByHash(hash string) (Block, int, error)
+	// HeightByHash returns the height of the block with hash in the main chain
+	HeightByHash(hash string) (int, error)
+	TransactionByID(id string) (TransactionLocation, error)
+	// AddressTransactions lists the transactions of address newest first
+	AddressTransactions(address string, offset, limit int) ([]TransactionLocation, error)
+	AddressSummary(address string) (AddressSummary, error)
 }
 
-func InitBlockchain(difficulty, maxBlockSize int, miningReward float64, s Storage) *Blockchain {
-	blockchain, err := s.Load(difficulty, maxBlockSize, miningReward)
-	if err != nil || len(blockchain.Blocks) == 0 {
-		fmt.Println("Could not load blockchain from storage. Creating a new one!")
-		blockchain := Blockchain{Difficulty: difficulty, MaxBlockSize: maxBlockSize, MiningReward: miningReward, Storage: s}
-		genesisBlock := Block{
-			Timestamp: time.Now().Unix(),
-		}
-		genesisBlock.MineBlock(blockchain.Difficulty)
-		blockchain.AddBlock(genesisBlock)
-		err := blockchain.Storage.AddBlock(genesisBlock)
+// InitBlockchain loads the chain from s, or starts it with the genesis block of
+// params if s is empty. It fails with ErrGenesisMismatch if s holds a chain with
+// another genesis block.
+func InitBlockchain(params ChainParams, s Storage) (*Blockchain, error) {
+	genesisBlock, err := params.Genesis.Block()
+	if err != nil {
+		return nil, err
+	}
+	blockchain, err := s.Load(params)
+	if err != nil {
+		return nil, fmt.Errorf("could not load blockchain: %w", err)
+	}
+	// Only an empty storage gets a new chain, any other error is returned so that
+	// no data is lost to a failed read
+	err = blockchain.open()
+	if err != nil {
+		return nil, fmt.Errorf("could not open blockchain: %w", err)
+	}
+	if blockchain.height < 0 {
+		logger.Info("Storage is empty, creating a new blockchain")
+		err = blockchain.AddBlock(genesisBlock)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		return &blockchain
+		return blockchain, nil
+	}
+	if blockchain.genesis != genesisBlock.Hash {
+		return nil, fmt.Errorf("%w: storage starts with %s, chain %s with %s", ErrGenesisMismatch, blockchain.genesis, params.Name, genesisBlock.Hash)
 	}
-	fmt.Println("Got blockchain from storage!")
-	return blockchain
+	logger.Info("Loaded blockchain from storage", "height", blockchain.height)
+	return blockchain, nil
 }
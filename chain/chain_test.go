@@ -0,0 +1,250 @@
+package chain_test
+
+import (
+	"blockchain/chain"
+	"blockchain/metrics"
+	"blockchain/storage"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentAccess adds transactions, mines and reads from many goroutines at
+// once and checks that every transaction ends up exactly once in a block or in
+// the pool. It is meant to be run with -race.
+func TestConcurrentAccess(t *testing.T) {
+	const (
+		senders               = 4
+		transactionsPerSender = 10
+		blocks                = 5
+	)
+	params := chain.RegtestParams
+	params.MaxBlockSize = 4
+	blockchain, err := chain.InitBlockchain(params, storage.NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver := chain.Wallet{}
+	receiver.KeyGen()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, senders+2)
+	ids := make(chan string, senders*transactionsPerSender)
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sender := chain.Wallet{}
+			sender.KeyGen()
+			for j := 0; j < transactionsPerSender; j++ {
+				transaction, err := chain.NewTransaction(sender.PrivateKey, sender.PublicKey, receiver.PublicKey, 1)
+				if err != nil {
+					errs <- err
+					return
+				}
+				err = blockchain.AddTransactionToPool(transaction)
+				if err != nil {
+					errs <- err
+					return
+				}
+				ids <- transaction.TransactionId
+			}
+		}()
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for mined := 0; mined < blocks; mined++ {
+			_, err := blockchain.Mine(context.Background(), receiver.PublicKey)
+			if err != nil && !errors.Is(err, chain.ErrChainChanged) {
+				errs <- err
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_, err := blockchain.LatestBlocks(0, 10)
+			if err != nil {
+				errs <- err
+				return
+			}
+			blockchain.GetPendingTransactions()
+			blockchain.GetBalance(receiver.PublicKey)
+			blockchain.LastBlock()
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	close(ids)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if !blockchain.IsValid() {
+		t.Fatal("chain is invalid")
+	}
+	seen := make(map[string]int)
+	for height := 0; height < blockchain.Len(); height++ {
+		block, err := blockchain.BlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, transaction := range block.Transactions {
+			seen[transaction.TransactionId]++
+		}
+	}
+	for _, transaction := range blockchain.GetPendingTransactions() {
+		seen[transaction.TransactionId]++
+	}
+	for id := range ids {
+		if seen[id] != 1 {
+			t.Errorf("transaction %s is stored %d times", id, seen[id])
+		}
+	}
+}
+
+// TestMineRestoresOnlyUnminedTransactions accepts a block with the transactions
+// a running Mine took from the pool and checks that failing Mine does not put
+// them back. Neither the transactions being mined nor the confirmed ones may be
+// added to the pool again.
+func TestMineRestoresOnlyUnminedTransactions(t *testing.T) {
+	params := chain.RegtestParams
+	blockchain, err := chain.InitBlockchain(params, storage.NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := chain.Wallet{}
+	sender.KeyGen()
+	receiver := chain.Wallet{}
+	receiver.KeyGen()
+	var transactions []chain.Transaction
+	for i := 0; i < 2; i++ {
+		transaction, err := chain.NewTransaction(sender.PrivateKey, sender.PublicKey, receiver.PublicKey, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = blockchain.AddTransactionToPool(transaction)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	// Nobody finds a hash of 64 leading zeros, so Mine runs until it is
+	// cancelled
+	blockchain.Difficulty = 64
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mined := make(chan error)
+	go func() {
+		_, err := blockchain.Mine(ctx, receiver.PublicKey)
+		mined <- err
+	}()
+	for len(blockchain.GetPendingTransactions()) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	blockchain.Difficulty = params.Difficulty
+	err = blockchain.AddTransactionToPool(transactions[0])
+	if !errors.Is(err, chain.ErrKnownTransaction) {
+		t.Fatalf("adding a transaction that is being mined: got error %v, want %v", err, chain.ErrKnownTransaction)
+	}
+
+	competing := chain.Block{
+		Transactions: transactions,
+		Timestamp:    time.Now().Unix(),
+		Capacity:     params.MaxBlockSize,
+		PreviousHash: blockchain.LastBlock().Hash,
+	}
+	competing.Hash = competing.CalculateHash()
+	_, err = competing.MineBlockContext(context.Background(), params.Difficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = blockchain.AcceptBlock(competing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	err = <-mined
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Mine returned %v, want %v", err, context.Canceled)
+	}
+
+	pending := blockchain.GetPendingTransactions()
+	if len(pending) != 0 {
+		t.Fatalf("pool holds %d mined transactions", len(pending))
+	}
+	err = blockchain.AddTransactionToPool(transactions[1])
+	if !errors.Is(err, chain.ErrKnownTransaction) {
+		t.Fatalf("adding a confirmed transaction: got error %v, want %v", err, chain.ErrKnownTransaction)
+	}
+}
+
+// sample scrapes the default registry and returns the value of the sample with
+// name and labels, like `blockchain_height` or `x_total{source="mined"}`.
+func sample(t *testing.T, series string) float64 {
+	t.Helper()
+	var out strings.Builder
+	_, err := metrics.Default.WriteTo(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		value, found := strings.CutPrefix(line, series+" ")
+		if !found {
+			continue
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		return number
+	}
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	blockchain, err := chain.InitBlockchain(chain.RegtestParams, storage.NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	miner := chain.Wallet{}
+	miner.KeyGen()
+	const (
+		accepted = `blockchain_blocks_accepted_total{source="mined"}`
+		paused   = `blockchain_blocks_rejected_total{source="mined",reason="paused"}`
+	)
+	acceptedBefore, pausedBefore := sample(t, accepted), sample(t, paused)
+
+	for i := 0; i < 2; i++ {
+		err = blockchain.MinePendingTransactions(miner.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	blockchain.PauseBlocks()
+	err = blockchain.MinePendingTransactions(miner.PublicKey)
+	if !errors.Is(err, chain.ErrBlocksPaused) {
+		t.Fatalf("mining while paused: got error %v, want %v", err, chain.ErrBlocksPaused)
+	}
+	if got := sample(t, accepted) - acceptedBefore; got != 2 {
+		t.Fatalf("%s grew by %v, want 2", accepted, got)
+	}
+	if got := sample(t, paused) - pausedBefore; got != 1 {
+		t.Fatalf("%s grew by %v, want 1", paused, got)
+	}
+
+	blockchain.CollectMetrics()
+	if got := sample(t, "blockchain_height"); got != 2 {
+		t.Fatalf("blockchain_height is %v, want 2", got)
+	}
+	if got := sample(t, "blockchain_difficulty"); got != float64(blockchain.Difficulty) {
+		t.Fatalf("blockchain_difficulty is %v, want %d", got, blockchain.Difficulty)
+	}
+}
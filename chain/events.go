@@ -0,0 +1,43 @@
+package chain
+
+import "blockchain/events"
+
+// The publish helpers must be called with the lock held, so events are published
+// in the order the changes were made.
+
+func (chain *Blockchain) publishConnected(block Block, height int) {
+	chain.Events.Publish(events.BlockConnected, events.Block{
+		Hash:             block.Hash,
+		Height:           height,
+		TransactionCount: len(block.Transactions),
+	})
+}
+
+func (chain *Blockchain) publishDisconnected(block Block, height int) {
+	chain.Events.Publish(events.BlockDisconnected, events.Block{
+		Hash:             block.Hash,
+		Height:           height,
+		TransactionCount: len(block.Transactions),
+	})
+}
+
+func (chain *Blockchain) publishTip() {
+	chain.Events.Publish(events.TipChanged, events.Tip{Hash: chain.tip.Hash, Height: chain.height})
+}
+
+// publishMined reports the transactions of before that are no longer in the pool
+// after a block was added.
+func (chain *Blockchain) publishMined(before []Transaction) {
+	remaining := make(map[string]bool, len(chain.PendingTransactions))
+	for _, t := range chain.PendingTransactions {
+		remaining[t.TransactionId] = true
+	}
+	for _, t := range before {
+		if !remaining[t.TransactionId] {
+			chain.Events.Publish(events.TransactionEvicted, events.Eviction{
+				TransactionId: t.TransactionId,
+				Reason:        events.EvictedMined,
+			})
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package chain
+
+import "errors"
+
+var ErrNotFound = errors.New("not found")
+
+// TransactionLocation is a mined transaction together with the position of the
+// block it was mined in.
+type TransactionLocation struct {
+	Transaction   Transaction `json:"transaction"`
+	BlockHash     string      `json:"blockHash"`
+	BlockHeight   int         `json:"blockHeight"`
+	Index         int         `json:"index"`
+	Confirmations int         `json:"confirmations"`
+}
+
+// AddressSummary is the state of an address after all mined blocks.
+type AddressSummary struct {
+	Balance          float64 `json:"balance"`
+	TransactionCount int     `json:"transactionCount"`
+}
+
+// BlockByHeight returns the block at height, the genesis block is at height 0.
+func (chain *Blockchain) BlockByHeight(height int) (Block, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	return chain.blockAt(height)
+}
+
+// BlockByHash returns the block with hash and its height.
+func (chain *Blockchain) BlockByHash(hash string) (Block, int, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	height, err := chain.Storage.HeightByHash(hash)
+	if err != nil {
+		return Block{}, 0, err
+	}
+	block, err := chain.blockAt(height)
+	return block, height, err
+}
+
+// LatestBlocks returns up to limit blocks starting offset blocks below the tip,
+// newest first.
+func (chain *Blockchain) LatestBlocks(offset, limit int) ([]Block, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	var blocks []Block
+	for height := chain.height - offset; height >= 0 && len(blocks) < limit; height-- {
+		block, err := chain.blockAt(height)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// TransactionByID looks a transaction up in the mined blocks and then in the pool.
+// pending reports that it was found in the pool and has no location yet.
+func (chain *Blockchain) TransactionByID(id string) (location TransactionLocation, pending bool, err error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	location, err = chain.Storage.TransactionByID(id)
+	if err == nil {
+		location.Confirmations = chain.height + 1 - location.BlockHeight
+		return location, false, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return TransactionLocation{}, false, err
+	}
+	for _, t := range chain.PendingTransactions {
+		if t.TransactionId == id {
+			return TransactionLocation{Transaction: t, BlockHeight: -1}, true, nil
+		}
+	}
+	return TransactionLocation{}, false, ErrNotFound
+}
+
+// AddressTransactions returns up to limit mined transactions sent or received by
+// address, newest first, and the total number of them.
+func (chain *Blockchain) AddressTransactions(address string, offset, limit int) ([]TransactionLocation, int, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	summary, err := chain.Storage.AddressSummary(address)
+	if err != nil {
+		return nil, 0, err
+	}
+	locations, err := chain.Storage.AddressTransactions(address, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range locations {
+		locations[i].Confirmations = chain.height + 1 - locations[i].BlockHeight
+	}
+	return locations, summary.TransactionCount, nil
+}
+
+func (chain *Blockchain) AddressSummary(address string) (AddressSummary, error) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	return chain.Storage.AddressSummary(address)
+}
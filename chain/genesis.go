@@ -0,0 +1,133 @@
+package chain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrGenesisMismatch = errors.New("genesis block does not match the chain parameters")
+
+// Genesis defines the first block of a chain. Every node builds the same block
+// from it, so nodes of one network agree on the chain they extend. The genesis
+// block is never mined by a node, Nonce and Hash are part of its definition.
+type Genesis struct {
+	Timestamp int64 `json:"timestamp"`
+	Nonce     int   `json:"nonce"`
+	// Hash must match the block built from the other fields. If it is empty the
+	// calculated hash is used.
+	Hash        string       `json:"hash"`
+	Allocations []Allocation `json:"allocations"`
+}
+
+// Allocation is a balance an address starts with, paid by a system transaction
+// of the genesis block.
+type Allocation struct {
+	Address string  `json:"address"`
+	Amount  float64 `json:"amount"`
+}
+
+// Validate checks that allocation pays a positive amount to a valid address.
+func (allocation Allocation) Validate() error {
+	err := ValidateAddress(allocation.Address)
+	if err != nil {
+		return err
+	}
+	if allocation.Amount <= 0 {
+		return fmt.Errorf("amount must be positive, got %v", allocation.Amount)
+	}
+	return nil
+}
+
+// validateAllocations checks the allocations of the file at path.
+func validateAllocations(path string, allocations []Allocation) error {
+	for i, allocation := range allocations {
+		err := allocation.Validate()
+		if err != nil {
+			return fmt.Errorf("allocation %d of %s: %w", i, path, err)
+		}
+	}
+	return nil
+}
+
+// LoadGenesis reads a genesis definition from a JSON file and validates its
+// allocations.
+func LoadGenesis(path string) (Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Genesis{}, err
+	}
+	var genesis Genesis
+	err = json.Unmarshal(data, &genesis)
+	if err != nil {
+		return Genesis{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	err = validateAllocations(path, genesis.Allocations)
+	if err != nil {
+		return Genesis{}, err
+	}
+	return genesis, nil
+}
+
+// LoadAllocations reads a JSON array of allocations, the premine of a network,
+// and validates them.
+func LoadAllocations(path string) ([]Allocation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var allocations []Allocation
+	err = json.Unmarshal(data, &allocations)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	err = validateAllocations(path, allocations)
+	if err != nil {
+		return nil, err
+	}
+	return allocations, nil
+}
+
+// WithAllocations returns the genesis with allocations in place of its own. The
+// hash is calculated again, as the allocations are part of the block.
+func (genesis Genesis) WithAllocations(allocations []Allocation) Genesis {
+	genesis.Allocations = allocations
+	genesis.Hash = ""
+	return genesis
+}
+
+// Block builds the genesis block.
+func (genesis Genesis) Block() (Block, error) {
+	transactions := make([]Transaction, 0, len(genesis.Allocations))
+	for i, allocation := range genesis.Allocations {
+		if allocation.Address == "" || allocation.Amount <= 0 {
+			return Block{}, fmt.Errorf("invalid genesis allocation %d: %q gets %v", i, allocation.Address, allocation.Amount)
+		}
+		transactions = append(transactions, Transaction{
+			ToAddress:     allocation.Address,
+			Amount:        allocation.Amount,
+			Timestamp:     int(genesis.Timestamp),
+			TransactionId: fmt.Sprintf("genesis-%d", i),
+		})
+	}
+	block := Block{
+		Transactions: transactions,
+		Timestamp:    genesis.Timestamp,
+		Nonce:        genesis.Nonce,
+		Capacity:     len(transactions),
+	}
+	block.Hash = block.CalculateHash()
+	if genesis.Hash != "" && genesis.Hash != block.Hash {
+		return Block{}, fmt.Errorf("genesis hash is %s, but the block hashes to %s", genesis.Hash, block.Hash)
+	}
+	return block, nil
+}
+
+// GenesisHash returns the hash of the first block of the chain.
+func (chain *Blockchain) GenesisHash() string {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	return chain.genesis
+}
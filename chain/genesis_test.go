@@ -0,0 +1,164 @@
+package chain_test
+
+import (
+	"blockchain/chain"
+	"blockchain/storage"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPresetGenesis checks that every preset builds the genesis block it
+// declares, so all nodes of a network start from the same block.
+func TestPresetGenesis(t *testing.T) {
+	for _, params := range []chain.ChainParams{chain.MainnetParams, chain.TestnetParams, chain.RegtestParams} {
+		t.Run(params.Name, func(t *testing.T) {
+			first, err := params.Genesis.Block()
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := params.Genesis.Block()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.Hash != params.Genesis.Hash || second.Hash != first.Hash {
+				t.Fatalf("genesis hashes to %s and %s, want %s", first.Hash, second.Hash, params.Genesis.Hash)
+			}
+			if first.Hash != first.CalculateHash() {
+				t.Fatalf("genesis hash %s is not the hash of its block", first.Hash)
+			}
+
+			tampered := params.Genesis
+			tampered.Timestamp++
+			_, err = tampered.Block()
+			if err == nil {
+				t.Fatal("a genesis with another timestamp matches the declared hash")
+			}
+		})
+	}
+}
+
+func TestInitBlockchainGenesis(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	first, err := chain.InitBlockchain(chain.RegtestParams, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := chain.InitBlockchain(chain.RegtestParams, storage.NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.GenesisHash() != chain.RegtestParams.Genesis.Hash || second.GenesisHash() != first.GenesisHash() {
+		t.Fatalf("genesis hashes are %s and %s, want %s", first.GenesisHash(), second.GenesisHash(), chain.RegtestParams.Genesis.Hash)
+	}
+
+	reopened, err := chain.InitBlockchain(chain.RegtestParams, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.GenesisHash() != first.GenesisHash() || reopened.Len() != 1 {
+		t.Fatalf("reopened chain has genesis %s and %d blocks", reopened.GenesisHash(), reopened.Len())
+	}
+	_, err = chain.InitBlockchain(chain.TestnetParams, s)
+	if !errors.Is(err, chain.ErrGenesisMismatch) {
+		t.Fatalf("opening a regtest storage as testnet: got error %v, want %v", err, chain.ErrGenesisMismatch)
+	}
+}
+
+// TestPremine checks that nodes loading the same premine file agree on the
+// genesis block and the balances it funds.
+func TestPremine(t *testing.T) {
+	alice, bob := chain.Wallet{}, chain.Wallet{}
+	alice.KeyGen()
+	bob.KeyGen()
+	allocations := []chain.Allocation{{Address: alice.PublicKey, Amount: 100}, {Address: bob.PublicKey, Amount: 2.5}}
+	data, err := json.Marshal(allocations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "premine.json")
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hashes []string
+	for i := 0; i < 2; i++ {
+		loaded, err := chain.LoadAllocations(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params := chain.RegtestParams
+		params.Genesis = params.Genesis.WithAllocations(loaded)
+		blockchain, err := chain.InitBlockchain(params, storage.NewMemoryStorage())
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, blockchain.GenesisHash())
+		for _, allocation := range allocations {
+			summary, err := blockchain.AddressSummary(allocation.Address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summary.Balance != allocation.Amount {
+				t.Fatalf("balance is %v, want %v", summary.Balance, allocation.Amount)
+			}
+		}
+	}
+	if hashes[0] != hashes[1] || hashes[0] == chain.RegtestParams.Genesis.Hash {
+		t.Fatalf("premined genesis hashes are %v, want two equal hashes other than %s", hashes, chain.RegtestParams.Genesis.Hash)
+	}
+
+	reordered, err := chain.RegtestParams.Genesis.WithAllocations([]chain.Allocation{allocations[1], allocations[0]}).Block()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reordered.Hash == hashes[0] {
+		t.Fatal("the order of the allocations does not change the genesis hash")
+	}
+}
+
+func TestLoadInvalidAllocations(t *testing.T) {
+	wallet := chain.Wallet{}
+	wallet.KeyGen()
+	tests := []struct {
+		name       string
+		allocation chain.Allocation
+		err        error
+	}{
+		{"invalid address", chain.Allocation{Address: "alice", Amount: 1}, chain.ErrInvalidAddress},
+		{"empty address", chain.Allocation{Amount: 1}, chain.ErrInvalidAddress},
+		{"zero amount", chain.Allocation{Address: wallet.PublicKey}, nil},
+		{"negative amount", chain.Allocation{Address: wallet.PublicKey, Amount: -5}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allocations := []chain.Allocation{{Address: wallet.PublicKey, Amount: 1}, test.allocation}
+			dir := t.TempDir()
+			files := map[string]any{
+				"premine.json": allocations,
+				"genesis.json": chain.Genesis{Timestamp: 1, Allocations: allocations},
+			}
+			for name, content := range files {
+				data, err := json.Marshal(content)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.WriteFile(filepath.Join(dir, name), data, 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, premineErr := chain.LoadAllocations(filepath.Join(dir, "premine.json"))
+			_, genesisErr := chain.LoadGenesis(filepath.Join(dir, "genesis.json"))
+			for _, err := range []error{premineErr, genesisErr} {
+				if err == nil || test.err != nil && !errors.Is(err, test.err) {
+					t.Fatalf("got error %v, want %v", err, test.err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package chain
+
+import "time"
+
+// MiningJob is the record of a block mined on request of an API client.
+type MiningJob struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// Attempts is the number of nonces tried
+	Attempts    int    `json:"attempts"`
+	BlockHash   string `json:"blockHash,omitempty"`
+	BlockHeight int    `json:"blockHeight,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
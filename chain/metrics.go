@@ -0,0 +1,97 @@
+package chain
+
+import (
+	"blockchain/metrics"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Sources of accepted blocks
+const (
+	blockSourceMined = "mined"
+	blockSourcePeer  = "peer"
+	blockSourceReorg = "reorg"
+)
+
+var (
+	heightGauge       = metrics.NewGauge("blockchain_height", "Height of the tip of the chain.")
+	tipAgeGauge       = metrics.NewGauge("blockchain_tip_age_seconds", "Seconds since the timestamp of the tip.")
+	difficultyGauge   = metrics.NewGauge("blockchain_difficulty", "Number of leading zeros required in block hashes.")
+	mempoolSizeGauge  = metrics.NewGauge("blockchain_mempool_transactions", "Number of transactions in the pool.")
+	mempoolBytesGauge = metrics.NewGauge("blockchain_mempool_bytes", "JSON encoded size of the transactions in the pool.")
+	hashRateGauge     = metrics.NewGauge("blockchain_mining_hash_rate", "Hashes per second while mining the last block.")
+	hashesCounter     = metrics.NewCounter("blockchain_mining_hashes_total", "Number of nonces tried while mining.")
+
+	blocksAcceptedCounter       = metrics.NewCounter("blockchain_blocks_accepted_total", "Blocks added to the chain by source.", "source")
+	blocksRejectedCounter       = metrics.NewCounter("blockchain_blocks_rejected_total", "Blocks not added to the chain by reason.", "source", "reason")
+	transactionsAcceptedCounter = metrics.NewCounter("blockchain_transactions_accepted_total", "Transactions added to the pool.")
+	transactionsRejectedCounter = metrics.NewCounter("blockchain_transactions_rejected_total", "Transactions not added to the pool by reason.", "reason")
+)
+
+// rejectReason is the reason label of err.
+func rejectReason(err error) string {
+	switch {
+	case errors.Is(err, ErrKnownBlock), errors.Is(err, ErrKnownTransaction):
+		return "known"
+	case errors.Is(err, ErrBlocksPaused):
+		return "paused"
+	case errors.Is(err, ErrForkBlock):
+		return "fork"
+	case errors.Is(err, ErrUnknownParent):
+		return "unknown_parent"
+	case errors.Is(err, ErrInvalidBlock), errors.Is(err, ErrInvalidHeader), errors.Is(err, ErrInvalidTransaction):
+		return "invalid"
+	case errors.Is(err, ErrShorterChain):
+		return "shorter_chain"
+	case errors.Is(err, ErrChainChanged):
+		return "chain_changed"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	}
+	return "error"
+}
+
+func countBlocks(source string, count int, err error) {
+	if err != nil {
+		blocksRejectedCounter.Add(float64(count), source, rejectReason(err))
+		return
+	}
+	blocksAcceptedCounter.Add(float64(count), source)
+}
+
+func countTransaction(err error) {
+	if err != nil {
+		transactionsRejectedCounter.Inc(rejectReason(err))
+		return
+	}
+	transactionsAcceptedCounter.Inc()
+}
+
+func countMining(attempts int, duration time.Duration) {
+	hashesCounter.Add(float64(attempts))
+	if duration > 0 {
+		hashRateGauge.Set(float64(attempts) / duration.Seconds())
+	}
+}
+
+// CollectMetrics updates the gauges describing the chain and the pool, it is
+// meant to run before every scrape.
+func (chain *Blockchain) CollectMetrics() {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	heightGauge.Set(float64(chain.height))
+	tipAgeGauge.Set(time.Since(time.Unix(chain.tip.Timestamp, 0)).Seconds())
+	difficultyGauge.Set(float64(chain.Difficulty))
+	mempoolSizeGauge.Set(float64(len(chain.PendingTransactions)))
+	var size int
+	for _, t := range chain.PendingTransactions {
+		data, err := json.Marshal(t)
+		if err == nil {
+			size += len(data)
+		}
+	}
+	mempoolBytesGauge.Set(float64(size))
+}
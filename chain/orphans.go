@@ -0,0 +1,105 @@
+package chain
+
+import (
+	"sync"
+	"time"
+)
+
+// OrphanPool holds blocks whose parent is not known yet, until the parent arrives
+// or they expire. It is safe for concurrent use.
+type OrphanPool struct {
+	MaxOrphans int
+	MaxAge     time.Duration
+
+	mutex   sync.Mutex
+	orphans map[string]orphan
+}
+
+type orphan struct {
+	block Block
+	added time.Time
+}
+
+func NewOrphanPool(maxOrphans int, maxAge time.Duration) *OrphanPool {
+	return &OrphanPool{MaxOrphans: maxOrphans, MaxAge: maxAge, orphans: make(map[string]orphan)}
+}
+
+// Add stores block, evicting expired orphans and, if the pool is still full, the
+// oldest one.
+func (pool *OrphanPool) Add(block Block) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if _, ok := pool.orphans[block.Hash]; ok {
+		return
+	}
+	now := time.Now()
+	pool.expire(now)
+	if pool.MaxOrphans > 0 && len(pool.orphans) >= pool.MaxOrphans {
+		oldest := ""
+		for hash, o := range pool.orphans {
+			if oldest == "" || o.added.Before(pool.orphans[oldest].added) {
+				oldest = hash
+			}
+		}
+		delete(pool.orphans, oldest)
+	}
+	pool.orphans[block.Hash] = orphan{block: block, added: now}
+}
+
+func (pool *OrphanPool) expire(now time.Time) {
+	if pool.MaxAge <= 0 {
+		return
+	}
+	for hash, o := range pool.orphans {
+		if now.Sub(o.added) > pool.MaxAge {
+			delete(pool.orphans, hash)
+		}
+	}
+}
+
+func (pool *OrphanPool) Has(hash string) bool {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	_, ok := pool.orphans[hash]
+	return ok
+}
+
+func (pool *OrphanPool) Len() int {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	return len(pool.orphans)
+}
+
+// MissingAncestor follows the parents of the orphan hash through the pool and
+// returns the hash of the first one that is not in the pool.
+func (pool *OrphanPool) MissingAncestor(hash string) string {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	for {
+		o, ok := pool.orphans[hash]
+		if !ok {
+			return hash
+		}
+		hash = o.block.PreviousHash
+	}
+}
+
+// TakeChildren removes and returns the orphans whose parent is parentHash.
+func (pool *OrphanPool) TakeChildren(parentHash string) []Block {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	pool.expire(time.Now())
+	var children []Block
+	for hash, o := range pool.orphans {
+		if o.block.PreviousHash == parentHash {
+			children = append(children, o.block)
+			delete(pool.orphans, hash)
+		}
+	}
+	return children
+}
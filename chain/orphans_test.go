@@ -0,0 +1,108 @@
+package chain_test
+
+import (
+	"blockchain/chain"
+	"blockchain/storage"
+	"errors"
+	"testing"
+	"time"
+)
+
+// minedBlocks mines count blocks on a new regtest chain and returns them in
+// order, without the genesis block.
+func minedBlocks(t *testing.T, count int) []chain.Block {
+	t.Helper()
+	blockchain, err := chain.InitBlockchain(chain.RegtestParams, storage.NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	miner := chain.Wallet{}
+	miner.KeyGen()
+	blocks := make([]chain.Block, 0, count)
+	for height := 1; height <= count; height++ {
+		err = blockchain.MinePendingTransactions(miner.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := blockchain.BlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// TestOrphansReverseOrder receives the blocks of a chain from the tip down, the
+// way a node does that learns about blocks it is missing from newer ones.
+func TestOrphansReverseOrder(t *testing.T) {
+	const count = 10
+	blocks := minedBlocks(t, count)
+	blockchain, err := chain.InitBlockchain(chain.RegtestParams, storage.NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := chain.NewOrphanPool(count, time.Minute)
+
+	for i := count - 1; i > 0; i-- {
+		err := blockchain.AcceptBlock(blocks[i])
+		if !errors.Is(err, chain.ErrUnknownParent) {
+			t.Fatalf("block %d: got error %v, want %v", i+1, err, chain.ErrUnknownParent)
+		}
+		pool.Add(blocks[i])
+		pool.Add(blocks[i])
+		if missing := pool.MissingAncestor(blocks[count-1].Hash); missing != blocks[i-1].Hash {
+			t.Fatalf("missing ancestor is %s, want block %d %s", missing, i, blocks[i-1].Hash)
+		}
+	}
+	if pool.Len() != count-1 {
+		t.Fatalf("pool holds %d orphans, want %d", pool.Len(), count-1)
+	}
+
+	err = blockchain.AcceptBlock(blocks[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	parents := []string{blocks[0].Hash}
+	for len(parents) > 0 {
+		children := pool.TakeChildren(parents[0])
+		parents = parents[1:]
+		for _, child := range children {
+			err := blockchain.AcceptBlock(child)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parents = append(parents, child.Hash)
+		}
+	}
+	if tip := blockchain.LastBlock(); tip.Hash != blocks[count-1].Hash || blockchain.Len() != count+1 {
+		t.Fatalf("tip is %s at height %d, want %s at %d", tip.Hash, blockchain.Len()-1, blocks[count-1].Hash, count)
+	}
+	if pool.Len() != 0 {
+		t.Fatalf("pool still holds %d orphans", pool.Len())
+	}
+}
+
+func TestOrphanPoolBounded(t *testing.T) {
+	blocks := minedBlocks(t, 10)
+	pool := chain.NewOrphanPool(3, time.Minute)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		pool.Add(blocks[i])
+		if pool.Len() > 3 {
+			t.Fatalf("pool holds %d orphans, at most 3 allowed", pool.Len())
+		}
+		if !pool.Has(blocks[i].Hash) {
+			t.Fatalf("block %d was evicted instead of an older orphan", i+1)
+		}
+	}
+	if pool.Len() != 3 {
+		t.Fatalf("pool holds %d orphans, want 3", pool.Len())
+	}
+
+	expiring := chain.NewOrphanPool(10, 10*time.Millisecond)
+	expiring.Add(blocks[1])
+	time.Sleep(20 * time.Millisecond)
+	if children := expiring.TakeChildren(blocks[0].Hash); len(children) != 0 || expiring.Len() != 0 {
+		t.Fatalf("expired orphan was returned: %v, %d left", children, expiring.Len())
+	}
+}
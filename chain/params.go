@@ -0,0 +1,92 @@
+package chain
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChainParams are the consensus rules of a network. Nodes of one network must
+// use the same parameters.
+type ChainParams struct {
+	Name string `json:"name"`
+	// Difficulty is the number of leading zeros required in block hashes
+	Difficulty int `json:"difficulty"`
+	// MaxBlockSize is the number of transactions in a block, including the reward
+	MaxBlockSize int     `json:"maxBlockSize"`
+	MiningReward float64 `json:"miningReward"`
+	Genesis      Genesis `json:"genesis"`
+}
+
+// Validate reports parameters no chain can be built with.
+func (params ChainParams) Validate() error {
+	if params.Difficulty < 0 || params.Difficulty > 64 {
+		return fmt.Errorf("difficulty must be between 0 and 64, got %d", params.Difficulty)
+	}
+	if params.MaxBlockSize < 1 {
+		return fmt.Errorf("max block size must be positive, got %d", params.MaxBlockSize)
+	}
+	if params.MiningReward < 0 {
+		return fmt.Errorf("mining reward must not be negative, got %v", params.MiningReward)
+	}
+	_, err := params.Genesis.Block()
+	return err
+}
+
+// Presets of chain parameters. Testnet keeps the values nodes used before they
+// became configurable.
+var (
+	MainnetParams = ChainParams{
+		Name:         "mainnet",
+		Difficulty:   6,
+		MaxBlockSize: 100,
+		MiningReward: 50,
+		Genesis: Genesis{
+			Timestamp: 1735689600,
+			Nonce:     15021580,
+			Hash:      "00000078abf80e89ca97b0c5ebda94987d205c01ffcd808f605110cf0ea2a345",
+		},
+	}
+	TestnetParams = ChainParams{
+		Name:         "testnet",
+		Difficulty:   5,
+		MaxBlockSize: 5,
+		MiningReward: 5,
+		Genesis: Genesis{
+			Timestamp: 1735776000,
+			Nonce:     20073,
+			Hash:      "000004adf94954793ff0b3012eba85cdf008879f639364fdde0748e87051f464",
+		},
+	}
+	// RegtestParams mine instantly, for tests and local experiments
+	RegtestParams = ChainParams{
+		Name:         "regtest",
+		Difficulty:   1,
+		MaxBlockSize: 100,
+		MiningReward: 50,
+		Genesis: Genesis{
+			Timestamp: 1735862400,
+			Hash:      "06f0b9a09adb88207e90dc0b287b8f6a8bce539ef859e6eb50a2845ec5e56ebb",
+		},
+	}
+)
+
+var presets = map[string]ChainParams{
+	MainnetParams.Name: MainnetParams,
+	TestnetParams.Name: TestnetParams,
+	RegtestParams.Name: RegtestParams,
+}
+
+// ParamsByName returns the preset called name.
+func ParamsByName(name string) (ChainParams, error) {
+	params, ok := presets[name]
+	if !ok {
+		names := make([]string, 0, len(presets))
+		for name := range presets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return ChainParams{}, fmt.Errorf("unknown chain %q, must be one of %s", name, strings.Join(names, ", "))
+	}
+	return params, nil
+}
@@ -0,0 +1,279 @@
+package chain
+
+import (
+	"blockchain/events"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrKnownBlock    = errors.New("block is already in the chain")
+	ErrUnknownParent = errors.New("parent block is unknown")
+	ErrForkBlock     = errors.New("block does not extend the tip")
+	ErrInvalidBlock  = errors.New("invalid block")
+	ErrInvalidHeader = errors.New("invalid header")
+	ErrShorterChain  = errors.New("chain is not longer than the current one")
+)
+
+// heightOf returns the height of the block with hash or -1. It must be called with
+// the lock held. The tip is the most likely to be asked for, other blocks are
+// looked up in the hash index of Storage.
+func (chain *Blockchain) heightOf(hash string) int {
+	if chain.height >= 0 && chain.tip.Hash == hash {
+		return chain.height
+	}
+	height, err := chain.Storage.HeightByHash(hash)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			logger.Warn("Could not look block up", "block", hash, "err", err)
+		}
+		return -1
+	}
+	return height
+}
+
+func (chain *Blockchain) HeightOf(hash string) (int, bool) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	height := chain.heightOf(hash)
+	return height, height >= 0
+}
+
+func (chain *Blockchain) GetBlockByHash(hash string) (Block, bool) {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	height := chain.heightOf(hash)
+	if height < 0 {
+		return Block{}, false
+	}
+	block, err := chain.blockAt(height)
+	if err != nil {
+		logger.Warn("Could not read block", "block", hash, "err", err)
+		return Block{}, false
+	}
+	return block, true
+}
+
+// Locator lists block hashes from the tip back to the genesis block, dense near
+// the tip and exponentially sparser further back, so a peer can find the last
+// block both chains have in common.
+func (chain *Blockchain) Locator() []string {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	var locator []string
+	step := 1
+	for height := chain.height; height > 0; height -= step {
+		block, err := chain.blockAt(height)
+		if err != nil {
+			logger.Warn("Could not read block", "height", height, "err", err)
+			break
+		}
+		locator = append(locator, block.Hash)
+		if len(locator) >= 10 {
+			step *= 2
+		}
+	}
+	if chain.height >= 0 {
+		locator = append(locator, chain.genesis)
+	}
+	return locator
+}
+
+// HeadersAfter returns up to limit headers following the first block of locator
+// that is in the chain.
+func (chain *Blockchain) HeadersAfter(locator []string, limit int) []BlockHeader {
+	chain.mutex.RLock()
+	defer chain.mutex.RUnlock()
+
+	start := 0
+	for _, hash := range locator {
+		if height := chain.heightOf(hash); height >= 0 {
+			start = height + 1
+			break
+		}
+	}
+	end := min(chain.height+1, start+limit)
+	headers := make([]BlockHeader, 0, max(end-start, 0))
+	for i := start; i < end; i++ {
+		block, err := chain.blockAt(i)
+		if err != nil {
+			logger.Warn("Could not read block", "height", i, "err", err)
+			break
+		}
+		headers = append(headers, block.Header())
+	}
+	return headers
+}
+
+// ValidateHeaders checks that headers form a chain starting at parentHash and that
+// each of them carries valid proof of work.
+func (chain *Blockchain) ValidateHeaders(parentHash string, headers []BlockHeader) error {
+	previousHash := parentHash
+	for _, header := range headers {
+		if header.PreviousHash != previousHash {
+			return fmt.Errorf("%w: %s does not follow %s", ErrInvalidHeader, header.Hash, previousHash)
+		}
+		if !header.HasValidProofOfWork(chain.Difficulty) {
+			return fmt.Errorf("%w: %s has no valid proof of work", ErrInvalidHeader, header.Hash)
+		}
+		if header.TransactionCount > header.Capacity {
+			return fmt.Errorf("%w: %s exceeds its capacity", ErrInvalidHeader, header.Hash)
+		}
+		previousHash = header.Hash
+	}
+	return nil
+}
+
+func (chain *Blockchain) validateBlock(block Block) error {
+	header := block.Header()
+	if !header.HasValidProofOfWork(chain.Difficulty) {
+		return fmt.Errorf("%w: %s has no valid proof of work", ErrInvalidBlock, block.Hash)
+	}
+	if !block.IsValid() {
+		return fmt.Errorf("%w: %s", ErrInvalidBlock, block.Hash)
+	}
+	return nil
+}
+
+// AcceptBlock validates a block received from a peer and appends it if it extends
+// the tip. Blocks of other branches are reported with ErrForkBlock or
+// ErrUnknownParent, a longer branch has to be adopted with ReplaceChain.
+func (chain *Blockchain) AcceptBlock(block Block) (err error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	defer func() { countBlocks(blockSourcePeer, 1, err) }()
+
+	if chain.heightOf(block.Hash) >= 0 {
+		return ErrKnownBlock
+	}
+	if chain.paused {
+		return ErrBlocksPaused
+	}
+	if block.PreviousHash != chain.tip.Hash {
+		if chain.heightOf(block.PreviousHash) >= 0 {
+			return ErrForkBlock
+		}
+		return ErrUnknownParent
+	}
+	err = chain.validateBlock(block)
+	if err != nil {
+		return err
+	}
+
+	err = chain.connect(block)
+	if err != nil {
+		return err
+	}
+	before := chain.PendingTransactions
+	chain.PendingTransactions = withoutTransactions(chain.PendingTransactions, []Block{block})
+	chain.publishConnected(block, chain.height)
+	chain.publishTip()
+	chain.publishMined(before)
+	return nil
+}
+
+// ReplaceChain switches to the branch that forks off after the block forkHash and
+// continues with blocks, if it is longer than the current chain. Transactions of
+// the abandoned blocks go back to the pool.
+func (chain *Blockchain) ReplaceChain(forkHash string, blocks []Block) (err error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	defer func() { countBlocks(blockSourceReorg, len(blocks), err) }()
+
+	if chain.paused {
+		return ErrBlocksPaused
+	}
+	forkHeight := chain.heightOf(forkHash)
+	if forkHeight < 0 {
+		return ErrUnknownParent
+	}
+	if forkHeight+1+len(blocks) <= chain.height+1 {
+		return ErrShorterChain
+	}
+	previousHash := forkHash
+	for _, block := range blocks {
+		if block.PreviousHash != previousHash {
+			return fmt.Errorf("%w: %s does not follow %s", ErrInvalidBlock, block.Hash, previousHash)
+		}
+		err := chain.validateBlock(block)
+		if err != nil {
+			return err
+		}
+		previousHash = block.Hash
+	}
+
+	// Only the abandoned blocks are read, a reorganization is short compared to
+	// the chain
+	disconnected := make([]Block, 0, chain.height-forkHeight)
+	for height := forkHeight + 1; height <= chain.height; height++ {
+		block, err := chain.blockAt(height)
+		if err != nil {
+			return err
+		}
+		disconnected = append(disconnected, block)
+	}
+	var restored []Transaction
+	for _, block := range disconnected {
+		for _, t := range block.Transactions {
+			if t.FromAddress != "" {
+				restored = append(restored, t)
+			}
+		}
+	}
+	restored = withoutTransactions(restored, blocks)
+	pool := withoutTransactions(append(append([]Transaction(nil), chain.PendingTransactions...), restored...), blocks)
+
+	err = chain.Storage.ReplaceBlocks(forkHeight, blocks, restored)
+	if err != nil {
+		return err
+	}
+	for i := len(disconnected) - 1; i >= 0; i-- {
+		chain.publishDisconnected(disconnected[i], forkHeight+1+i)
+	}
+	for i, block := range blocks {
+		chain.publishConnected(block, forkHeight+1+i)
+	}
+	chain.blocks.removeAbove(forkHeight)
+	chain.height = forkHeight + len(blocks)
+	chain.tip = blocks[len(blocks)-1]
+	for i, block := range blocks {
+		chain.blocks.add(forkHeight+1+i, block)
+	}
+	logger.Info("Switched to a longer branch", "fork", forkHash, "disconnected", len(disconnected),
+		"connected", len(blocks), "block", chain.tip.Hash)
+	before := chain.PendingTransactions
+	chain.PendingTransactions = pool
+	chain.publishTip()
+	chain.publishMined(before)
+	known := make(map[string]bool, len(before))
+	for _, t := range before {
+		known[t.TransactionId] = true
+	}
+	for _, t := range pool {
+		if !known[t.TransactionId] {
+			chain.Events.Publish(events.TransactionAccepted, t)
+		}
+	}
+	return nil
+}
+
+// withoutTransactions returns the transactions of pool that are not in blocks.
+func withoutTransactions(pool []Transaction, blocks []Block) []Transaction {
+	included := make(map[string]bool)
+	for _, block := range blocks {
+		for _, t := range block.Transactions {
+			included[t.TransactionId] = true
+		}
+	}
+	result := make([]Transaction, 0, len(pool))
+	for _, t := range pool {
+		if !included[t.TransactionId] {
+			result = append(result, t)
+			included[t.TransactionId] = true
+		}
+	}
+	return result
+}
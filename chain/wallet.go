@@ -6,9 +6,12 @@ import (
 	"crypto/rand"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 )
 
+var ErrInvalidAddress = errors.New("invalid address")
+
 type Wallet struct {
 	PrivateKey string
 	PublicKey  string
@@ -18,14 +21,14 @@ func (w *Wallet) KeyGen() {
 	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	privateKeyPEMStr, err := PrivateKeyToPEMString(privateKey)
 	if err != nil {
-		fmt.Println("Error converting private key to PEM:", err)
+		logger.Error("Could not encode private key", "err", err)
 		return
 	}
 	w.PrivateKey = privateKeyPEMStr
 
 	publicKeyPEMStr, err := PublicKeyToPEMString(&privateKey.PublicKey)
 	if err != nil {
-		fmt.Println("Error converting private key to PEM:", err)
+		logger.Error("Could not encode public key", "err", err)
 		return
 	}
 	w.PublicKey = publicKeyPEMStr
@@ -60,3 +63,20 @@ func PublicKeyToPEMString(pubKey *ecdsa.PublicKey) (string, error) {
 
 	return string(pemData), nil
 }
+
+// ValidateAddress checks that address is a PEM encoded ECDSA public key, the form
+// produced by PublicKeyToPEMString.
+func ValidateAddress(address string) error {
+	pemBlock, _ := pem.Decode([]byte(address))
+	if pemBlock == nil {
+		return fmt.Errorf("%w: not a PEM encoded public key", ErrInvalidAddress)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(pemBlock.Bytes)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	if _, ok := publicKey.(*ecdsa.PublicKey); !ok {
+		return fmt.Errorf("%w: not an ECDSA public key", ErrInvalidAddress)
+	}
+	return nil
+}
@@ -3,18 +3,26 @@ package main
 import (
 	"blockchain/api"
 	"blockchain/chain"
+	"blockchain/config"
+	"blockchain/events"
+	"blockchain/logging"
+	"blockchain/metrics"
 	"blockchain/p2p"
 	"blockchain/storage"
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
@@ -31,6 +39,37 @@ func PrettyPrintBlockchain(blockchain *chain.Blockchain) {
 	fmt.Println(string(blockchainJSON))
 }
 
+var logger = logging.For(logging.SubsystemNode)
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// fatal logs an error the node cannot run with and exits.
+func fatal(message string, args ...any) {
+	logger.Error(message, args...)
+	os.Exit(1)
+}
+
+// nodeStorage is what the node needs from the storage of its chain.
+type nodeStorage interface {
+	chain.Storage
+	api.MiningJobStore
+	api.StorageChecker
+	Shutdown(ctx context.Context) error
+}
+
+// openStorage opens the storage of the configured type.
+func openStorage(settings config.Storage) (nodeStorage, error) {
+	switch settings.Type {
+	case storage.TypeBadger:
+		return storage.NewBadgerStorage(settings.Path)
+	case storage.TypeMemory:
+		return storage.NewMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage type %q, must be %s or %s", settings.Type, storage.TypeBadger, storage.TypeMemory)
+	}
+}
+
 // @title Swagger Example API
 // @version 1.0
 // @description This is a sample server Petstore server.
@@ -48,48 +87,209 @@ func PrettyPrintBlockchain(blockchain *chain.Blockchain) {
 func main() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
-	listenAddress := flag.String("address", "localhost:8080", "Address to listen on")
-	httpAddress := flag.String("http", "localhost:8090", "Address to listen on")
-	peers := flag.String("peers", "", "Comma-separated list of peers to connect to")
-	storage_name := flag.String("storage", "chain_storage", "Badger storage name")
+	flagValues := config.Default()
+	config.RegisterFlags(flag.CommandLine, &flagValues)
+	configPath := flag.String("config", "", "Path to a JSON config file, overridden by BLOCKCHAIN_* environment variables and flags")
+	migrateDryRun := flag.Bool("migrate-dry-run", false, "Check the storage migrations the database needs without applying them, then exit")
 	flag.Parse()
 
-	storage, err := storage.NewBadgerStorage("./" + *storage_name)
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		fmt.Println("Error")
-		fmt.Println(err)
+		fatal("Could not load config", "path", *configPath, "err", err)
+	}
+	config.ApplyFlags(flag.CommandLine, &flagValues, &cfg)
+
+	// ctx is canceled on the first SIGINT or SIGTERM, a second one kills the node
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = logging.Setup(os.Stderr, cfg.Logging.Format, cfg.Logging.Level)
+	if err != nil {
+		fatal("Invalid logging settings", "err", err)
+	}
+
+	if *migrateDryRun {
+		if cfg.Storage.Type != storage.TypeBadger {
+			fatal("Only the Badger storage has migrations", "type", cfg.Storage.Type)
+		}
+		migrations, err := storage.Migrate(cfg.Storage.Path, true)
+		if err != nil {
+			fatal("Storage migration failed", "path", cfg.Storage.Path, "err", err)
+		}
+		for _, migration := range migrations {
+			logger.Info("Storage migration would be applied", "version", migration.Version, "migration", migration.Description)
+		}
+		logger.Info("Storage migration check passed", "path", cfg.Storage.Path, "pending", len(migrations), "version", storage.SchemaVersion)
+		return
+	}
+
+	params, err := cfg.Network.ChainParams()
+	if err != nil {
+		fatal("Invalid chain parameters", "err", err)
+	}
+
+	identityPath := cfg.P2P.Identity
+	if identityPath == "" {
+		identityPath = cfg.Storage.Path + ".key"
+	}
+	identity, err := p2p.LoadOrCreateIdentity(identityPath)
+	if err != nil {
+		fatal("Could not load node identity", "path", identityPath, "err", err)
+	}
+
+	store, err := openStorage(cfg.Storage)
+	if err != nil {
+		fatal("Could not open storage", "type", cfg.Storage.Type, "path", cfg.Storage.Path, "err", err)
+	}
+	if cfg.Storage.Type == storage.TypeMemory {
+		logger.Warn("The chain is kept in memory and lost when the node stops")
 	}
-	defer storage.Close()
 
-	blockchain := chain.InitBlockchain(5, 5, 5, storage)
-	node := p2p.NewNode(*listenAddress, strings.Split(*peers, ","))
+	bus := events.NewBus(cfg.API.EventHistory)
+	blockchain, err := chain.InitBlockchain(params, store)
+	if err != nil {
+		fatal("Could not initialize blockchain", "err", err)
+	}
+	blockchain.Events = bus
+	logger.Info("Using chain parameters", "chain", params.Name, "genesis", blockchain.GenesisHash(), "difficulty", params.Difficulty, "maxBlockSize", params.MaxBlockSize, "miningReward", params.MiningReward)
+	node := p2p.NewNode(cfg.P2P.Address, cfg.P2P.Peers, identity)
+	node.Events = bus
+	node.Limits.MaxInbound = cfg.P2P.MaxInbound
+	node.Limits.MaxOutbound = cfg.P2P.MaxOutbound
+	node.Limits.MaxMessageSize = cfg.P2P.MaxMessageSize
+	node.Limits.MessageRate = cfg.P2P.MessageRate
+	node.Limits.ByteRate = cfg.P2P.ByteRate
+	node.Limits.ReadTimeout = time.Duration(cfg.P2P.ReadTimeout)
+	node.Limits.WriteTimeout = time.Duration(cfg.P2P.WriteTimeout)
+	node.Limits.MaxViolations = cfg.P2P.MaxViolations
+	node.Limits.BanDuration = time.Duration(cfg.P2P.BanDuration)
+	node.Limits.ViolationDecay = time.Duration(cfg.P2P.ViolationDecay)
 	handler := api.Handler{
-		Blockchain:     blockchain,
-		Node:           node,
-		MiningStatuses: make(map[uuid.UUID]api.MineStatusResponse),
+		Blockchain:   blockchain,
+		Node:         node,
+		Events:       bus,
+		MiningJobs:   store,
+		MiningJobTTL: time.Duration(cfg.Mining.JobTTL),
+		Storage:      store,
+		Readiness:    api.Readiness{MaxLag: cfg.API.ReadyMaxLag, MinPeers: cfg.API.ReadyMinPeers},
+		Version:      version,
+		NetworkID:    cfg.Network.ID,
+		StartedAt:    time.Now(),
+	}
+	err = handler.FailInterruptedMiningJobs()
+	if err != nil {
+		logger.Error("Could not fail interrupted mining jobs", "err", err)
+	}
+	go func() {
+		err := node.StartServer(ctx, blockchain)
+		if err != nil {
+			fatal("Could not start p2p server", "address", cfg.P2P.Address, "err", err)
+		}
+	}()
+
+	for _, peer := range node.KnownPeers() {
+		go node.ConnectToPeer(peer, blockchain)
 	}
-	go node.StartServer(blockchain)
 
-	for peer, ok := range node.Peers {
-		if ok && peer != "" {
-			go node.ConnectToPeer(peer, blockchain)
+	var discovery *p2p.Discovery
+	if cfg.P2P.Discover {
+		discovery = p2p.NewDiscovery(node, cfg.Network.ID)
+		discovery.Group = cfg.P2P.DiscoveryGroup
+		err := discovery.Start(blockchain)
+		if err != nil {
+			fatal("Could not start peer discovery", "err", err)
+		}
+	}
+
+	var apiKeys []api.APIKey
+	if cfg.API.Keys != "" {
+		apiKeys, err = api.LoadAPIKeys(cfg.API.Keys)
+		if err != nil {
+			fatal("Could not load API keys", "path", cfg.API.Keys, "err", err)
+		}
+	}
+	// Without keys the API is only fit for local use and stays open as before
+	role := api.RoleAdmin
+	if len(apiKeys) > 0 {
+		role = api.RolePublic
+	}
+	if cfg.API.AnonymousRole != "" {
+		role, err = api.ParseRole(cfg.API.AnonymousRole)
+		if err != nil {
+			fatal("Invalid anonymous role", "err", err)
 		}
 	}
+	if role > api.RolePublic {
+		logger.Warn("API clients without a key have elevated rights", "role", role.String())
+	}
+	auth, err := api.NewAuth(apiKeys, role)
+	if err != nil {
+		fatal("Invalid API keys", "err", err)
+	}
 
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("POST /blockchain/mine", handler.MineBlock)
+	mux.HandleFunc("GET /healthz", handler.GetHealth)
 
-	mux.HandleFunc("GET /blockchain/mine/{id}", handler.GetMiningStatus)
+	mux.HandleFunc("GET /readyz", handler.GetReadiness)
+
+	mux.HandleFunc("GET /info", handler.GetInfo)
 
-	mux.HandleFunc("POST /transactions", handler.PostTransaction)
+	mux.HandleFunc("POST /blockchain/mine", api.Require(api.RoleMiner, handler.MineBlock))
 
-	mux.HandleFunc("OPTIONS /transactions", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	mux.HandleFunc("GET /blockchain/mine", handler.GetMiningJobs)
+
+	mux.HandleFunc("GET /blockchain/mine/{id}", handler.GetMiningStatus)
+
+	mux.HandleFunc("POST /transactions", api.Require(api.RoleSubmitter, handler.PostTransaction))
 
 	mux.HandleFunc("GET /transactions/pool/", handler.GetTransactionPool)
 
 	mux.HandleFunc("GET /blocks/pool/", handler.GetBlocksPool)
 
+	mux.HandleFunc("GET /blocks", handler.GetLatestBlocks)
+
+	mux.HandleFunc("GET /blocks/height/{height}", handler.GetBlockByHeight)
+
+	mux.HandleFunc("GET /blocks/hash/{hash}", handler.GetBlockByHash)
+
+	mux.HandleFunc("GET /transactions/{id}", handler.GetTransaction)
+
+	mux.HandleFunc("GET /address/transactions", handler.GetAddressTransactions)
+
+	mux.HandleFunc("GET /address/balance", handler.GetAddressBalance)
+
+	mux.HandleFunc("GET /events", handler.StreamEvents)
+
+	mux.HandleFunc("POST /rpc", handler.RPC)
+
+	mux.HandleFunc("GET /admin/node", api.Require(api.RoleAdmin, handler.GetNodeInfo))
+
+	mux.HandleFunc("GET /admin/peers", api.Require(api.RoleAdmin, handler.GetPeers))
+
+	mux.HandleFunc("POST /admin/peers", api.Require(api.RoleAdmin, handler.ConnectPeer))
+
+	mux.HandleFunc("DELETE /admin/peers/{id}", api.Require(api.RoleAdmin, handler.DisconnectPeer))
+
+	mux.HandleFunc("POST /admin/peers/{id}/ban", api.Require(api.RoleAdmin, handler.BanPeer))
+
+	mux.HandleFunc("GET /admin/bans", api.Require(api.RoleAdmin, handler.GetBans))
+
+	mux.HandleFunc("DELETE /admin/bans/{id}", api.Require(api.RoleAdmin, handler.UnbanPeer))
+
+	mux.HandleFunc("POST /admin/sync", api.Require(api.RoleAdmin, handler.Resync))
+
+	mux.HandleFunc("POST /admin/blocks/pause", api.Require(api.RoleAdmin, handler.PauseBlocks))
+
+	mux.HandleFunc("POST /admin/blocks/resume", api.Require(api.RoleAdmin, handler.ResumeBlocks))
+
+	metrics.Default.OnScrape(blockchain.CollectMetrics)
+	metrics.Default.OnScrape(node.CollectMetrics)
+	if badger, ok := store.(*storage.Storage); ok {
+		metrics.Default.OnScrape(badger.CollectMetrics)
+	}
+	mux.Handle("GET /metrics", metrics.Default)
+
 	mux.Handle("GET /swagger/", httpSwagger.Handler(
 		httpSwagger.URL("/swagger/doc.json"),
 		httpSwagger.UIConfig(map[string]string{
@@ -100,15 +300,18 @@ func main() {
 	))
 
 	server := http.Server{
-		Addr:    *httpAddress,
-		Handler: api.SetCORSHeaders(mux),
+		Addr:    cfg.API.Address,
+		Handler: api.CORS{AllowedOrigins: cfg.API.CORSOrigins}.Handler(auth.Authenticate(api.Instrument(mux))),
+		// Requests are canceled on shutdown, so event streams end
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
 
 	go func() {
+		logger.Info("HTTP server started", "address", cfg.API.Address)
 		err := server.ListenAndServe()
 		if err != nil {
 			if !errors.Is(err, http.ErrServerClosed) {
-				panic(err)
+				fatal("HTTP server failed", "address", cfg.API.Address, "err", err)
 			}
 		}
 	}()
@@ -119,18 +322,20 @@ func main() {
 			fmt.Print("Enter message to broadcast (transaction/block): ")
 			msg, err := stdReader.ReadString('\n')
 			if err != nil {
-				fmt.Println("Error reading from stdin:", err)
+				logger.Info("Stopped reading messages from stdin", "err", err)
 				return
 			}
 			msg = strings.TrimSpace(msg)
 			switch msg {
 			case "transaction":
-				tx := chain.Transaction{
-					FromAddress:   "Alice",
-					ToAddress:     "Bob",
-					Amount:        5.00,
-					Timestamp:     int(time.Now().Unix()),
-					TransactionId: uuid.New().String(),
+				// Peers drop unsigned transactions, so throwaway wallets are used
+				sender, receiver := chain.Wallet{}, chain.Wallet{}
+				sender.KeyGen()
+				receiver.KeyGen()
+				tx, err := chain.NewTransaction(sender.PrivateKey, sender.PublicKey, receiver.PublicKey, 5.00)
+				if err != nil {
+					logger.Error("Could not create transaction", "err", err)
+					continue
 				}
 				node.BroadcastTransaction(tx)
 			case "block":
@@ -147,13 +352,37 @@ func main() {
 		}
 	}()
 
-	select {}
+	<-ctx.Done()
+	stop()
+	logger.Info("Shutting down", "timeout", cfg.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		logger.Warn("Could not stop HTTP server", "err", err)
+	}
+	err = handler.Shutdown(shutdownCtx)
+	if err != nil {
+		logger.Warn("Could not stop mining", "err", err)
+	}
+	if discovery != nil {
+		discovery.Stop()
+	}
+	node.Shutdown(shutdownCtx)
+	err = store.Shutdown(shutdownCtx)
+	if err != nil {
+		fatal("Could not close storage", "err", err)
+	}
+	logger.Info("Node stopped")
 }
 
 //nolint:all
 func test() {
 	w := new(chain.Wallet)
 	w.KeyGen()
+	receiver := new(chain.Wallet)
+	receiver.KeyGen()
 	fmt.Println("Successfully generate wallet keys!")
 	fmt.Print("\n\n")
 
@@ -163,62 +392,65 @@ func test() {
 	}
 	defer storage.Close()
 
-	blockchain := chain.InitBlockchain(5, 5, 5, storage)
+	blockchain, err := chain.InitBlockchain(chain.TestnetParams, storage)
+	if err != nil {
+		panic(err)
+	}
 	fmt.Println("Successfully initialized blockchain!")
 	fmt.Println("Blockchain is valid: ", blockchain.IsValid())
 	fmt.Print("\n\n")
 
-	fmt.Println("Balance of 0x123 before mining:", blockchain.GetBalance("0x123"))
+	fmt.Println("Balance of the receiver before mining:", blockchain.GetBalance(receiver.PublicKey))
 	fmt.Println("Adding transactions to the pool...")
 
-	t1, err := chain.NewTransaction(w.PrivateKey, w.PublicKey, "0x123", 5.0)
+	t1, err := chain.NewTransaction(w.PrivateKey, w.PublicKey, receiver.PublicKey, 5.0)
 	if err != nil {
 		fmt.Println("Error creating transaction:", err)
 		return
 	}
 	blockchain.AddTransactionToPool(t1)
 
-	t2, err := chain.NewTransaction(w.PrivateKey, w.PublicKey, "0x123", 5.0)
+	t2, err := chain.NewTransaction(w.PrivateKey, w.PublicKey, receiver.PublicKey, 5.0)
 	if err != nil {
 		fmt.Println("Error creating transaction:", err)
 		return
 	}
 	blockchain.AddTransactionToPool(t2)
 
-	t3, err := chain.NewTransaction(w.PrivateKey, w.PublicKey, "0x123", 5.0)
+	t3, err := chain.NewTransaction(w.PrivateKey, w.PublicKey, receiver.PublicKey, 5.0)
 	if err != nil {
 		fmt.Println("Error creating transaction:", err)
 		return
 	}
 	blockchain.AddTransactionToPool(t3)
 
-	t4, err := chain.NewTransaction(w.PrivateKey, w.PublicKey, "0x123", 5.0)
+	t4, err := chain.NewTransaction(w.PrivateKey, w.PublicKey, receiver.PublicKey, 5.0)
 	if err != nil {
 		fmt.Println("Error creating transaction:", err)
 		return
 	}
 	blockchain.AddTransactionToPool(t4)
 
-	t5, err := chain.NewTransaction(w.PrivateKey, w.PublicKey, "0x123", 5.0)
+	t5, err := chain.NewTransaction(w.PrivateKey, w.PublicKey, receiver.PublicKey, 5.0)
 	if err != nil {
 		fmt.Println("Error creating transaction:", err)
 		return
 	}
 	blockchain.AddTransactionToPool(t5)
 
-	fmt.Println("Length of pending transactions:", len(blockchain.PendingTransactions))
+	fmt.Println("Length of pending transactions:", len(blockchain.GetPendingTransactions()))
 	fmt.Print("\n\n")
 
 	fmt.Println("Mining...")
-	blockchain.MinePendingTransactions("0x123")
+	blockchain.MinePendingTransactions(receiver.PublicKey)
 	fmt.Println("Mining successful. New block added to the chain!")
 	fmt.Println("Blockchain is valid: ", blockchain.IsValid())
 	fmt.Print("\n\n")
 
-	fmt.Println("Balance of 0x123 after mining:", blockchain.GetBalance("0x123"))
+	fmt.Println("Balance of the receiver after mining:", blockchain.GetBalance(receiver.PublicKey))
 	fmt.Print("\n\n")
 
-	fmt.Println("Length of pending transactions after mining:", len(blockchain.PendingTransactions))
+	fmt.Println("Length of pending transactions after mining:", len(blockchain.GetPendingTransactions()))
 	fmt.Print("\n\n")
 
 	fmt.Println("Adding invalid block to the chain...")
@@ -235,43 +467,26 @@ func testPersistency() {
 	}
 	defer storage.Close()
 
-	blockchain := chain.InitBlockchain(5, 5, 5, storage)
-	fmt.Println(blockchain)
-	tx1 := chain.Transaction{
-		FromAddress:   "First",
-		ToAddress:     "Bob",
-		Amount:        5.00,
-		Timestamp:     int(time.Now().Unix()),
-		TransactionId: uuid.New().String(),
-	}
-	tx2 := chain.Transaction{
-		FromAddress:   "Second",
-		ToAddress:     "Bob",
-		Amount:        5.00,
-		Timestamp:     int(time.Now().Unix()),
-		TransactionId: uuid.New().String(),
+	blockchain, err := chain.InitBlockchain(chain.TestnetParams, storage)
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
+	fmt.Println(blockchain)
+	sender, bob := new(chain.Wallet), new(chain.Wallet)
+	sender.KeyGen()
+	bob.KeyGen()
+	tx1, _ := chain.NewTransaction(sender.PrivateKey, sender.PublicKey, bob.PublicKey, 5.00)
+	tx2, _ := chain.NewTransaction(sender.PrivateKey, sender.PublicKey, bob.PublicKey, 5.00)
 	blockchain.AddTransactionToPool(tx1)
 	blockchain.AddTransactionToPool(tx2)
 	blockchain.MinePendingTransactions("some_address")
-	tx3 := chain.Transaction{
-		FromAddress:   "Third",
-		ToAddress:     "Bob",
-		Amount:        5.00,
-		Timestamp:     int(time.Now().Unix()),
-		TransactionId: uuid.New().String(),
-	}
+	tx3, _ := chain.NewTransaction(sender.PrivateKey, sender.PublicKey, bob.PublicKey, 5.00)
 	blockchain.AddTransactionToPool(tx3)
 	blockchain.MinePendingTransactions("another_address")
 	PrettyPrintBlockchain(blockchain)
 
-	newChain := chain.Blockchain{Difficulty: 5, MaxBlockSize: 5, MiningReward: 5, Storage: storage}
-	genesisBlock := chain.Block{
-		Timestamp: time.Now().Unix(),
-	}
-	genesisBlock.MineBlock(blockchain.Difficulty)
-	newChain.AddBlock(genesisBlock)
-	newChain.Storage.AddBlock(genesisBlock)
+	genesisBlock, _ := chain.TestnetParams.Genesis.Block()
 	tx4 := chain.Transaction{
 		FromAddress:   "NEW ONE",
 		ToAddress:     "Bob",
@@ -279,9 +494,12 @@ func testPersistency() {
 		Timestamp:     int(time.Now().Unix()),
 		TransactionId: uuid.New().String(),
 	}
-	newChain.AddTransactionToPool(tx4)
-	newChain.MinePendingTransactions("NEW CHAIN ADDR")
-	storage.Reset(&newChain)
-	chain := chain.InitBlockchain(5, 5, 5, storage)
+	storage.Reset([]chain.Block{genesisBlock}, []chain.Transaction{tx4})
+	chain, err := chain.InitBlockchain(chain.TestnetParams, storage)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	chain.MinePendingTransactions("NEW CHAIN ADDR")
 	PrettyPrintBlockchain(chain)
 }
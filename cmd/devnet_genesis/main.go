@@ -0,0 +1,80 @@
+// Command devnet_genesis generates the genesis block of a development network
+// with funded wallets. It writes genesis.json, to be passed to the nodes with
+// -genesis, and wallets.json with the keys of the wallets.
+package main
+
+import (
+	"blockchain/chain"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fundedWallet is an entry of wallets.json.
+type fundedWallet struct {
+	Address    string  `json:"address"`
+	PrivateKey string  `json:"privateKey"`
+	Amount     float64 `json:"amount"`
+}
+
+func main() {
+	wallets := flag.Int("wallets", 5, "Number of funded wallets")
+	amount := flag.Float64("amount", 1000, "Balance of each wallet")
+	timestamp := flag.Int64("timestamp", time.Now().Unix(), "Timestamp of the genesis block in Unix seconds")
+	out := flag.String("out", ".", "Directory to write genesis.json and wallets.json to")
+	flag.Parse()
+
+	if *wallets < 1 || *amount <= 0 {
+		fmt.Fprintln(os.Stderr, "-wallets and -amount must be positive")
+		os.Exit(2)
+	}
+
+	genesis := chain.Genesis{Timestamp: *timestamp}
+	funded := make([]fundedWallet, 0, *wallets)
+	for i := 0; i < *wallets; i++ {
+		wallet := chain.Wallet{}
+		wallet.KeyGen()
+		if wallet.PrivateKey == "" || wallet.PublicKey == "" {
+			fmt.Fprintln(os.Stderr, "Could not generate wallet keys")
+			os.Exit(1)
+		}
+		genesis.Allocations = append(genesis.Allocations, chain.Allocation{Address: wallet.PublicKey, Amount: *amount})
+		funded = append(funded, fundedWallet{Address: wallet.PublicKey, PrivateKey: wallet.PrivateKey, Amount: *amount})
+	}
+	block, err := genesis.Block()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not build genesis block:", err)
+		os.Exit(1)
+	}
+	genesis.Hash = block.Hash
+
+	err = os.MkdirAll(*out, 0o755)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	err = writeJSON(filepath.Join(*out, "genesis.json"), genesis, 0o644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// The private keys give access to the funds, only the owner may read them
+	err = writeJSON(filepath.Join(*out, "wallets.json"), funded, 0o600)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Genesis block %s funds %d wallets with %v each\n", genesis.Hash, *wallets, *amount)
+	fmt.Println("Start the nodes with -genesis", filepath.Join(*out, "genesis.json"))
+}
+
+func writeJSON(path string, value any, perm os.FileMode) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), perm)
+}
@@ -0,0 +1,257 @@
+// Package config holds the settings of a node. They are read from a JSON file,
+// then overridden by BLOCKCHAIN_* environment variables and finally by the
+// command line flags that were set explicitly.
+package config
+
+import (
+	"blockchain/chain"
+	"blockchain/logging"
+	"blockchain/p2p"
+	"blockchain/storage"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Network Network `json:"network"`
+	P2P     P2P     `json:"p2p"`
+	API     API     `json:"api"`
+	Mining  Mining  `json:"mining"`
+	Storage Storage `json:"storage"`
+	Logging Logging `json:"logging"`
+	// ShutdownTimeout bounds how long the node waits for its parts to stop
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+}
+
+type Network struct {
+	// ID is announced during discovery and reported by /info
+	ID string `json:"id"`
+	// Chain is the preset of the chain parameters: mainnet, testnet or regtest
+	Chain string `json:"chain"`
+	// Params override single parameters of the preset
+	Params ParamsOverrides `json:"params"`
+	// Genesis is the path of a JSON file with the genesis block of the network,
+	// replacing the one of the preset
+	Genesis string `json:"genesis"`
+	// Premine is the path of a JSON file with the balances addresses start with,
+	// replacing the allocations of the genesis block
+	Premine string `json:"premine"`
+}
+
+type ParamsOverrides struct {
+	Difficulty   *int     `json:"difficulty"`
+	MaxBlockSize *int     `json:"maxBlockSize"`
+	MiningReward *float64 `json:"miningReward"`
+}
+
+type P2P struct {
+	Address string `json:"address"`
+	Peers   List   `json:"peers"`
+	// Identity is the path of the node identity key, <storage path>.key if empty
+	Identity       string `json:"identity"`
+	MaxInbound     int    `json:"maxInbound"`
+	MaxOutbound    int    `json:"maxOutbound"`
+	MaxMessageSize int    `json:"maxMessageSize"`
+	// MessageRate and ByteRate limit what a peer may send per second
+	MessageRate  float64  `json:"messageRate"`
+	ByteRate     float64  `json:"byteRate"`
+	ReadTimeout  Duration `json:"readTimeout"`
+	WriteTimeout Duration `json:"writeTimeout"`
+	// A peer is banned for BanDuration once its violations reach MaxViolations,
+	// one violation is forgiven per ViolationDecay
+	MaxViolations  int      `json:"maxViolations"`
+	BanDuration    Duration `json:"banDuration"`
+	ViolationDecay Duration `json:"violationDecay"`
+	Discover       bool     `json:"discover"`
+	DiscoveryGroup string   `json:"discoveryGroup"`
+}
+
+type API struct {
+	Address string `json:"address"`
+	// Keys is the path of a JSON file with the API keys and their roles
+	Keys string `json:"keys"`
+	// AnonymousRole is admin without keys and public with them if empty
+	AnonymousRole string `json:"anonymousRole"`
+	CORSOrigins   List   `json:"corsOrigins"`
+	EventHistory  int    `json:"eventHistory"`
+	ReadyMaxLag   int    `json:"readyMaxLag"`
+	ReadyMinPeers int    `json:"readyMinPeers"`
+}
+
+type Mining struct {
+	JobTTL Duration `json:"jobTTL"`
+}
+
+type Storage struct {
+	// Type is badger, which keeps the chain at Path, or memory
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+type Logging struct {
+	Format string `json:"format"`
+	Level  string `json:"level"`
+}
+
+// Default returns the settings of a node without a config file.
+func Default() Config {
+	limits := p2p.DefaultLimits()
+	return Config{
+		Network: Network{
+			ID:    "devnet",
+			Chain: chain.TestnetParams.Name,
+		},
+		P2P: P2P{
+			Address:        "localhost:8080",
+			MaxInbound:     limits.MaxInbound,
+			MaxOutbound:    limits.MaxOutbound,
+			MaxMessageSize: limits.MaxMessageSize,
+			MessageRate:    limits.MessageRate,
+			ByteRate:       limits.ByteRate,
+			ReadTimeout:    Duration(limits.ReadTimeout),
+			WriteTimeout:   Duration(limits.WriteTimeout),
+			MaxViolations:  limits.MaxViolations,
+			BanDuration:    Duration(limits.BanDuration),
+			ViolationDecay: Duration(limits.ViolationDecay),
+			DiscoveryGroup: p2p.DefaultDiscoveryGroup,
+		},
+		API: API{
+			Address:       "localhost:8090",
+			CORSOrigins:   List{"http://localhost:3000", "http://127.0.0.1:3000"},
+			EventHistory:  1024,
+			ReadyMaxLag:   2,
+			ReadyMinPeers: 1,
+		},
+		Mining: Mining{
+			JobTTL: Duration(24 * time.Hour),
+		},
+		Storage: Storage{
+			Type: storage.TypeBadger,
+			Path: "chain_storage",
+		},
+		Logging: Logging{
+			Format: logging.FormatText,
+			Level:  "info",
+		},
+		ShutdownTimeout: Duration(10 * time.Second),
+	}
+}
+
+// Load returns the defaults overridden by the file at path, if path is not
+// empty, and by the environment.
+func Load(path string) (Config, error) {
+	config := Default()
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return Config{}, err
+		}
+		defer file.Close()
+		decoder := json.NewDecoder(file)
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&config)
+		if err != nil {
+			return Config{}, fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+	err := ApplyEnv(&config, os.Environ())
+	if err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// ChainParams returns the preset of the network with its overrides, genesis and
+// premine.
+func (network Network) ChainParams() (chain.ChainParams, error) {
+	params, err := chain.ParamsByName(network.Chain)
+	if err != nil {
+		return chain.ChainParams{}, err
+	}
+	overrides := network.Params
+	if overrides.Difficulty != nil {
+		params.Difficulty = *overrides.Difficulty
+	}
+	if overrides.MaxBlockSize != nil {
+		params.MaxBlockSize = *overrides.MaxBlockSize
+	}
+	if overrides.MiningReward != nil {
+		params.MiningReward = *overrides.MiningReward
+	}
+	if network.Genesis != "" {
+		params.Genesis, err = chain.LoadGenesis(network.Genesis)
+		if err != nil {
+			return chain.ChainParams{}, err
+		}
+	}
+	if network.Premine != "" {
+		allocations, err := chain.LoadAllocations(network.Premine)
+		if err != nil {
+			return chain.ChainParams{}, err
+		}
+		params.Genesis = params.Genesis.WithAllocations(allocations)
+	}
+	err = params.Validate()
+	if err != nil {
+		return chain.ChainParams{}, fmt.Errorf("chain %s: %w", params.Name, err)
+	}
+	return params, nil
+}
+
+// Duration is a time.Duration written like "90s" or "24h".
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) Set(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
+// List is a list of strings, written as an array in files and comma-separated
+// in the environment and flags.
+type List []string
+
+func (list List) String() string {
+	return strings.Join(list, ",")
+}
+
+func (list *List) Set(value string) error {
+	*list = nil
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			*list = append(*list, item)
+		}
+	}
+	return nil
+}
+
+func (list *List) UnmarshalText(text []byte) error {
+	return list.Set(string(text))
+}
+
+func (list *List) UnmarshalJSON(data []byte) error {
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		return list.Set(text)
+	}
+	return json.Unmarshal(data, (*[]string)(list))
+}
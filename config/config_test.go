@@ -0,0 +1,119 @@
+package config_test
+
+import (
+	"blockchain/config"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file with content and returns its path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestPrecedence checks that the file overrides the defaults, the environment
+// the file and the flags that were set the environment.
+func TestPrecedence(t *testing.T) {
+	path := writeConfig(t, `{
+		"network": {"params": {"difficulty": 3}},
+		"p2p": {"maxInbound": 10, "maxOutbound": 11, "peers": ["file:1"], "banDuration": "2h"},
+		"api": {"address": "file:8090"},
+		"mining": {"jobTTL": "1h"},
+		"logging": {"level": "debug"}
+	}`)
+	t.Setenv("BLOCKCHAIN_P2P_MAX_INBOUND", "20")
+	t.Setenv("BLOCKCHAIN_P2P_PEERS", "env:1, env:2")
+	t.Setenv("BLOCKCHAIN_MINING_JOB_TTL", "2h")
+	t.Setenv("BLOCKCHAIN_P2P_BYTE_RATE", "1.5")
+	t.Setenv("OTHER_P2P_MAX_OUTBOUND", "99")
+
+	set := flag.NewFlagSet("node", flag.ContinueOnError)
+	flagValues := config.Default()
+	config.RegisterFlags(set, &flagValues)
+	err := set.Parse([]string{"-max-inbound", "30", "-log-level", "warn,p2p=debug", "-ban-duration", "5m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ApplyFlags(set, &flagValues, &cfg)
+
+	defaults := config.Default()
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"default", cfg.Storage.Path, defaults.Storage.Path},
+		{"file", cfg.API.Address, "file:8090"},
+		{"file", cfg.P2P.MaxOutbound, 11},
+		{"file", *cfg.Network.Params.Difficulty, 3},
+		{"env over file", cfg.P2P.Peers, config.List{"env:1", "env:2"}},
+		{"env over file", cfg.Mining.JobTTL, config.Duration(2 * time.Hour)},
+		{"env over default", cfg.P2P.ByteRate, 1.5},
+		{"flag over env", cfg.P2P.MaxInbound, 30},
+		{"flag over file", cfg.Logging.Level, "warn,p2p=debug"},
+		{"flag over file", cfg.P2P.BanDuration, config.Duration(5 * time.Minute)},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     string
+	}{
+		{"unknown field", `{"p2p": {"maxPeers": 3}}`, ""},
+		{"invalid duration", `{"shutdownTimeout": "soon"}`, ""},
+		{"invalid JSON", `{"p2p": `, ""},
+		{"invalid env", `{}`, "many"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.env != "" {
+				t.Setenv("BLOCKCHAIN_P2P_MAX_INBOUND", test.env)
+			}
+			_, err := config.Load(writeConfig(t, test.content))
+			if err == nil {
+				t.Fatal("no error")
+			}
+		})
+	}
+	_, err := config.Load(filepath.Join(t.TempDir(), "missing.json"))
+	if err == nil {
+		t.Fatal("loading a missing file: no error")
+	}
+}
+
+func TestChainParams(t *testing.T) {
+	difficulty, reward := 2, 12.5
+	network := config.Network{Chain: "regtest", Params: config.ParamsOverrides{Difficulty: &difficulty, MiningReward: &reward}}
+	params, err := network.ChainParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Name != "regtest" || params.Difficulty != 2 || params.MiningReward != 12.5 {
+		t.Fatalf("params are %+v", params)
+	}
+
+	_, err = config.Network{Chain: "moonnet"}.ChainParams()
+	if err == nil {
+		t.Fatal("unknown chain: no error")
+	}
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix starts the environment variables of the settings. The variable of a
+// setting is named after its section and field in the file, for example
+// BLOCKCHAIN_P2P_MAX_INBOUND for "maxInbound" in "p2p".
+const EnvPrefix = "BLOCKCHAIN"
+
+// ApplyEnv overrides config with the variables of environ, given as key=value
+// pairs like those of os.Environ.
+func ApplyEnv(config *Config, environ []string) error {
+	env := make(map[string]string)
+	for _, pair := range environ {
+		key, value, found := strings.Cut(pair, "=")
+		if found && strings.HasPrefix(key, EnvPrefix+"_") {
+			env[key] = value
+		}
+	}
+	return applyEnv(reflect.ValueOf(config).Elem(), EnvPrefix, env)
+}
+
+func applyEnv(value reflect.Value, prefix string, env map[string]string) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		key := prefix + "_" + envName(name)
+		if field.Type.Kind() == reflect.Struct {
+			err := applyEnv(value.Field(i), key, env)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		text, ok := env[key]
+		if !ok {
+			continue
+		}
+		err := setValue(value.Field(i), text)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// envName turns a field name like "maxInbound" into "MAX_INBOUND".
+func envName(name string) string {
+	var builder strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			builder.WriteByte('_')
+		}
+		builder.WriteRune(unicode.ToUpper(r))
+	}
+	return builder.String()
+}
+
+func setValue(value reflect.Value, text string) error {
+	if value.Kind() == reflect.Pointer {
+		target := reflect.New(value.Type().Elem())
+		err := setValue(target.Elem(), text)
+		if err != nil {
+			return err
+		}
+		value.Set(target)
+		return nil
+	}
+	if unmarshaler, ok := value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(text))
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(text)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return err
+		}
+		value.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"flag"
+	"reflect"
+)
+
+// flags are the command line flags of the settings, field returns the setting
+// of a flag within a Config.
+var flags = []struct {
+	name  string
+	usage string
+	field func(*Config) any
+}{
+	{"chain", "Chain parameters preset: mainnet, testnet or regtest", func(c *Config) any { return &c.Network.Chain }},
+	{"genesis", "Path to a JSON file with the genesis block, replacing the one of the -chain preset", func(c *Config) any { return &c.Network.Genesis }},
+	{"premine", "Path to a JSON file with the balances addresses start with in the genesis block", func(c *Config) any { return &c.Network.Premine }},
+	{"network-id", "Network ID, announced during discovery and reported by /info", func(c *Config) any { return &c.Network.ID }},
+	{"address", "Address to listen on for peers", func(c *Config) any { return &c.P2P.Address }},
+	{"peers", "Comma-separated list of peers to connect to", func(c *Config) any { return &c.P2P.Peers }},
+	{"identity", "Path to the node identity key (default <storage>.key)", func(c *Config) any { return &c.P2P.Identity }},
+	{"max-inbound", "Maximum number of inbound peers", func(c *Config) any { return &c.P2P.MaxInbound }},
+	{"max-outbound", "Maximum number of outbound peers", func(c *Config) any { return &c.P2P.MaxOutbound }},
+	{"max-message-size", "Maximum size of a p2p message in bytes", func(c *Config) any { return &c.P2P.MaxMessageSize }},
+	{"message-rate", "Messages a peer may send per second, 0 for no limit", func(c *Config) any { return &c.P2P.MessageRate }},
+	{"byte-rate", "Bytes a peer may send per second, 0 for no limit", func(c *Config) any { return &c.P2P.ByteRate }},
+	{"read-timeout", "How long a peer may stay silent before it is disconnected", func(c *Config) any { return &c.P2P.ReadTimeout }},
+	{"write-timeout", "How long sending a message to a peer may take", func(c *Config) any { return &c.P2P.WriteTimeout }},
+	{"max-violations", "Violations after which a peer is banned, 0 to never ban", func(c *Config) any { return &c.P2P.MaxViolations }},
+	{"ban-duration", "How long a misbehaving peer is banned", func(c *Config) any { return &c.P2P.BanDuration }},
+	{"violation-decay", "Interval after which one violation of a peer is forgiven, 0 to keep them", func(c *Config) any { return &c.P2P.ViolationDecay }},
+	{"discover", "Discover peers on the local network over UDP multicast", func(c *Config) any { return &c.P2P.Discover }},
+	{"discovery-group", "Multicast group used for discovery", func(c *Config) any { return &c.P2P.DiscoveryGroup }},
+	{"http", "Address to serve the HTTP API on", func(c *Config) any { return &c.API.Address }},
+	{"api-keys", "Path to a JSON file with the API keys and their roles", func(c *Config) any { return &c.API.Keys }},
+	{"anonymous-role", "Role of API clients without a key: public, submitter, miner or admin (default admin without -api-keys, public with them)", func(c *Config) any { return &c.API.AnonymousRole }},
+	{"cors-origins", "Comma-separated origins allowed to call the API from a browser, * for any", func(c *Config) any { return &c.API.CORSOrigins }},
+	{"event-history", "Number of recent events kept for clients resuming an event stream", func(c *Config) any { return &c.API.EventHistory }},
+	{"ready-max-lag", "Blocks the node may be behind the best peer tip to be ready", func(c *Config) any { return &c.API.ReadyMaxLag }},
+	{"ready-min-peers", "Peers the node needs to be ready", func(c *Config) any { return &c.API.ReadyMinPeers }},
+	{"mining-job-ttl", "How long mining jobs are kept", func(c *Config) any { return &c.Mining.JobTTL }},
+	{"storage", "Badger storage name", func(c *Config) any { return &c.Storage.Path }},
+	{"storage-type", "Storage of the chain: badger, or memory to lose it on exit", func(c *Config) any { return &c.Storage.Type }},
+	{"log-format", "Log format: text or json", func(c *Config) any { return &c.Logging.Format }},
+	{"log-level", "Log level, optionally per subsystem (node, chain, storage, p2p, api), e.g. info,p2p=debug", func(c *Config) any { return &c.Logging.Level }},
+	{"shutdown-timeout", "How long the node waits for its parts to stop on SIGINT or SIGTERM", func(c *Config) any { return &c.ShutdownTimeout }},
+}
+
+// RegisterFlags defines the flags of the settings on set, they are parsed into
+// config and its values are shown as their defaults.
+func RegisterFlags(set *flag.FlagSet, config *Config) {
+	for _, f := range flags {
+		switch field := f.field(config).(type) {
+		case *string:
+			set.StringVar(field, f.name, *field, f.usage)
+		case *int:
+			set.IntVar(field, f.name, *field, f.usage)
+		case *float64:
+			set.Float64Var(field, f.name, *field, f.usage)
+		case *bool:
+			set.BoolVar(field, f.name, *field, f.usage)
+		case flag.Value:
+			set.Var(field, f.name, f.usage)
+		}
+	}
+}
+
+// ApplyFlags copies the settings of the flags that were set on set from parsed,
+// the Config given to RegisterFlags, to config.
+func ApplyFlags(set *flag.FlagSet, parsed, config *Config) {
+	for _, f := range flags {
+		if isSet(set, f.name) {
+			reflect.ValueOf(f.field(config)).Elem().Set(reflect.ValueOf(f.field(parsed)).Elem())
+		}
+	}
+}
+
+func isSet(set *flag.FlagSet, name string) bool {
+	found := false
+	set.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
@@ -0,0 +1,164 @@
+// Package events is the in-process event bus of a node. The chain, the p2p node
+// and the API publish to it, and subscribers such as the SSE endpoint receive the
+// events of the topics they are interested in.
+package events
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TipChanged          = "tip"
+	BlockConnected      = "block.connected"
+	BlockDisconnected   = "block.disconnected"
+	TransactionAccepted = "transaction.accepted"
+	TransactionEvicted  = "transaction.evicted"
+	PeerConnected       = "peer.connected"
+	PeerDisconnected    = "peer.disconnected"
+	MiningStatus        = "mining.status"
+)
+
+// Reasons a transaction leaves the pool.
+const (
+	EvictedMined = "mined"
+)
+
+type Event struct {
+	ID   uint64    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+type Block struct {
+	Hash             string `json:"hash"`
+	Height           int    `json:"height"`
+	TransactionCount int    `json:"transactionCount"`
+}
+
+type Tip struct {
+	Hash   string `json:"hash"`
+	Height int    `json:"height"`
+}
+
+type Eviction struct {
+	TransactionId string `json:"transactionId"`
+	Reason        string `json:"reason"`
+}
+
+type Peer struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Inbound bool   `json:"inbound"`
+}
+
+// subscriptionBuffer is the number of events a subscriber can lag behind before
+// it is dropped. A dropped subscriber can resume from the last event it received.
+const subscriptionBuffer = 256
+
+// Bus delivers events to subscribers without ever blocking the publisher and
+// keeps the most recent ones so subscribers can resume after reconnecting. A nil
+// Bus discards everything published to it.
+type Bus struct {
+	HistorySize int
+
+	mutex         sync.Mutex
+	lastID        uint64
+	history       []Event
+	subscriptions map[*Subscription]bool
+}
+
+func NewBus(historySize int) *Bus {
+	return &Bus{HistorySize: historySize, subscriptions: make(map[*Subscription]bool)}
+}
+
+// Subscription receives the events of its topics on Events until it is closed,
+// either by Close or by the bus when the subscriber falls too far behind.
+type Subscription struct {
+	Events <-chan Event
+
+	bus    *Bus
+	topics []string
+	events chan Event
+}
+
+func (bus *Bus) Publish(eventType string, data any) {
+	if bus == nil {
+		return
+	}
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	bus.lastID++
+	event := Event{ID: bus.lastID, Type: eventType, Time: time.Now(), Data: data}
+	if bus.HistorySize > 0 {
+		if len(bus.history) >= bus.HistorySize {
+			bus.history = append(bus.history[:0], bus.history[len(bus.history)-bus.HistorySize+1:]...)
+		}
+		bus.history = append(bus.history, event)
+	}
+	for subscription := range bus.subscriptions {
+		if !Matches(subscription.topics, eventType) {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			bus.unsubscribe(subscription)
+		}
+	}
+}
+
+// Subscribe starts delivering the events of topics, all events if topics is empty.
+// With resume set, the kept events after lastID are returned to be sent first;
+// events older than the history are lost.
+func (bus *Bus) Subscribe(topics []string, lastID uint64, resume bool) (*Subscription, []Event) {
+	events := make(chan Event, subscriptionBuffer)
+	subscription := &Subscription{Events: events, bus: bus, topics: topics, events: events}
+
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	var missed []Event
+	if resume {
+		for _, event := range bus.history {
+			if event.ID > lastID && Matches(topics, event.Type) {
+				missed = append(missed, event)
+			}
+		}
+	}
+	bus.subscriptions[subscription] = true
+	return subscription, missed
+}
+
+func (subscription *Subscription) Close() {
+	bus := subscription.bus
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	bus.unsubscribe(subscription)
+}
+
+// unsubscribe must be called with mutex held.
+func (bus *Bus) unsubscribe(subscription *Subscription) {
+	if bus.subscriptions[subscription] {
+		delete(bus.subscriptions, subscription)
+		close(subscription.events)
+	}
+}
+
+// Matches reports whether eventType is one of topics or belongs to one of them,
+// "block" matches both "block.connected" and "block.disconnected".
+func Matches(topics []string, eventType string) bool {
+	if len(topics) == 0 {
+		return true
+	}
+	for _, topic := range topics {
+		if topic == eventType || strings.HasPrefix(eventType, topic+".") {
+			return true
+		}
+	}
+	return false
+}
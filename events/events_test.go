@@ -0,0 +1,113 @@
+package events_test
+
+import (
+	"blockchain/events"
+	"reflect"
+	"testing"
+)
+
+func ids(list []events.Event) []uint64 {
+	ids := []uint64{}
+	for _, event := range list {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestResume(t *testing.T) {
+	bus := events.NewBus(3)
+	published := []string{events.TipChanged, events.BlockConnected, events.TransactionAccepted, events.BlockDisconnected, events.TipChanged}
+	for _, eventType := range published {
+		bus.Publish(eventType, nil)
+	}
+
+	tests := []struct {
+		name   string
+		topics []string
+		lastID uint64
+		resume bool
+		want   []uint64
+	}{
+		{"new subscriber", nil, 0, false, []uint64{}},
+		// Events 1 and 2 are older than the history
+		{"from the start", nil, 0, true, []uint64{3, 4, 5}},
+		{"after an event", nil, 3, true, []uint64{4, 5}},
+		{"up to date", nil, 5, true, []uint64{}},
+		{"topic prefix", []string{"block"}, 0, true, []uint64{4}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subscription, missed := bus.Subscribe(test.topics, test.lastID, test.resume)
+			defer subscription.Close()
+			if got := ids(missed); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("missed events %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	// The events published after subscribing follow the missed ones
+	subscription, _ := bus.Subscribe([]string{events.TipChanged}, 5, true)
+	defer subscription.Close()
+	bus.Publish(events.BlockConnected, nil)
+	bus.Publish(events.TipChanged, events.Tip{Hash: "tip", Height: 1})
+	event := <-subscription.Events
+	if event.ID != 7 || event.Type != events.TipChanged || event.Data != (events.Tip{Hash: "tip", Height: 1}) {
+		t.Fatalf("received %+v, want the tip event 7", event)
+	}
+}
+
+// TestSlowSubscriber checks that a subscriber that stops reading is dropped
+// instead of blocking the publisher, and that others keep receiving events.
+func TestSlowSubscriber(t *testing.T) {
+	bus := events.NewBus(0)
+	slow, _ := bus.Subscribe(nil, 0, false)
+	fast, _ := bus.Subscribe(nil, 0, false)
+	defer fast.Close()
+
+	const published = 1000
+	received := 0
+	for i := 0; i < published; i++ {
+		bus.Publish(events.TipChanged, nil)
+		<-fast.Events
+		received++
+	}
+	if received != published {
+		t.Fatalf("fast subscriber received %d events, want %d", received, published)
+	}
+
+	buffered := 0
+	for range slow.Events {
+		buffered++
+	}
+	if buffered == 0 || buffered >= published {
+		t.Fatalf("slow subscriber received %d events before it was dropped", buffered)
+	}
+	// Closing a dropped subscription does nothing
+	slow.Close()
+}
+
+func TestNilBus(t *testing.T) {
+	var bus *events.Bus
+	bus.Publish(events.TipChanged, nil)
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		topics    []string
+		eventType string
+		want      bool
+	}{
+		{nil, events.PeerConnected, true},
+		{[]string{"block"}, events.BlockConnected, true},
+		{[]string{"block"}, events.TipChanged, false},
+		{[]string{"tip", "peer"}, events.PeerDisconnected, true},
+		// Prefixes only match whole parts of the type
+		{[]string{"bl"}, events.BlockConnected, false},
+		{[]string{events.BlockConnected}, events.BlockDisconnected, false},
+	}
+	for _, test := range tests {
+		if got := events.Matches(test.topics, test.eventType); got != test.want {
+			t.Errorf("Matches(%v, %s) = %v, want %v", test.topics, test.eventType, got, test.want)
+		}
+	}
+}
@@ -1,40 +1,103 @@
-import { Box, Flex, Text } from "@chakra-ui/react";
+import { Box, Button, Flex, Text } from "@chakra-ui/react";
 import BlocksTable, { BlockProps } from "./BlocksTable";
 import CenteredSpinner from "./CenteredSpinner";
 import ErrorAlert from "./ErrorAlert";
-import { useQuery } from "@tanstack/react-query";
+import { keepPreviousData, useQuery } from "@tanstack/react-query";
 import axiosInstance from "./axiosConfig";
 import MineBlockButton from "./MineBlockButton";
+import { useEffect, useState } from "react";
+
+const PAGE_SIZE = 20;
 
 interface Blockchain {
-  blocks: BlockProps[];
   maxBlockSize: number;
   miningReward: number;
 }
 
+interface BlocksResponse {
+  blocks: { block: BlockProps; height: number }[];
+  total: number;
+  offset: number;
+  limit: number;
+}
+
 async function fetchBlockchain(): Promise<Blockchain> {
   return await axiosInstance.get("/blocks/pool/").then((res) => res.data);
 }
 
+// The node keeps the chain in storage, so blocks are listed a page at a time,
+// newest first
+async function fetchBlocks(offset: number): Promise<BlocksResponse> {
+  return await axiosInstance
+    .get("/blocks", { params: { offset, limit: PAGE_SIZE } })
+    .then((res) => res.data);
+}
+
 export default function BlocksPage() {
-  const { isPending, error, data, refetch } = useQuery({
+  const [offset, setOffset] = useState(0);
+  const chain = useQuery({
     queryKey: ["blockchain"],
     queryFn: fetchBlockchain,
   });
+  const blocks = useQuery({
+    queryKey: ["blocks", offset],
+    queryFn: () => fetchBlocks(offset),
+    placeholderData: keepPreviousData,
+  });
+  const refetchChain = chain.refetch;
+  const refetchBlocks = blocks.refetch;
+  const refetch = () => {
+    refetchChain();
+    refetchBlocks();
+  };
+
+  // Reload the chain whenever the node reports a new tip
+  useEffect(() => {
+    const source = new EventSource(
+      `${axiosInstance.defaults.baseURL}/events?topics=tip`
+    );
+    source.addEventListener("tip", () => {
+      refetchChain();
+      refetchBlocks();
+    });
+    return () => source.close();
+  }, [refetchChain, refetchBlocks]);
+
+  if (chain.isPending || blocks.isPending) return <CenteredSpinner />;
+  if (chain.error) return <ErrorAlert message={chain.error.toString()} />;
+  if (blocks.error) return <ErrorAlert message={blocks.error.toString()} />;
 
-  if (isPending) return <CenteredSpinner />;
-  if (error) return <ErrorAlert message={error.toString()} />;
+  const page = blocks.data;
+  const first = page.total === 0 ? 0 : page.offset + 1;
+  const last = page.offset + page.blocks.length;
 
   return (
     <Box>
       <>
-        <BlocksTable blocks={data.blocks} />
+        <BlocksTable blocks={page.blocks.map((entry) => entry.block)} />
+        <Flex justifyContent={"space-between"} alignItems={"center"} mt={4}>
+          <Button
+            isDisabled={offset === 0}
+            onClick={() => setOffset(Math.max(offset - PAGE_SIZE, 0))}
+          >
+            Newer
+          </Button>
+          <Text>
+            Blocks {first}-{last} of {page.total}
+          </Text>
+          <Button
+            isDisabled={last >= page.total}
+            onClick={() => setOffset(offset + PAGE_SIZE)}
+          >
+            Older
+          </Button>
+        </Flex>
         <Flex justifyContent={"space-between"} mt={4}>
           <Text as={"b"} fontSize={"1xl"}>
-            Block Size: {data.maxBlockSize}
+            Block Size: {chain.data.maxBlockSize}
           </Text>
           <Text as={"b"} fontSize={"1xl"}>
-            Mining Reward: {data.miningReward}
+            Mining Reward: {chain.data.miningReward}
           </Text>
           <MineBlockButton refetchParentPage={refetch} />
         </Flex>
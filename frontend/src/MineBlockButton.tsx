@@ -2,12 +2,15 @@ import { Button, CircularProgress } from "@chakra-ui/react";
 import { useState } from "react";
 import { useDisclosure } from "@chakra-ui/react";
 import { useQuery, useMutation } from "@tanstack/react-query";
+import { isAxiosError } from "axios";
 import axiosInstance from "./axiosConfig";
 import InformationModal from "./InformationModal";
 
 interface MiningStatusResponse {
   status: "pending" | "successful" | "failed";
-  details: string;
+  attempts: number;
+  blockHeight?: number;
+  error?: string;
 }
 
 async function startMiningProcess(): Promise<{ id: string }> {
@@ -48,6 +51,13 @@ export default function MineBlockButton({
   function handleStartMining() {
     startMiningMutation.mutate(undefined, {
       onSuccess: (data) => setProcessId(data.id),
+      onError: (error) => {
+        const details = isAxiosError(error)
+          ? (error.response?.data as { details?: string } | undefined)?.details
+          : undefined;
+        setModalMessage(details || "Error mining block!");
+        onOpen();
+      },
     });
   }
 
@@ -59,8 +69,11 @@ export default function MineBlockButton({
 
     if (finalStatuses.includes(status)) {
       setProcessId(null);
+      const { error, blockHeight, attempts } = miningStatusQuery.data;
       setModalMessage(
-        miningStatusQuery.data.details || "Mining process completed."
+        error
+          ? `Error: ${error}`
+          : `Block ${blockHeight} mined after ${attempts} attempts.`
       );
       onOpen();
     }
@@ -4,6 +4,10 @@ const axiosInstance = axios.create({
   baseURL: 'http://localhost:8090',
   headers: {
     'Content-Type': 'application/json',
+    // Nodes started with -api-keys need a key to submit transactions or mine
+    ...(process.env.REACT_APP_API_KEY
+      ? { Authorization: `Bearer ${process.env.REACT_APP_API_KEY}` }
+      : {}),
   },
 });
 
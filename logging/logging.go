@@ -0,0 +1,174 @@
+// Package logging sets up the structured loggers of the subsystems of the node.
+// Packages get their logger once with For and Setup may reconfigure the output
+// and levels at any time afterwards.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Subsystems with their own loggers
+const (
+	SubsystemNode    = "node"
+	SubsystemChain   = "chain"
+	SubsystemStorage = "storage"
+	SubsystemP2P     = "p2p"
+	SubsystemAPI     = "api"
+)
+
+var subsystems = []string{SubsystemNode, SubsystemChain, SubsystemStorage, SubsystemP2P, SubsystemAPI}
+
+// Formats of Setup
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var (
+	// output is the handler all subsystems write to, without a level of its own
+	output atomic.Pointer[slog.Handler]
+
+	mutex        sync.Mutex
+	defaultLevel = new(slog.LevelVar)
+	levels       = map[string]*slog.LevelVar{}
+)
+
+func init() {
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	output.Store(&handler)
+}
+
+func levelOf(subsystem string) *slog.LevelVar {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	level, ok := levels[subsystem]
+	if !ok {
+		level = new(slog.LevelVar)
+		level.Set(defaultLevel.Level())
+		levels[subsystem] = level
+	}
+	return level
+}
+
+// For returns the logger of subsystem, every record it writes has a "subsystem"
+// attribute.
+func For(subsystem string) *slog.Logger {
+	return slog.New(&handler{subsystem: subsystem, level: levelOf(subsystem)})
+}
+
+// Setup writes the logs to w in format, with the levels of spec. The spec is a
+// comma-separated list of a default level and subsystem=level pairs, for example
+// "info,p2p=debug,storage=warn".
+func Setup(w io.Writer, format, spec string) error {
+	defaults, overrides, err := ParseLevels(spec)
+	if err != nil {
+		return err
+	}
+	options := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var out slog.Handler
+	switch format {
+	case FormatText:
+		out = slog.NewTextHandler(w, options)
+	case FormatJSON:
+		out = slog.NewJSONHandler(w, options)
+	default:
+		return fmt.Errorf("unknown log format %q, must be %s or %s", format, FormatText, FormatJSON)
+	}
+
+	mutex.Lock()
+	defaultLevel.Set(defaults)
+	for subsystem, level := range levels {
+		override, ok := overrides[subsystem]
+		if !ok {
+			override = defaults
+		}
+		level.Set(override)
+	}
+	for subsystem, override := range overrides {
+		if _, ok := levels[subsystem]; !ok {
+			levels[subsystem] = new(slog.LevelVar)
+		}
+		levels[subsystem].Set(override)
+	}
+	mutex.Unlock()
+
+	output.Store(&out)
+	slog.SetDefault(For(SubsystemNode))
+	return nil
+}
+
+// ParseLevels parses a level spec of Setup.
+func ParseLevels(spec string) (slog.Level, map[string]slog.Level, error) {
+	defaults := slog.LevelInfo
+	overrides := map[string]slog.Level{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		subsystem, name, found := strings.Cut(part, "=")
+		if !found {
+			name = subsystem
+		}
+		var level slog.Level
+		err := level.UnmarshalText([]byte(name))
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid log level %q: %w", part, err)
+		}
+		if found {
+			if !slices.Contains(subsystems, subsystem) {
+				return 0, nil, fmt.Errorf("unknown subsystem %q, must be one of %s", subsystem, strings.Join(subsystems, ", "))
+			}
+			overrides[subsystem] = level
+		} else {
+			defaults = level
+		}
+	}
+	return defaults, overrides, nil
+}
+
+// handler filters records by the level of its subsystem and passes them on to the
+// current output. Attributes and groups are replayed on the output for every
+// record, as the output may change after the logger was derived.
+type handler struct {
+	subsystem string
+	level     *slog.LevelVar
+	derive    []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	out := (*output.Load()).WithAttrs([]slog.Attr{slog.String("subsystem", h.subsystem)})
+	for _, derive := range h.derive {
+		out = derive(out)
+	}
+	return out.Handle(ctx, record)
+}
+
+func (h *handler) with(derive func(slog.Handler) slog.Handler) *handler {
+	return &handler{
+		subsystem: h.subsystem,
+		level:     h.level,
+		derive:    append(h.derive[:len(h.derive):len(h.derive)], derive),
+	}
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler { return out.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler { return out.WithGroup(name) })
+}
@@ -0,0 +1,92 @@
+package logging_test
+
+import (
+	"blockchain/logging"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLevels(t *testing.T) {
+	tests := []struct {
+		spec      string
+		defaults  slog.Level
+		overrides map[string]slog.Level
+		err       bool
+	}{
+		{"", slog.LevelInfo, map[string]slog.Level{}, false},
+		{"warn,p2p=debug", slog.LevelWarn, map[string]slog.Level{"p2p": slog.LevelDebug}, false},
+		{" p2p=debug , storage=ERROR ,debug", slog.LevelDebug, map[string]slog.Level{"p2p": slog.LevelDebug, "storage": slog.LevelError}, false},
+		{"info,api=warn,api=error", slog.LevelInfo, map[string]slog.Level{"api": slog.LevelError}, false},
+		{"loud", 0, nil, true},
+		{"info,p2p=loud", 0, nil, true},
+		{"info,wallet=debug", 0, nil, true},
+	}
+	for _, test := range tests {
+		defaults, overrides, err := logging.ParseLevels(test.spec)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: no error", test.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		if defaults != test.defaults || !reflect.DeepEqual(overrides, test.overrides) {
+			t.Errorf("%q: got %v %v, want %v %v", test.spec, defaults, overrides, test.defaults, test.overrides)
+		}
+	}
+}
+
+// TestSetup checks that loggers taken before Setup follow its output and levels.
+func TestSetup(t *testing.T) {
+	p2pLogger := logging.For(logging.SubsystemP2P).With("peer", "a")
+	chainLogger := logging.For(logging.SubsystemChain)
+	t.Cleanup(func() { logging.Setup(os.Stderr, logging.FormatText, "info") })
+
+	var out bytes.Buffer
+	err := logging.Setup(&out, logging.FormatJSON, "warn,p2p=debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2pLogger.Debug("Received message")
+	chainLogger.Info("Added block")
+	chainLogger.Warn("Rejected block")
+	logging.For(logging.SubsystemStorage).Info("Opened database")
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var record map[string]any
+		err := json.Unmarshal([]byte(line), &record)
+		if err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatalf("logged %q, want the p2p debug and the chain warning", out.String())
+	}
+	if records[0]["msg"] != "Received message" || records[0]["subsystem"] != "p2p" || records[0]["peer"] != "a" {
+		t.Fatalf("first record is %v", records[0])
+	}
+	if records[1]["msg"] != "Rejected block" || records[1]["subsystem"] != "chain" || records[1]["level"] != "WARN" {
+		t.Fatalf("second record is %v", records[1])
+	}
+
+	for _, invalid := range []struct{ format, spec string }{{"xml", "info"}, {logging.FormatText, "info,p2p=loud"}} {
+		if logging.Setup(&out, invalid.format, invalid.spec) == nil {
+			t.Fatalf("Setup(%q, %q) did not fail", invalid.format, invalid.spec)
+		}
+	}
+	out.Reset()
+	p2pLogger.Debug("Still enabled")
+	if !strings.Contains(out.String(), "Still enabled") {
+		t.Fatal("a failed Setup changed the levels")
+	}
+}
@@ -0,0 +1,300 @@
+// Package metrics keeps counters, gauges and histograms and writes them in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// DefaultBuckets suit latencies in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds metrics by name. Metrics are created once, usually in package
+// variables, and updated with the label values of each observation.
+type Registry struct {
+	mutex    sync.Mutex
+	families map[string]*family
+	hooks    []func()
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Default is the registry of the metrics declared by the packages of the node.
+var Default = NewRegistry()
+
+// OnScrape runs fn before every scrape, to update gauges that are cheaper to read
+// on demand than to maintain.
+func (registry *Registry) OnScrape(fn func()) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.hooks = append(registry.hooks, fn)
+}
+
+func (registry *Registry) register(name, help, kind string, buckets []float64, labels []string) *family {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if _, ok := registry.families[name]; ok {
+		panic("metrics: " + name + " is already registered")
+	}
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		buckets: buckets,
+		labels:  labels,
+		series:  make(map[string]*series),
+	}
+	// Metrics without labels are reported from the start
+	if len(labels) == 0 {
+		f.get(nil)
+	}
+	registry.families[name] = f
+	return f
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// counts of the histogram buckets, the last one is +Inf
+	counts []uint64
+	count  uint64
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	buckets []float64
+	labels  []string
+
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+// get returns the series of labelValues, the caller must hold the mutex.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if f.kind == kindHistogram {
+			s.counts = make([]uint64, len(f.buckets)+1)
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter is a value that only goes up.
+type Counter struct{ family *family }
+
+func (registry *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{registry.register(name, help, kindCounter, nil, labels)}
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+func (counter *Counter) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+func (counter *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		panic("metrics: counter " + counter.family.name + " cannot decrease")
+	}
+	counter.family.mutex.Lock()
+	defer counter.family.mutex.Unlock()
+
+	counter.family.get(labelValues).value += value
+}
+
+// Gauge is a value that goes up and down.
+type Gauge struct{ family *family }
+
+func (registry *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{registry.register(name, help, kindGauge, nil, labels)}
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+func (gauge *Gauge) Set(value float64, labelValues ...string) {
+	gauge.family.mutex.Lock()
+	defer gauge.family.mutex.Unlock()
+
+	gauge.family.get(labelValues).value = value
+}
+
+func (gauge *Gauge) Add(value float64, labelValues ...string) {
+	gauge.family.mutex.Lock()
+	defer gauge.family.mutex.Unlock()
+
+	gauge.family.get(labelValues).value += value
+}
+
+// Histogram counts observations in buckets with the given upper bounds.
+type Histogram struct{ family *family }
+
+func (registry *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{registry.register(name, help, kindHistogram, buckets, labels)}
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+func (histogram *Histogram) Observe(value float64, labelValues ...string) {
+	histogram.family.mutex.Lock()
+	defer histogram.family.mutex.Unlock()
+
+	s := histogram.family.get(labelValues)
+	bucket := sort.SearchFloat64s(histogram.family.buckets, value)
+	s.counts[bucket]++
+	s.count++
+	s.value += value
+}
+
+// WriteTo writes all metrics in the text exposition format, sorted by name.
+func (registry *Registry) WriteTo(w io.Writer) (int64, error) {
+	registry.mutex.Lock()
+	hooks := append([]func(){}, registry.hooks...)
+	families := make([]*family, 0, len(registry.families))
+	for _, f := range registry.families {
+		families = append(families, f)
+	}
+	registry.mutex.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	counter := &countingWriter{w: w}
+	buffer := bufio.NewWriter(counter)
+	for _, f := range families {
+		f.write(buffer)
+	}
+	err := buffer.Flush()
+	return counter.n, err
+}
+
+// ServeHTTP answers scrapes.
+func (registry *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, err := registry.WriteTo(w)
+	if err != nil {
+		slog.Warn("Could not write metrics", "err", err)
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.series) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != kindHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labels, s.labelValues, "", ""), formatValue(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, upperBound := range f.buckets {
+			cumulative += s.counts[i]
+			le := formatValue(upperBound)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(f.labels, s.labelValues, "le", le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(f.labels, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, formatLabels(f.labels, s.labelValues, "", ""), formatValue(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, formatLabels(f.labels, s.labelValues, "", ""), s.count)
+	}
+}
+
+// formatLabels formats the labels of a sample, with an extra label if extraName
+// is set.
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escapeLabelValue(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+escapeLabelValue(extraValue)+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,100 @@
+package metrics_test
+
+import (
+	"blockchain/metrics"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	registry := metrics.NewRegistry()
+	requests := registry.NewCounter("requests_total", "Requests by path.", "path")
+	peers := registry.NewGauge("peers", "Connected peers.")
+	latency := registry.NewHistogram("latency_seconds", "Latency\nof requests.", []float64{1, 0.5})
+	registry.NewCounter("unused_total", "Never observed.", "reason")
+
+	requests.Inc("/b")
+	requests.Add(2.5, `/a"\`)
+	peers.Set(3)
+	peers.Add(-1)
+	latency.Observe(0.25)
+	latency.Observe(0.75)
+	latency.Observe(2)
+
+	var out strings.Builder
+	n, err := registry.WriteTo(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP latency_seconds Latency\nof requests.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.5"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3
+latency_seconds_count 3
+# HELP peers Connected peers.
+# TYPE peers gauge
+peers 2
+# HELP requests_total Requests by path.
+# TYPE requests_total counter
+requests_total{path="/a\"\\"} 2.5
+requests_total{path="/b"} 1
+`
+	if out.String() != want {
+		t.Fatalf("output is\n%s\nwant\n%s", out.String(), want)
+	}
+	if n != int64(len(want)) {
+		t.Fatalf("wrote %d bytes, want %d", n, len(want))
+	}
+}
+
+func TestOnScrape(t *testing.T) {
+	registry := metrics.NewRegistry()
+	height := registry.NewGauge("height", "Height of the tip.")
+	scrapes := 0
+	registry.OnScrape(func() {
+		scrapes++
+		height.Set(float64(scrapes * 10))
+	})
+
+	for want := 1; want <= 2; want++ {
+		recorder := httptest.NewRecorder()
+		registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+			t.Fatalf("content type is %q", contentType)
+		}
+		if scrapes != want {
+			t.Fatalf("hook ran %d times, want %d", scrapes, want)
+		}
+		if sample := fmt.Sprintf("height %d\n", want*10); !strings.Contains(recorder.Body.String(), sample) {
+			t.Fatalf("body %q does not contain %q", recorder.Body.String(), sample)
+		}
+	}
+}
+
+func TestMisuse(t *testing.T) {
+	registry := metrics.NewRegistry()
+	counter := registry.NewCounter("events_total", "Events by kind.", "kind")
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{"duplicate name", func() { registry.NewGauge("events_total", "Again.") }},
+		{"missing label", func() { counter.Inc() }},
+		{"decreasing counter", func() { counter.Add(-1, "kind") }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("did not panic")
+				}
+			}()
+			test.fn()
+		})
+	}
+}
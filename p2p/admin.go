@@ -0,0 +1,92 @@
+package p2p
+
+import (
+	"blockchain/chain"
+	"net"
+	"time"
+)
+
+// Ban disconnects peerID and refuses its connections for duration.
+func (node *Node) Ban(peerID string, duration time.Duration) {
+	node.Mutex.Lock()
+	defer node.Mutex.Unlock()
+
+	node.banned[peerID] = time.Now().Add(duration)
+	logger.Warn("Banned peer", "peer", peerID, "until", node.banned[peerID])
+	node.removeConnection(peerID, nil)
+}
+
+// Unban lifts the ban of peerID and reports whether it was banned.
+func (node *Node) Unban(peerID string) bool {
+	node.Mutex.Lock()
+	defer node.Mutex.Unlock()
+
+	banned := node.isBanned(peerID)
+	delete(node.banned, peerID)
+	return banned
+}
+
+// Bans returns the banned peer IDs with the time their bans end.
+func (node *Node) Bans() map[string]time.Time {
+	node.Mutex.Lock()
+	defer node.Mutex.Unlock()
+
+	bans := make(map[string]time.Time, len(node.banned))
+	for peerID, until := range node.banned {
+		if node.isBanned(peerID) {
+			bans[peerID] = until
+		}
+	}
+	return bans
+}
+
+// Resync asks every connected peer for the headers after our tip, so blocks that
+// were missed, for example while block acceptance was paused, are downloaded.
+func (node *Node) Resync(blockchain *chain.Blockchain) int {
+	peers := node.connectedPeers()
+	for _, peer := range peers {
+		node.RequestSync(peer, blockchain)
+	}
+	return len(peers)
+}
+
+// ListenAddresses returns the addresses the node accepts peers on. A listener on
+// all interfaces is reported with the address of every interface.
+func (node *Node) ListenAddresses() []string {
+	node.Mutex.Lock()
+	addr := node.listenAddr
+	node.Mutex.Unlock()
+	if addr == nil {
+		return []string{}
+	}
+
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return []string{addr.String()}
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsUnspecified() {
+		return []string{addr.String()}
+	}
+	interfaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		logger.Warn("Could not list interface addresses", "err", err)
+		return []string{addr.String()}
+	}
+	addresses := []string{}
+	for _, interfaceAddr := range interfaceAddrs {
+		if ipNet, ok := interfaceAddr.(*net.IPNet); ok {
+			addresses = append(addresses, net.JoinHostPort(ipNet.IP.String(), port))
+		}
+	}
+	return addresses
+}
+
+// BestPeerHeight returns the highest tip known among the connected peers, or
+// false if no peer told us its tip yet.
+func (node *Node) BestPeerHeight() (int, bool) {
+	best := -1
+	for _, peer := range node.connectedPeers() {
+		best = max(best, int(peer.bestHeight.Load()))
+	}
+	return best, best >= 0
+}
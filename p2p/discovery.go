@@ -0,0 +1,178 @@
+package p2p
+
+import (
+	"blockchain/chain"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+)
+
+const DefaultDiscoveryGroup = "239.255.42.99:9999"
+
+// Announcement is what nodes multicast about themselves during discovery.
+type Announcement struct {
+	NetworkID string `json:"networkId"`
+	PeerID    string `json:"peerId"`
+	Address   string `json:"address"`
+}
+
+// Discovery finds nodes of the same network on the local network. It announces
+// the node on a UDP multicast group and connects to the nodes announcing there.
+type Discovery struct {
+	NetworkID string
+	Group     string
+	// Interface to join the group on, the system default if empty
+	Interface string
+	Interval  time.Duration
+	// RetryInterval is how long to wait before dialing a discovered peer again
+	RetryInterval time.Duration
+
+	node      *Node
+	conn      *net.UDPConn
+	mutex     sync.Mutex
+	attempted map[string]time.Time
+	stop      chan struct{}
+}
+
+func NewDiscovery(node *Node, networkID string) *Discovery {
+	return &Discovery{
+		NetworkID:     networkID,
+		Group:         DefaultDiscoveryGroup,
+		Interval:      5 * time.Second,
+		RetryInterval: 30 * time.Second,
+		node:          node,
+		attempted:     make(map[string]time.Time),
+		stop:          make(chan struct{}),
+	}
+}
+
+// Start joins the multicast group and starts announcing the node.
+func (discovery *Discovery) Start(blockchain *chain.Blockchain) error {
+	group, err := net.ResolveUDPAddr("udp4", discovery.Group)
+	if err != nil {
+		return err
+	}
+	var iface *net.Interface
+	if discovery.Interface != "" {
+		iface, err = net.InterfaceByName(discovery.Interface)
+		if err != nil {
+			return err
+		}
+	}
+	conn, err := net.ListenMulticastUDP("udp4", iface, group)
+	if err != nil {
+		return err
+	}
+	discovery.conn = conn
+
+	logger.Info("Discovering peers", "network", discovery.NetworkID, "group", discovery.Group)
+	go discovery.announce(group)
+	go discovery.listen(blockchain)
+	return nil
+}
+
+func (discovery *Discovery) Stop() {
+	close(discovery.stop)
+	if discovery.conn != nil {
+		discovery.conn.Close()
+	}
+}
+
+func (discovery *Discovery) announce(group *net.UDPAddr) {
+	conn, err := net.DialUDP("udp4", nil, group)
+	if err != nil {
+		logger.Error("Could not open discovery socket", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	announcement, err := json.Marshal(Announcement{
+		NetworkID: discovery.NetworkID,
+		PeerID:    discovery.node.Identity.ID,
+		Address:   discovery.node.Address,
+	})
+	if err != nil {
+		logger.Error("Could not marshal announcement", "err", err)
+		return
+	}
+
+	ticker := time.NewTicker(discovery.Interval)
+	defer ticker.Stop()
+	for {
+		_, err := conn.Write(announcement)
+		if err != nil {
+			logger.Warn("Could not send announcement", "err", err)
+		}
+		select {
+		case <-discovery.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (discovery *Discovery) listen(blockchain *chain.Blockchain) {
+	buffer := make([]byte, 1024)
+	for {
+		n, source, err := discovery.conn.ReadFromUDP(buffer)
+		if err != nil {
+			select {
+			case <-discovery.stop:
+			default:
+				logger.Warn("Could not read announcement", "err", err)
+			}
+			return
+		}
+		var announcement Announcement
+		err = json.Unmarshal(buffer[:n], &announcement)
+		if err != nil {
+			continue
+		}
+		discovery.handle(announcement, source, blockchain)
+	}
+}
+
+func (discovery *Discovery) handle(announcement Announcement, source *net.UDPAddr, blockchain *chain.Blockchain) {
+	node := discovery.node
+	if announcement.NetworkID != discovery.NetworkID || announcement.PeerID == "" {
+		return
+	}
+	// Only the node with the lower ID dials, so two nodes discovering each other at
+	// the same time do not replace each other's connection
+	if announcement.PeerID <= node.Identity.ID {
+		return
+	}
+	node.Mutex.Lock()
+	_, connected := node.Connections[announcement.PeerID]
+	node.Mutex.Unlock()
+	if connected {
+		return
+	}
+
+	discovery.mutex.Lock()
+	last, ok := discovery.attempted[announcement.PeerID]
+	if ok && time.Since(last) < discovery.RetryInterval {
+		discovery.mutex.Unlock()
+		return
+	}
+	discovery.attempted[announcement.PeerID] = time.Now()
+	discovery.mutex.Unlock()
+
+	host, port, err := net.SplitHostPort(announcement.Address)
+	if err != nil {
+		return
+	}
+	// A node listening on all interfaces is reachable at the address it sent from
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = source.IP.String()
+	}
+	address := net.JoinHostPort(host, port)
+	logger.Info("Discovered peer", "peer", announcement.PeerID, "address", address)
+	go func() {
+		err := node.ConnectToPeer(announcement.PeerID+"@"+address, blockchain)
+		if err != nil {
+			logger.Info("Could not connect to discovered peer", "peer", announcement.PeerID, "err", err)
+		}
+	}()
+}
@@ -0,0 +1,175 @@
+package p2p
+
+import (
+	"blockchain/chain"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// Identity is the persistent key pair of a node. Peers know each other by the ID
+// derived from the public key, not by the address they claim in the handshake.
+type Identity struct {
+	PrivateKey *ecdsa.PrivateKey
+	ID         string
+}
+
+func NewIdentity(privateKey *ecdsa.PrivateKey) (*Identity, error) {
+	id, err := PeerID(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{PrivateKey: privateKey, ID: id}, nil
+}
+
+// LoadOrCreateIdentity reads the PEM encoded private key from path and generates
+// a new one if the file does not exist yet.
+func LoadOrCreateIdentity(path string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		privateKeyPEM, err := chain.PrivateKeyToPEMString(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		err = os.WriteFile(path, []byte(privateKeyPEM), 0600)
+		if err != nil {
+			return nil, err
+		}
+		return NewIdentity(privateKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pemBlock, _ := pem.Decode(data)
+	if pemBlock == nil {
+		return nil, fmt.Errorf("failed to parse PEM block in %s", path)
+	}
+	privateKey, err := x509.ParseECPrivateKey(pemBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return NewIdentity(privateKey)
+}
+
+// PeerID is the hex encoded SHA256 of the DER encoded public key.
+func PeerID(publicKey *ecdsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(der)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// SplitPeerAddress splits an optional "peerID@host:port" peer address. The peer ID
+// is empty when only "host:port" is given.
+func SplitPeerAddress(peer string) (string, string) {
+	if id, address, ok := strings.Cut(peer, "@"); ok {
+		return id, address
+	}
+	return "", peer
+}
+
+func (identity *Identity) certificate() (tls.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: identity.ID},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &identity.PrivateKey.PublicKey, identity.PrivateKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: identity.PrivateKey}, nil
+}
+
+// tlsConfig builds a mutual TLS config. Certificates are self-signed, so instead of
+// a CA chain we check the self signature and, if known, the expected peer ID.
+func (identity *Identity) tlsConfig(expectedPeerID string) (*tls.Config, error) {
+	certificate, err := identity.certificate()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates:       []tls.Certificate{certificate},
+		ClientAuth:         tls.RequireAnyClientCert,
+		InsecureSkipVerify: true, //nolint:gosec // peers are verified in VerifyPeerCertificate
+		MinVersion:         tls.VersionTLS13,
+		// Tickets are written after the handshake and would block on unbuffered
+		// transports such as net.Pipe until the other side reads
+		SessionTicketsDisabled: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			peerID, err := verifyPeerCertificate(rawCerts)
+			if err != nil {
+				return err
+			}
+			if expectedPeerID != "" && peerID != expectedPeerID {
+				return fmt.Errorf("unexpected peer ID %s, want %s", peerID, expectedPeerID)
+			}
+			return nil
+		},
+	}, nil
+}
+
+func verifyPeerCertificate(rawCerts [][]byte) (string, error) {
+	if len(rawCerts) == 0 {
+		return "", errors.New("peer did not present a certificate")
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return "", errors.New("peer certificate is expired or not yet valid")
+	}
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		return "", fmt.Errorf("peer certificate is not self-signed: %w", err)
+	}
+	publicKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return "", errors.New("not ECDSA public key")
+	}
+	return PeerID(publicKey)
+}
+
+// handshakeTLS completes the TLS handshake and returns the verified peer ID.
+func handshakeTLS(conn *tls.Conn) (string, error) {
+	err := conn.Handshake()
+	if err != nil {
+		return "", err
+	}
+	state := conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return "", errors.New("peer did not present a certificate")
+	}
+	publicKey, ok := state.PeerCertificates[0].PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return "", errors.New("not ECDSA public key")
+	}
+	return PeerID(publicKey)
+}
@@ -0,0 +1,78 @@
+package p2p
+
+import (
+	"blockchain/metrics"
+	"strings"
+)
+
+const (
+	directionReceived = "received"
+	directionSent     = "sent"
+)
+
+var (
+	peersGauge       = metrics.NewGauge("p2p_peers", "Number of connected peers by direction.", "direction")
+	bannedPeersGauge = metrics.NewGauge("p2p_banned_peers", "Number of banned peers.")
+	bytesCounter     = metrics.NewCounter("p2p_bytes_total", "Bytes exchanged with peers by direction.", "direction")
+	messagesCounter  = metrics.NewCounter("p2p_messages_total", "Messages exchanged with peers by direction and type.", "direction", "type")
+)
+
+var messageTypes = map[string]bool{
+	MessageTransaction:          true,
+	MessageBlock:                true,
+	MessagePing:                 true,
+	MessagePong:                 true,
+	MessageGetHeaders:           true,
+	MessageHeaders:              true,
+	MessageGetBlocks:            true,
+	MessageBlocks:               true,
+	MessageNotFound:             true,
+	MessageCompactBlock:         true,
+	MessageGetBlockTransactions: true,
+	MessageBlockTransactions:    true,
+	MessageDisconnect:           true,
+}
+
+// messageType reads the type of an encoded message, which json.Marshal writes
+// first. Anything else is reported as "unknown" to keep the number of label
+// values bounded.
+func messageType(message string) string {
+	rest, ok := strings.CutPrefix(message, `{"type":"`)
+	if !ok {
+		return "unknown"
+	}
+	messageType, _, _ := strings.Cut(rest, `"`)
+	if !messageTypes[messageType] {
+		return "unknown"
+	}
+	return messageType
+}
+
+func countMessage(direction, message string, size int) {
+	bytesCounter.Add(float64(size), direction)
+	messagesCounter.Inc(direction, messageType(message))
+}
+
+// CollectMetrics updates the gauges describing the connections, it is meant to
+// run before every scrape.
+func (node *Node) CollectMetrics() {
+	node.Mutex.Lock()
+	defer node.Mutex.Unlock()
+
+	var inbound, outbound, banned int
+	for _, peer := range node.Connections {
+		if peer.Inbound {
+			inbound++
+		} else {
+			outbound++
+		}
+	}
+	for peerID := range node.banned {
+		if node.isBanned(peerID) {
+			banned++
+		}
+	}
+	peersGauge.Set(float64(inbound), "inbound")
+	peersGauge.Set(float64(outbound), "outbound")
+	bannedPeersGauge.Set(float64(banned))
+}
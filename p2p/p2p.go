@@ -2,272 +2,682 @@ package p2p
 
 import (
 	"blockchain/chain"
+	"blockchain/events"
+	"blockchain/logging"
 	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
-	"os"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
+var logger = logging.For(logging.SubsystemP2P)
+
+// Node guards Peers and Connections with Mutex.
 type Node struct {
-	Address     string
-	Peers       map[string]bool
-	Connections map[string]net.Conn
+	Address  string
+	Identity *Identity
+	Peers    map[string]bool
+	// Connections are keyed by the peer ID verified during the TLS handshake
+	Connections map[string]*Peer
 	Mutex       sync.Mutex
+	Transport   Transport
+	Limits      Limits
+	Orphans     *chain.OrphanPool
+	// Events receives peer connections and disconnections, it may be nil
+	Events *events.Bus
+	// InboundFilter, if set, is asked for every received message and drops it when
+	// false is returned. Simulations use it to inject message loss.
+	InboundFilter func(peerID, message string) bool
+
+	inbound  int
+	outbound int
+	banned   map[string]time.Time
+	// closing is set by Shutdown, no connections are added afterwards
+	closing bool
+	// readers counts the running readMessages of added connections
+	readers sync.WaitGroup
+	// listenAddr is the address Serve listens on
+	listenAddr net.Addr
+
+	// syncMutex guards the synchronization state and is taken before Mutex
+	syncMutex sync.Mutex
+	sync      *syncState
+	partials  map[string]*partialBlock
 }
 
-func NewNode(address string, peers []string) *Node {
+func NewNode(address string, peers []string, identity *Identity) *Node {
 	peersMap := map[string]bool{}
 	for _, peer := range peers {
 		peersMap[peer] = true
 	}
 	return &Node{
 		Address:     address,
+		Identity:    identity,
 		Peers:       peersMap,
-		Connections: make(map[string]net.Conn),
+		Connections: make(map[string]*Peer),
+		Transport:   TCPTransport{},
+		Limits:      DefaultLimits(),
+		Orphans:     chain.NewOrphanPool(100, 10*time.Minute),
+		banned:      make(map[string]time.Time),
+		partials:    make(map[string]*partialBlock),
+	}
+}
+
+// KnownPeers returns the addresses of the peers that are not marked as disconnected.
+func (node *Node) KnownPeers() []string {
+	node.Mutex.Lock()
+	defer node.Mutex.Unlock()
+
+	peers := make([]string, 0, len(node.Peers))
+	for peer, ok := range node.Peers {
+		if ok && peer != "" {
+			peers = append(peers, peer)
+		}
 	}
+	return peers
 }
 
-func (node *Node) StartServer(blockchain *chain.Blockchain) {
-	listener, err := net.Listen("tcp", node.Address)
+func (node *Node) StartServer(ctx context.Context, blockchain *chain.Blockchain) error {
+	listener, err := node.Transport.Listen(node.Address)
 	if err != nil {
-		fmt.Println("Error starting server:", err)
-		os.Exit(1)
+		return err
 	}
+	stop := context.AfterFunc(ctx, func() { listener.Close() })
+	defer stop()
+	return node.Serve(listener, blockchain)
+}
+
+// Serve accepts connections on listener and upgrades them to TLS. It returns when
+// the listener is closed.
+func (node *Node) Serve(listener net.Listener, blockchain *chain.Blockchain) error {
+	tlsConfig, err := node.Identity.tlsConfig("")
+	if err != nil {
+		return err
+	}
+	listener = tls.NewListener(listener, tlsConfig)
+	node.Mutex.Lock()
+	node.listenAddr = listener.Addr()
+	node.Mutex.Unlock()
 	defer func() {
 		err := listener.Close()
-		if err != nil {
-			fmt.Println("Error closing listener:", err)
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			logger.Warn("Could not close listener", "err", err)
 		}
 	}()
 
-	fmt.Println("Server started on", node.Address)
+	logger.Info("P2P server started", "address", node.Address, "peer", node.Identity.ID)
 	for {
 		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
 		if err != nil {
-			fmt.Println("Error accepting connection:", err)
+			logger.Warn("Could not accept connection", "err", err)
+			continue
+		}
+		if !node.reserveSlot(true) {
+			logger.Info("Rejecting connection", "remote", conn.RemoteAddr(), "err", ErrTooManyPeers)
+			conn.Close()
 			continue
 		}
 		go node.HandleConnection(conn, blockchain)
 	}
 }
 
-func ProcessMessage(message string, blockchain *chain.Blockchain) error {
-	var msgMap map[string]interface{}
-	err := json.Unmarshal([]byte(message), &msgMap)
+// acceptMessage applies InboundFilter to a received message.
+func (node *Node) acceptMessage(peerID, message string) bool {
+	return node.InboundFilter == nil || node.InboundFilter(peerID, message)
+}
+
+// Message is the envelope of everything sent between nodes. Only the fields used by
+// the message Type are set.
+type Message struct {
+	Type         string                 `json:"type"`
+	Transaction  *chain.Transaction     `json:"transaction,omitempty"`
+	Block        *chain.Block           `json:"block,omitempty"`
+	Blocks       []chain.Block          `json:"blocks,omitempty"`
+	Locator      []string               `json:"locator,omitempty"`
+	Header       *chain.BlockHeader     `json:"header,omitempty"`
+	Headers      []chain.BlockHeader    `json:"headers,omitempty"`
+	Hash         string                 `json:"hash,omitempty"`
+	Hashes       []string               `json:"hashes,omitempty"`
+	ShortIDs     []string               `json:"shortIds,omitempty"`
+	Prefilled    []PrefilledTransaction `json:"prefilled,omitempty"`
+	Indexes      []int                  `json:"indexes,omitempty"`
+	Transactions []chain.Transaction    `json:"transactions,omitempty"`
+	Nonce        int64                  `json:"nonce,omitempty"`
+	Reason       string                 `json:"reason,omitempty"`
+}
+
+const (
+	MessageTransaction          = "transaction"
+	MessageBlock                = "block"
+	MessagePing                 = "ping"
+	MessagePong                 = "pong"
+	MessageGetHeaders           = "getheaders"
+	MessageHeaders              = "headers"
+	MessageGetBlocks            = "getblocks"
+	MessageBlocks               = "blocks"
+	MessageNotFound             = "notfound"
+	MessageCompactBlock         = "cmpctblock"
+	MessageGetBlockTransactions = "getblocktxn"
+	MessageBlockTransactions    = "blocktxn"
+	MessageDisconnect           = "disconnect"
+)
+
+func (node *Node) ProcessMessage(peer *Peer, message string, blockchain *chain.Blockchain) error {
+	var msg Message
+	err := json.Unmarshal([]byte(message), &msg)
 	if err != nil {
-		fmt.Println("Error unmarshalling message:", err)
+		logger.Debug("Invalid message", "peer", peer.ID, "err", err)
 		return err
 	}
 
-	if msgType, ok := msgMap["type"]; ok {
-		switch msgType {
-		case "transaction":
-			var tx chain.Transaction
-			if txData, ok := msgMap["transaction"].(map[string]interface{}); ok {
-				txJson, err := json.Marshal(txData)
-				if err != nil {
-					fmt.Println("Error marshalling transaction:", err)
-					return err
-				}
-
-				err = json.Unmarshal(txJson, &tx)
-				if err != nil {
-					fmt.Println("Error unmarshalling transaction:", err)
-					return err
-				}
-				fmt.Println("Received transaction:", tx)
-				err = blockchain.AddTransactionToPool(tx)
-				if err != nil {
-					fmt.Println("Error adding transaction to pool:", err)
-					return err
-				}
-				fmt.Println("Transaction pool:", blockchain.PendingTransactions)
-			} else {
-				fmt.Println("Invalid transaction data")
-			}
-		case "block":
-			var block chain.Block
-			if blockData, ok := msgMap["block"].(map[string]interface{}); ok {
-				blockJson, err := json.Marshal(blockData)
-				if err != nil {
-					fmt.Println("Error marshalling block:", err)
-					return err
-				}
-				err = json.Unmarshal(blockJson, &block)
-				if err != nil {
-					fmt.Println("Error unmarshalling block:", err)
-					return err
-				}
-				fmt.Println("Received block:", block)
-				blockchain.AddBlock(block)
-				fmt.Println("Blocks:", blockchain.Blocks)
-			} else {
-				fmt.Println("Invalid block data")
+	switch msg.Type {
+	case MessageTransaction:
+		if msg.Transaction == nil {
+			logger.Debug("Message without transaction", "peer", peer.ID)
+			return nil
+		}
+		logger.Debug("Received transaction", "peer", peer.ID, "tx", msg.Transaction.TransactionId)
+		err = blockchain.AddTransactionToPool(*msg.Transaction)
+		if errors.Is(err, chain.ErrKnownTransaction) {
+			return nil
+		}
+		if err != nil {
+			logger.Warn("Could not add transaction to pool", "peer", peer.ID, "tx", msg.Transaction.TransactionId, "err", err)
+			return err
+		}
+	case MessagePing:
+		if msg.Nonce != 0 {
+			node.sendMessage(peer, Message{Type: MessagePong, Nonce: msg.Nonce})
+		}
+	case MessagePong:
+		peer.handlePong(msg.Nonce)
+	case MessageBlock:
+		if msg.Block == nil {
+			logger.Debug("Message without block", "peer", peer.ID)
+			return nil
+		}
+		logger.Debug("Received block", "peer", peer.ID, "block", msg.Block.Hash)
+		return node.handleBlock(peer, *msg.Block, blockchain)
+	case MessageGetHeaders:
+		headers := blockchain.HeadersAfter(msg.Locator, maxHeadersPerMessage)
+		node.sendMessage(peer, Message{Type: MessageHeaders, Headers: headers})
+	case MessageHeaders:
+		return node.handleHeaders(peer, msg.Headers, blockchain)
+	case MessageGetBlocks:
+		node.handleGetBlocks(peer, msg.Hashes, blockchain)
+	case MessageBlocks:
+		for _, block := range msg.Blocks {
+			err := node.handleBlock(peer, block, blockchain)
+			if err != nil {
+				return err
 			}
-		default:
-			fmt.Println("Unknown message type")
 		}
-	} else {
-		fmt.Println("Message does not contain a type")
+	case MessageNotFound:
+		node.handleNotFound(peer, msg.Hashes, blockchain)
+	case MessageCompactBlock:
+		if msg.Header == nil {
+			logger.Debug("Message without compact block header", "peer", peer.ID)
+			return nil
+		}
+		return node.handleCompactBlock(peer, *msg.Header, msg.ShortIDs, msg.Prefilled, blockchain)
+	case MessageGetBlockTransactions:
+		node.handleGetBlockTransactions(peer, msg.Hash, msg.Indexes, blockchain)
+	case MessageBlockTransactions:
+		return node.handleBlockTransactions(peer, msg.Hash, msg.Transactions, blockchain)
+	case MessageDisconnect:
+		logger.Info("Peer is disconnecting", "peer", peer.ID, "reason", msg.Reason)
+		return errPeerLeft
+	case "":
+		logger.Debug("Message without type", "peer", peer.ID)
+	default:
+		logger.Debug("Unknown message type", "peer", peer.ID, "type", msg.Type)
 	}
 
 	return nil
 }
 
+// HandleConnection serves an inbound connection. The caller must have reserved an
+// inbound slot, which is released when the connection is closed.
 func (node *Node) HandleConnection(conn net.Conn, blockchain *chain.Blockchain) {
 	defer func() {
 		err := conn.Close()
-		if err != nil {
-			fmt.Println("Error closing connection:", err)
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			logger.Warn("Could not close connection", "remote", conn.RemoteAddr(), "err", err)
 		}
+		node.releaseSlot(true)
 	}()
+
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		logger.Warn("Connection is not encrypted", "remote", conn.RemoteAddr())
+		return
+	}
+	node.setDeadline(conn, node.Limits.ReadTimeout)
+	peerID, err := handshakeTLS(tlsConn)
+	if err != nil {
+		logger.Info("Handshake failed", "remote", conn.RemoteAddr(), "err", err)
+		return
+	}
+	if peerID == node.Identity.ID {
+		logger.Debug("Rejecting connection to self", "remote", conn.RemoteAddr())
+		return
+	}
 	reader := bufio.NewReader(conn)
 
 	// Read initial hello message
-	message, err := reader.ReadString('\n')
+	message, err := readMessage(reader, node.Limits.MaxMessageSize)
 	if err != nil {
-		fmt.Println("Error reading from connection:", err)
-		node.RemoveConnection(conn.RemoteAddr().String())
+		logger.Info("Could not read hello", "peer", peerID, "err", err)
 		return
 	}
-	fmt.Println("Received Initial:", message)
+	logger.Debug("Received hello", "peer", peerID)
 
 	// Read peer address
-	message, err = reader.ReadString('\n')
+	address, err := readMessage(reader, node.Limits.MaxMessageSize)
+	if err != nil {
+		logger.Info("Could not read peer address", "peer", peerID, "err", err)
+		return
+	}
+	logger.Debug("Received peer address", "peer", peerID, "address", strings.TrimSpace(address))
+
+	// Answer with our own hello, so the peer can check our genesis block as well
+	_, err = conn.Write([]byte(hello(blockchain)))
+	if err != nil {
+		logger.Info("Could not send hello", "peer", peerID, "err", err)
+		return
+	}
+	err = checkHello(message, blockchain)
 	if err != nil {
-		fmt.Println("Error reading from connection:", err)
-		node.RemoveConnection(conn.RemoteAddr().String())
+		logger.Info("Rejecting peer", "peer", peerID, "err", err)
 		return
 	}
-	fmt.Println("Received peer address:", message)
 
-	peerAddress := strings.TrimSpace(message)
-	node.Peers[peerAddress] = true
-	node.AddConnection(peerAddress, conn)
+	peer := newPeer(peerID, strings.TrimSpace(address), true, conn, node.Limits)
+	err = node.AddConnection(peer)
+	if err != nil {
+		logger.Info("Rejecting peer", "peer", peerID, "err", err)
+		return
+	}
+	node.RequestSync(peer, blockchain)
 
 	// Keep the connection open to read messages
-	for {
-		message, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Println("Error reading from connection:", err)
-			node.RemoveConnection(conn.RemoteAddr().String())
-			return
-		}
-		fmt.Println("Received Message:", message)
+	node.readMessages(peer, reader, blockchain)
+}
 
-		err = ProcessMessage(message, blockchain)
-		if err != nil {
-			fmt.Println("Error processing message:", err)
-			return
-		}
+// ConnectToPeer dials address, which may be prefixed with the expected peer ID
+// as "peerID@host:port". Without the prefix any peer identity is accepted.
+func (node *Node) ConnectToPeer(address string, blockchain *chain.Blockchain) error {
+	expectedPeerID, address := SplitPeerAddress(address)
+	if !node.reserveSlot(false) {
+		logger.Info("Could not connect to peer", "address", address, "err", ErrTooManyPeers)
+		return ErrTooManyPeers
 	}
+	peer, reader, err := node.dial(expectedPeerID, address, blockchain)
+	if err != nil {
+		node.releaseSlot(false)
+		return err
+	}
+	node.RequestSync(peer, blockchain)
+
+	go func() {
+		defer node.releaseSlot(false)
+		node.readMessages(peer, reader, blockchain)
+	}()
+	return nil
 }
 
-func (node *Node) ConnectToPeer(address string, blockchain *chain.Blockchain) {
-	conn, err := net.Dial("tcp", address)
+func (node *Node) dial(expectedPeerID, address string, blockchain *chain.Blockchain) (*Peer, *bufio.Reader, error) {
+	tlsConfig, err := node.Identity.tlsConfig(expectedPeerID)
 	if err != nil {
-		fmt.Println("Error connecting to peer:", err)
-		return
+		logger.Error("Could not create TLS config", "err", err)
+		return nil, nil, err
+	}
+	rawConn, err := node.Transport.Dial(address)
+	if err != nil {
+		logger.Info("Could not connect to peer", "address", address, "err", err)
+		return nil, nil, err
 	}
+	conn := tls.Client(rawConn, tlsConfig)
 
-	message := "Hello, Blockchain!\n"
-	_, err = conn.Write([]byte(message))
+	node.setDeadline(conn, node.Limits.WriteTimeout)
+	peerID, err := handshakeTLS(conn)
 	if err != nil {
-		fmt.Println("Error writing to connection:", err)
-		node.RemoveConnection(conn.RemoteAddr().String())
-		return
+		logger.Info("Handshake failed", "address", address, "err", err)
+		conn.Close()
+		return nil, nil, err
+	}
+	if peerID == node.Identity.ID {
+		logger.Debug("Rejecting connection to self", "address", address)
+		conn.Close()
+		return nil, nil, errors.New("connection to self")
+	}
+
+	_, err = conn.Write([]byte(hello(blockchain)))
+	if err != nil {
+		logger.Info("Could not send hello", "peer", peerID, "err", err)
+		conn.Close()
+		return nil, nil, err
 	}
-	fmt.Println("Sent:", message)
 
 	_, err = conn.Write([]byte(node.Address + "\n"))
 	if err != nil {
-		fmt.Println("Error writing to connection:", err)
-		node.RemoveConnection(conn.RemoteAddr().String())
-		return
+		logger.Info("Could not send address", "peer", peerID, "err", err)
+		conn.Close()
+		return nil, nil, err
 	}
-	fmt.Println("Sent address:", node.Address)
 
-	node.AddConnection(address, conn)
-	fmt.Println("Connected to peer:", address)
+	reader := bufio.NewReader(conn)
+	message, err := readMessage(reader, node.Limits.MaxMessageSize)
+	if err != nil {
+		logger.Info("Could not read hello", "peer", peerID, "err", err)
+		conn.Close()
+		return nil, nil, err
+	}
+	err = checkHello(message, blockchain)
+	if err != nil {
+		logger.Info("Rejecting peer", "peer", peerID, "err", err)
+		conn.Close()
+		return nil, nil, err
+	}
 
-	go node.ReadData(conn, blockchain)
+	peer := newPeer(peerID, address, false, conn, node.Limits)
+	err = node.AddConnection(peer)
+	if err != nil {
+		logger.Info("Rejecting peer", "peer", peerID, "err", err)
+		conn.Close()
+		return nil, nil, err
+	}
+	logger.Info("Connected to peer", "peer", peerID, "address", address)
+	return peer, reader, nil
 }
 
-func (node *Node) AddConnection(peerAddress string, conn net.Conn) {
+// helloPrefix starts the first message of both sides of a connection, it is
+// followed by the hash of their genesis block.
+const helloPrefix = "Hello, Blockchain!"
+
+var ErrGenesisMismatch = errors.New("peer has a different genesis block")
+
+func hello(blockchain *chain.Blockchain) string {
+	return helloPrefix + " " + blockchain.GenesisHash() + "\n"
+}
+
+// checkHello checks that the hello of a peer announces the genesis block of
+// blockchain.
+func checkHello(message string, blockchain *chain.Blockchain) error {
+	genesisHash, ok := strings.CutPrefix(strings.TrimSpace(message), helloPrefix)
+	if !ok {
+		return fmt.Errorf("invalid hello %q", strings.TrimSpace(message))
+	}
+	genesisHash = strings.TrimSpace(genesisHash)
+	if genesisHash != blockchain.GenesisHash() {
+		return fmt.Errorf("%w: %s", ErrGenesisMismatch, genesisHash)
+	}
+	return nil
+}
+
+// reserveSlot takes one of the inbound or outbound connection slots.
+func (node *Node) reserveSlot(inbound bool) bool {
 	node.Mutex.Lock()
 	defer node.Mutex.Unlock()
 
-	node.Connections[peerAddress] = conn
-	fmt.Println("Connection added:", peerAddress)
+	if inbound {
+		if node.Limits.MaxInbound > 0 && node.inbound >= node.Limits.MaxInbound {
+			return false
+		}
+		node.inbound++
+		return true
+	}
+	if node.Limits.MaxOutbound > 0 && node.outbound >= node.Limits.MaxOutbound {
+		return false
+	}
+	node.outbound++
+	return true
 }
 
-func (node *Node) RemoveConnection(peerAddress string) {
+func (node *Node) releaseSlot(inbound bool) {
 	node.Mutex.Lock()
 	defer node.Mutex.Unlock()
 
-	if conn, ok := node.Connections[peerAddress]; ok {
-		conn.Close()
-		delete(node.Connections, peerAddress)
-		node.Peers[peerAddress] = false
-		fmt.Println("Connection removed:", peerAddress)
+	if inbound {
+		node.inbound--
 	} else {
-		fmt.Println("No connection found for:", peerAddress)
+		node.outbound--
 	}
 }
 
-func (node *Node) ReadData(conn net.Conn, blockchain *chain.Blockchain) {
-	reader := bufio.NewReader(conn)
+// setDeadline sets the read and write deadline of conn, a zero timeout clears it.
+func (node *Node) setDeadline(conn net.Conn, timeout time.Duration) {
+	deadline := time.Time{}
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	err := conn.SetDeadline(deadline)
+	if err != nil {
+		logger.Warn("Could not set deadline", "remote", conn.RemoteAddr(), "err", err)
+	}
+}
+
+// AddConnection registers peer under its verified ID. An older connection to the
+// same peer is closed, so there is at most one connection per peer. The messages
+// of peer must then be read with readMessages, which Shutdown waits for.
+func (node *Node) AddConnection(peer *Peer) error {
+	node.Mutex.Lock()
+	defer node.Mutex.Unlock()
+
+	if node.closing {
+		return ErrShuttingDown
+	}
+	if node.isBanned(peer.ID) {
+		return ErrPeerBanned
+	}
+	if old, ok := node.Connections[peer.ID]; ok && old != peer {
+		node.removeConnection(old.ID, old)
+	}
+	node.Connections[peer.ID] = peer
+	node.Peers[peer.Address] = true
+	// Added under Mutex, so Shutdown cannot be waiting for the readers yet
+	node.readers.Add(1)
+	logger.Info("Peer connected", "peer", peer.ID, "address", peer.Address, "inbound", peer.Inbound)
+	node.Events.Publish(events.PeerConnected, events.Peer{ID: peer.ID, Address: peer.Address, Inbound: peer.Inbound})
+	go node.writeMessages(peer)
+	return nil
+}
+
+// PeerInfo describes an established connection. LatencyMs is the round trip time
+// of the last answered ping, zero until one was answered.
+type PeerInfo struct {
+	ID            string    `json:"id"`
+	Address       string    `json:"address"`
+	Inbound       bool      `json:"inbound"`
+	Violations    int       `json:"violations"`
+	ConnectedAt   time.Time `json:"connectedAt"`
+	LatencyMs     float64   `json:"latencyMs"`
+	BytesSent     int64     `json:"bytesSent"`
+	BytesReceived int64     `json:"bytesReceived"`
+	// BestHeight is the height of the best block the peer is known to have, -1
+	// if unknown
+	BestHeight int `json:"bestHeight"`
+}
+
+func (node *Node) PeerInfo() []PeerInfo {
+	node.Mutex.Lock()
+	defer node.Mutex.Unlock()
+
+	now := time.Now()
+	peers := make([]PeerInfo, 0, len(node.Connections))
+	for _, peer := range node.Connections {
+		peer.decayViolations(now, node.Limits.ViolationDecay)
+		peers = append(peers, PeerInfo{
+			ID:            peer.ID,
+			Address:       peer.Address,
+			Inbound:       peer.Inbound,
+			Violations:    peer.violations,
+			ConnectedAt:   peer.ConnectedAt,
+			LatencyMs:     float64(peer.latency.Load()) / float64(time.Millisecond),
+			BytesSent:     peer.bytesSent.Load(),
+			BytesReceived: peer.bytesReceived.Load(),
+			BestHeight:    int(peer.bestHeight.Load()),
+		})
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+	return peers
+}
+
+// connectedPeers returns a snapshot of the established connections.
+func (node *Node) connectedPeers() []*Peer {
+	node.Mutex.Lock()
+	defer node.Mutex.Unlock()
+
+	peers := make([]*Peer, 0, len(node.Connections))
+	for _, peer := range node.Connections {
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// RemoveConnection closes the connection to peerID and reports whether there
+// was one.
+func (node *Node) RemoveConnection(peerID string) bool {
+	node.Mutex.Lock()
+	defer node.Mutex.Unlock()
+
+	_, ok := node.Connections[peerID]
+	node.removeConnection(peerID, nil)
+	return ok
+}
+
+// dropConnection removes peer only if it is still the connection registered for
+// its ID, so a reader of a replaced connection does not tear down its successor.
+func (node *Node) dropConnection(peer *Peer) {
+	node.Mutex.Lock()
+	defer node.Mutex.Unlock()
+
+	node.removeConnection(peer.ID, peer)
+}
+
+func (node *Node) removeConnection(peerID string, expected *Peer) {
+	peer, ok := node.Connections[peerID]
+	if !ok || (expected != nil && peer != expected) {
+		if expected != nil {
+			expected.Conn.Close()
+		}
+		return
+	}
+	peer.Conn.Close()
+	close(peer.closed)
+	delete(node.Connections, peerID)
+	node.Peers[peer.Address] = false
+	logger.Info("Peer disconnected", "peer", peerID, "address", peer.Address)
+	node.Events.Publish(events.PeerDisconnected, events.Peer{ID: peer.ID, Address: peer.Address, Inbound: peer.Inbound})
+}
+
+func (node *Node) readMessages(peer *Peer, reader *bufio.Reader, blockchain *chain.Blockchain) {
+	defer node.readers.Done()
+	defer node.syncPeerGone(peer, blockchain)
 	for {
-		message, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Println("Error reading from connection:", err)
-			node.RemoveConnection(conn.RemoteAddr().String())
+		if node.Limits.ReadTimeout > 0 {
+			err := peer.Conn.SetReadDeadline(time.Now().Add(node.Limits.ReadTimeout))
+			if err != nil {
+				logger.Warn("Could not set deadline", "peer", peer.ID, "err", err)
+			}
+		}
+		message, err := readMessage(reader, node.Limits.MaxMessageSize)
+		if errors.Is(err, ErrMessageTooLarge) {
+			node.penalize(peer, max(node.Limits.MaxViolations/2, 1), err.Error())
+			node.dropConnection(peer)
 			return
 		}
-		fmt.Println("Received in ReadData:", message)
-		err = ProcessMessage(message, blockchain)
 		if err != nil {
-			fmt.Println("Error processing message:", err)
+			// Reads fail as well when we closed the connection ourselves
+			if !peer.isClosed() {
+				logger.Info("Could not read from peer", "peer", peer.ID, "err", err)
+			}
+			node.dropConnection(peer)
 			return
 		}
+		logger.Debug("Received message", "peer", peer.ID, "type", messageType(message), "size", len(message))
+		peer.bytesReceived.Add(int64(len(message)))
+		countMessage(directionReceived, message, len(message))
+		if !peer.allow(len(message)) {
+			if node.penalize(peer, 1, "rate limit exceeded") {
+				return
+			}
+			continue
+		}
+		if !node.acceptMessage(peer.ID, message) {
+			continue
+		}
+
+		err = node.ProcessMessage(peer, message, blockchain)
+		// Blocks refused during maintenance are fetched again on Resync
+		if errors.Is(err, chain.ErrBlocksPaused) {
+			continue
+		}
+		if errors.Is(err, errPeerLeft) {
+			node.dropConnection(peer)
+			return
+		}
+		if err != nil {
+			logger.Info("Could not process message", "peer", peer.ID, "err", err)
+			score := 1
+			// Honest peers only relay transactions that passed the same checks
+			if errors.Is(err, chain.ErrInvalidTransaction) {
+				score = max(node.Limits.MaxViolations/2, 1)
+			}
+			if node.penalize(peer, score, err.Error()) {
+				return
+			}
+		}
 	}
 }
 
-func (node *Node) BroadcastMessage(message string) {
-	node.Mutex.Lock()
-	defer node.Mutex.Unlock()
+// send queues message for the writer of peer. A peer that does not keep up with
+// its queue is disconnected.
+func (node *Node) send(peer *Peer, message string) {
+	select {
+	case peer.outbox <- message:
+	case <-peer.closed:
+	default:
+		logger.Warn("Send queue is full, disconnecting", "peer", peer.ID)
+		node.dropConnection(peer)
+	}
+}
 
-	for address, conn := range node.Connections {
-		_, err := conn.Write([]byte(message + "\n"))
-		if err != nil {
-			fmt.Println("Error writing to peer", address, ":", err)
-		}
+func (node *Node) sendMessage(peer *Peer, msg Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logger.Error("Could not marshal message", "type", msg.Type, "err", err)
+		return
+	}
+	node.send(peer, string(data))
+}
+
+func (node *Node) BroadcastMessage(message string) {
+	for _, peer := range node.connectedPeers() {
+		node.send(peer, message)
 	}
 }
 
 func (node *Node) BroadcastTransaction(tx chain.Transaction) {
-	txJson, err := json.Marshal(struct {
-		Type        string            `json:"type"`
-		Transaction chain.Transaction `json:"transaction"`
-	}{"transaction", tx})
+	txJson, err := json.Marshal(Message{Type: MessageTransaction, Transaction: &tx})
 	if err != nil {
-		fmt.Println("Error marshalling transaction:", err)
+		logger.Error("Could not marshal transaction", "tx", tx.TransactionId, "err", err)
 		return
 	}
 	node.BroadcastMessage(string(txJson))
 }
 
+// BroadcastBlock announces block to all peers as a compact block.
 func (node *Node) BroadcastBlock(block chain.Block) {
-	blockJson, err := json.Marshal(struct {
-		Type  string      `json:"type"`
-		Block chain.Block `json:"block"`
-	}{"block", block})
-	if err != nil {
-		fmt.Println("Error marshalling block:", err)
-		return
-	}
-	node.BroadcastMessage(string(blockJson))
+	node.relayBlock(nil, block)
 }
@@ -0,0 +1,205 @@
+package p2p_test
+
+import (
+	"blockchain/chain"
+	"blockchain/p2p"
+	"blockchain/storage"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testNode struct {
+	node       *p2p.Node
+	blockchain *chain.Blockchain
+}
+
+// startNode serves a node with an empty in-memory chain on network.
+func startNode(t *testing.T, network *p2p.MemoryNetwork, address string) testNode {
+	t.Helper()
+	blockchain, err := chain.InitBlockchain(chain.RegtestParams, storage.NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := p2p.NewIdentity(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := p2p.NewNode(address, nil, identity)
+	node.Transport = network.Transport(address)
+	listener, err := node.Transport.Listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go node.Serve(listener, blockchain)
+	t.Cleanup(func() {
+		listener.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		node.Shutdown(ctx)
+	})
+	return testNode{node: node, blockchain: blockchain}
+}
+
+func (n testNode) connect(t *testing.T, to testNode) {
+	t.Helper()
+	err := n.node.ConnectToPeer(to.node.Identity.ID+"@"+to.node.Address, n.blockchain)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (n testNode) mine(ctx context.Context) error {
+	result, err := n.blockchain.Mine(ctx, n.node.Address)
+	if err != nil {
+		return err
+	}
+	n.node.BroadcastBlock(result.Block)
+	return nil
+}
+
+func converged(nodes []testNode) bool {
+	for _, n := range nodes[1:] {
+		if n.blockchain.LastBlock().Hash != nodes[0].blockchain.LastBlock().Hash {
+			return false
+		}
+	}
+	return true
+}
+
+func tips(nodes []testNode) []string {
+	hashes := make([]string, len(nodes))
+	for i, n := range nodes {
+		hashes[i] = n.blockchain.LastBlock().Hash
+	}
+	return hashes
+}
+
+// waitForConvergence mines on the first node until every node has its tip, as
+// miners racing each other leave forks of the same length behind.
+func waitForConvergence(t *testing.T, nodes []testNode, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !converged(nodes) {
+		if time.Now().After(deadline) {
+			t.Fatalf("chain tips did not converge: %v", tips(nodes))
+		}
+		err := nodes[0].mine(context.Background())
+		if err != nil && !errors.Is(err, chain.ErrChainChanged) {
+			t.Fatal(err)
+		}
+		for wait := time.Now().Add(500 * time.Millisecond); !converged(nodes) && time.Now().Before(wait); {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// TestConcurrentPeers mines, gossips transactions and reads the chains on all
+// nodes at once while a late node syncs, and is meant to be run with -race.
+func TestConcurrentPeers(t *testing.T) {
+	const (
+		nodeCount           = 4
+		blocksPerNode       = 3
+		transactionsPerNode = 5
+	)
+	network := p2p.NewMemoryNetwork()
+	var nodes []testNode
+	for i := 0; i < nodeCount; i++ {
+		nodes = append(nodes, startNode(t, network, fmt.Sprintf("node-%d", i)))
+	}
+	for i := range nodes {
+		for j := 0; j < i; j++ {
+			nodes[i].connect(t, nodes[j])
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*nodeCount)
+	for _, n := range nodes {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for mined := 0; mined < blocksPerNode && ctx.Err() == nil; {
+				err := n.mine(ctx)
+				if errors.Is(err, chain.ErrChainChanged) {
+					continue
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+				mined++
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			sender, receiver := chain.Wallet{}, chain.Wallet{}
+			sender.KeyGen()
+			receiver.KeyGen()
+			for i := 0; i < transactionsPerNode; i++ {
+				transaction, err := chain.NewTransaction(sender.PrivateKey, sender.PublicKey, receiver.PublicKey, 1)
+				if err != nil {
+					errs <- err
+					return
+				}
+				err = n.blockchain.AddTransactionToPool(transaction)
+				if err != nil {
+					errs <- err
+					return
+				}
+				n.node.BroadcastTransaction(transaction)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50 && ctx.Err() == nil; i++ {
+				height := n.blockchain.Len() - 1
+				_, err := n.blockchain.BlockByHeight(height)
+				// The chain may have been reorganized to a shorter one in between
+				if err != nil && !errors.Is(err, chain.ErrNotFound) {
+					errs <- err
+					return
+				}
+				n.blockchain.GetPendingTransactions()
+				n.blockchain.GetBalance(n.node.Address)
+				n.node.PeerInfo()
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+
+	// A node joining while the others are busy syncs the chain from them
+	late := startNode(t, network, "late")
+	late.connect(t, nodes[0])
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	nodes = append(nodes, late)
+	waitForConvergence(t, nodes, 20*time.Second)
+
+	// Every miner built blocksPerNode blocks on top of the genesis block, the
+	// chain that won is at least as long
+	for i, n := range nodes {
+		if n.blockchain.Len() < blocksPerNode+1 {
+			t.Errorf("node %d has only %d blocks", i, n.blockchain.Len())
+		}
+		if !n.blockchain.IsValid() {
+			t.Errorf("chain of node %d is invalid", i)
+		}
+	}
+}
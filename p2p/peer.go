@@ -0,0 +1,330 @@
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits bound the resources a single peer, or all peers together, can use.
+type Limits struct {
+	MaxInbound     int
+	MaxOutbound    int
+	MaxMessageSize int
+	// MessageRate and ByteRate are per peer and per second, bursts of one second
+	// worth of traffic are allowed
+	MessageRate  float64
+	ByteRate     float64
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	PingInterval time.Duration
+	// A peer is disconnected and banned for BanDuration once its violation score
+	// reaches MaxViolations. One violation is forgiven per ViolationDecay, so
+	// rare mistakes of a long lived peer do not add up to a ban.
+	MaxViolations  int
+	BanDuration    time.Duration
+	ViolationDecay time.Duration
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MaxInbound:     32,
+		MaxOutbound:    8,
+		MaxMessageSize: 4 << 20,
+		MessageRate:    100,
+		ByteRate:       4 << 20,
+		ReadTimeout:    2 * time.Minute,
+		WriteTimeout:   30 * time.Second,
+		PingInterval:   30 * time.Second,
+		MaxViolations:  10,
+		BanDuration:    time.Hour,
+		ViolationDecay: time.Minute,
+	}
+}
+
+var (
+	ErrMessageTooLarge = errors.New("message too large")
+	ErrTooManyPeers    = errors.New("too many peers")
+	ErrPeerBanned      = errors.New("peer is banned")
+	ErrShuttingDown    = errors.New("node is shutting down")
+
+	// errPeerLeft is returned for a disconnect message, the peer is dropped
+	// without a penalty
+	errPeerLeft = errors.New("peer left")
+)
+
+// Peer is an established connection to another node.
+type Peer struct {
+	ID      string
+	Address string
+	Inbound bool
+	Conn    net.Conn
+
+	ConnectedAt time.Time
+
+	messages   tokenBucket
+	bytes      tokenBucket
+	violations int
+	// violationsAt is when the violations were last decayed
+	violationsAt time.Time
+	outbox       chan string
+	closed       chan struct{}
+
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+	// lastPing is the nonce of the last ping, the time it was sent at in
+	// nanoseconds, and latency the round trip time it measured
+	lastPing atomic.Int64
+	latency  atomic.Int64
+	// bestHeight is the height of the best block the peer is known to have, -1
+	// until it sent headers or blocks
+	bestHeight atomic.Int64
+}
+
+// sendQueueSize is the number of messages that can wait for the writer of a peer.
+const sendQueueSize = 256
+
+func newPeer(id, address string, inbound bool, conn net.Conn, limits Limits) *Peer {
+	now := time.Now()
+	peer := &Peer{
+		ID:          id,
+		Address:     address,
+		Inbound:     inbound,
+		Conn:        conn,
+		ConnectedAt: now,
+		messages:    newTokenBucket(limits.MessageRate, limits.MessageRate, now),
+		bytes:       newTokenBucket(limits.ByteRate, max(limits.ByteRate, float64(limits.MaxMessageSize)), now),
+		outbox:      make(chan string, sendQueueSize),
+		closed:      make(chan struct{}),
+	}
+	peer.bestHeight.Store(-1)
+	return peer
+}
+
+// observeHeight records that peer has a block at height.
+func (peer *Peer) observeHeight(height int) {
+	for {
+		current := peer.bestHeight.Load()
+		if int64(height) <= current || peer.bestHeight.CompareAndSwap(current, int64(height)) {
+			return
+		}
+	}
+}
+
+// handlePong measures the latency of peer if nonce answers its last ping.
+func (peer *Peer) handlePong(nonce int64) {
+	if nonce != 0 && nonce == peer.lastPing.Load() {
+		peer.latency.Store(time.Now().UnixNano() - nonce)
+	}
+}
+
+// allow reports whether a message of size bytes fits into the peer's rate limits.
+func (peer *Peer) allow(size int) bool {
+	now := time.Now()
+	return peer.messages.take(1, now) && peer.bytes.take(float64(size), now)
+}
+
+func (peer *Peer) isClosed() bool {
+	select {
+	case <-peer.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// tokenBucket refills rate tokens per second up to burst. A zero rate disables it.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64, now time.Time) tokenBucket {
+	return tokenBucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+func (bucket *tokenBucket) take(n float64, now time.Time) bool {
+	if bucket.rate <= 0 {
+		return true
+	}
+	bucket.tokens = min(bucket.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate)
+	bucket.last = now
+	if bucket.tokens < n {
+		return false
+	}
+	bucket.tokens -= n
+	return true
+}
+
+// readMessage reads one newline terminated message of at most maxSize bytes.
+func readMessage(reader *bufio.Reader, maxSize int) (string, error) {
+	var message []byte
+	for {
+		line, err := reader.ReadSlice('\n')
+		if maxSize > 0 && len(message)+len(line) > maxSize {
+			return "", ErrMessageTooLarge
+		}
+		message = append(message, line...)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(message), nil
+	}
+}
+
+// penalize adds score to the violations of peer and disconnects and bans it once
+// MaxViolations is reached. It reports whether the peer was disconnected.
+func (node *Node) penalize(peer *Peer, score int, reason string) bool {
+	node.Mutex.Lock()
+	defer node.Mutex.Unlock()
+
+	peer.decayViolations(time.Now(), node.Limits.ViolationDecay)
+	peer.violations += score
+	logger.Info("Peer misbehaved", "peer", peer.ID, "reason", reason, "violations", peer.violations)
+	if node.Limits.MaxViolations <= 0 || peer.violations < node.Limits.MaxViolations {
+		return false
+	}
+	node.banned[peer.ID] = time.Now().Add(node.Limits.BanDuration)
+	logger.Warn("Banned peer", "peer", peer.ID, "until", node.banned[peer.ID])
+	node.removeConnection(peer.ID, peer)
+	return true
+}
+
+// decayViolations forgives one violation per elapsed decay interval. It must be
+// called with the Mutex of the node held.
+func (peer *Peer) decayViolations(now time.Time, decay time.Duration) {
+	if peer.violations == 0 || decay <= 0 {
+		peer.violationsAt = now
+		return
+	}
+	forgiven := int(now.Sub(peer.violationsAt) / decay)
+	if forgiven <= 0 {
+		return
+	}
+	peer.violations = max(peer.violations-forgiven, 0)
+	peer.violationsAt = peer.violationsAt.Add(time.Duration(forgiven) * decay)
+}
+
+// isBanned must be called with Mutex held.
+func (node *Node) isBanned(peerID string) bool {
+	until, ok := node.banned[peerID]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(node.banned, peerID)
+		return false
+	}
+	return true
+}
+
+// writeMessages writes the queued messages of peer until it is closed. It also
+// pings the peer so that its read deadline does not expire on an idle link.
+func (node *Node) writeMessages(peer *Peer) {
+	var ping <-chan time.Time
+	if node.Limits.PingInterval > 0 {
+		ticker := time.NewTicker(node.Limits.PingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+	for {
+		var message string
+		select {
+		case <-peer.closed:
+			return
+		case message = <-peer.outbox:
+		case <-ping:
+			nonce := time.Now().UnixNano()
+			peer.lastPing.Store(nonce)
+			message = fmt.Sprintf(`{"type":"ping","nonce":%d}`, nonce)
+		}
+
+		var err error
+		if node.Limits.WriteTimeout > 0 {
+			err = peer.Conn.SetWriteDeadline(time.Now().Add(node.Limits.WriteTimeout))
+		}
+		if err == nil {
+			var n int
+			n, err = peer.Conn.Write([]byte(message + "\n"))
+			peer.bytesSent.Add(int64(n))
+			countMessage(directionSent, message, n)
+		}
+		if err != nil {
+			logger.Info("Could not write to peer", "peer", peer.ID, "err", err)
+			node.dropConnection(peer)
+			return
+		}
+	}
+}
+
+// Shutdown stops adding connections, tells every peer that the node goes away
+// and closes the connections. The disconnect messages are given until ctx is done
+// to be written, and until then Shutdown waits for the readers of the peers to
+// finish the message they are processing, so the chain is not written to
+// afterwards.
+func (node *Node) Shutdown(ctx context.Context) {
+	node.Mutex.Lock()
+	node.closing = true
+	peers := make([]*Peer, 0, len(node.Connections))
+	for _, peer := range node.Connections {
+		peers = append(peers, peer)
+	}
+	node.Mutex.Unlock()
+
+	data, err := json.Marshal(Message{Type: MessageDisconnect, Reason: "shutdown"})
+	if err != nil {
+		logger.Error("Could not marshal message", "type", MessageDisconnect, "err", err)
+	} else {
+		// The line is shared by the writers below, appending there would race
+		data = append(data, '\n')
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(node.Limits.WriteTimeout)
+	}
+
+	var wg sync.WaitGroup
+	for _, peer := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// The message is written past the send queue, queued messages are
+			// dropped anyway
+			err := peer.Conn.SetWriteDeadline(deadline)
+			if err == nil && data != nil {
+				var n int
+				n, err = peer.Conn.Write(data)
+				peer.bytesSent.Add(int64(n))
+				countMessage(directionSent, string(data), n)
+			}
+			if err != nil {
+				logger.Info("Could not send disconnect", "peer", peer.ID, "err", err)
+			}
+			node.dropConnection(peer)
+		}()
+	}
+	wg.Wait()
+	logger.Info("Disconnected from peers", "peers", len(peers))
+
+	stopped := make(chan struct{})
+	go func() {
+		node.readers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		logger.Warn("Peer readers did not stop", "err", ctx.Err())
+	}
+}
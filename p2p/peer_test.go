@@ -0,0 +1,35 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecayViolations(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		violations int
+		elapsed    time.Duration
+		decay      time.Duration
+		want       int
+		// wantAt is the time the next decay is counted from, after start
+		wantAt time.Duration
+	}{
+		{"before the first interval", 5, 59 * time.Second, time.Minute, 5, 0},
+		{"one interval", 5, 90 * time.Second, time.Minute, 4, time.Minute},
+		{"several intervals", 5, 3 * time.Minute, time.Minute, 2, 3 * time.Minute},
+		{"all forgiven", 2, time.Hour, time.Minute, 0, time.Hour},
+		{"disabled", 5, time.Hour, 0, 5, time.Hour},
+		{"no violations", 0, time.Hour, time.Minute, 0, time.Hour},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			peer := &Peer{violations: test.violations, violationsAt: start}
+			peer.decayViolations(start.Add(test.elapsed), test.decay)
+			if peer.violations != test.want || !peer.violationsAt.Equal(start.Add(test.wantAt)) {
+				t.Fatalf("violations are %d from %v, want %d from %v", peer.violations, peer.violationsAt.Sub(start), test.want, test.wantAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+// Package simnet runs several p2p nodes in one process over an in-memory network
+// and injects latency, partitions and message loss between them.
+package simnet
+
+import (
+	"blockchain/chain"
+	"blockchain/p2p"
+	"blockchain/storage"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	mathrand "math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Nodes      int
+	Difficulty int
+	// Seed makes message drops reproducible
+	Seed     int64
+	Latency  time.Duration
+	DropRate float64
+	// OnDisk keeps the chains in Badger databases in temp dirs instead of memory
+	OnDisk bool
+	// NewStorage creates the storage of node i, it overrides OnDisk
+	NewStorage func(i int) (chain.Storage, error)
+}
+
+type Network struct {
+	Nodes  []*p2p.Node
+	Chains []*chain.Blockchain
+
+	memory    *p2p.MemoryNetwork
+	listeners []net.Listener
+	cleanup   []func()
+
+	mutex     sync.Mutex
+	random    *mathrand.Rand
+	latency   time.Duration
+	dropRate  float64
+	partition map[string]int
+	conns     map[*conn]struct{}
+	nodeByID  map[string]int
+}
+
+// New starts config.Nodes nodes sharing one genesis block. They are not connected
+// to each other until Connect or ConnectAll is called.
+func New(config Config) (*Network, error) {
+	network := &Network{
+		memory:    p2p.NewMemoryNetwork(),
+		random:    mathrand.New(mathrand.NewSource(config.Seed)),
+		latency:   config.Latency,
+		dropRate:  config.DropRate,
+		partition: make(map[string]int),
+		conns:     make(map[*conn]struct{}),
+		nodeByID:  make(map[string]int),
+	}
+	if config.NewStorage == nil && config.OnDisk {
+		config.NewStorage = network.badgerStorage
+	}
+	if config.NewStorage == nil {
+		config.NewStorage = memoryStorage
+	}
+
+	params := chain.RegtestParams
+	params.Difficulty = config.Difficulty
+	params.MaxBlockSize = 5
+	params.MiningReward = 5
+
+	for i := 0; i < config.Nodes; i++ {
+		s, err := config.NewStorage(i)
+		if err != nil {
+			network.Close()
+			return nil, err
+		}
+		blockchain, err := chain.InitBlockchain(params, s)
+		if err != nil {
+			network.Close()
+			return nil, err
+		}
+
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			network.Close()
+			return nil, err
+		}
+		identity, err := p2p.NewIdentity(privateKey)
+		if err != nil {
+			network.Close()
+			return nil, err
+		}
+
+		address := fmt.Sprintf("node-%d", i)
+		node := p2p.NewNode(address, nil, identity)
+		node.Transport = &transport{network: network, inner: network.memory.Transport(address), address: address}
+		node.InboundFilter = network.filter
+		listener, err := node.Transport.Listen(address)
+		if err != nil {
+			network.Close()
+			return nil, err
+		}
+		go func() {
+			err := node.Serve(listener, blockchain)
+			if err != nil {
+				slog.Error("Could not serve connections", "address", address, "err", err)
+			}
+		}()
+
+		network.Nodes = append(network.Nodes, node)
+		network.Chains = append(network.Chains, blockchain)
+		network.listeners = append(network.listeners, listener)
+		network.nodeByID[identity.ID] = i
+	}
+	return network, nil
+}
+
+func memoryStorage(i int) (chain.Storage, error) {
+	return storage.NewMemoryStorage(), nil
+}
+
+func (network *Network) badgerStorage(i int) (chain.Storage, error) {
+	dir, err := os.MkdirTemp("", fmt.Sprintf("simnet-%d-", i))
+	if err != nil {
+		return nil, err
+	}
+	s, err := storage.NewBadgerStorage(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	network.cleanup = append(network.cleanup, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	})
+	return s, nil
+}
+
+// Close stops all nodes and removes their storage.
+func (network *Network) Close() {
+	for _, listener := range network.listeners {
+		listener.Close()
+	}
+	network.mutex.Lock()
+	for c := range network.conns {
+		c.Conn.Close()
+	}
+	network.mutex.Unlock()
+	for _, node := range network.Nodes {
+		for _, peerID := range network.connectedPeers(node) {
+			node.RemoveConnection(peerID)
+		}
+	}
+	for _, cleanup := range network.cleanup {
+		cleanup()
+	}
+}
+
+// Connect makes node i dial node j unless they are already connected.
+func (network *Network) Connect(i, j int) error {
+	from, to := network.Nodes[i], network.Nodes[j]
+	for _, peerID := range network.connectedPeers(from) {
+		if peerID == to.Identity.ID {
+			return nil
+		}
+	}
+	return from.ConnectToPeer(to.Identity.ID+"@"+to.Address, network.Chains[i])
+}
+
+// ConnectAll connects every pair of nodes that is not separated by a partition.
+func (network *Network) ConnectAll() error {
+	var errs []error
+	for i := range network.Nodes {
+		for j := 0; j < i; j++ {
+			if network.partitioned(network.Nodes[i].Address, network.Nodes[j].Address) {
+				continue
+			}
+			errs = append(errs, network.Connect(i, j))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Partition splits the nodes into groups and cuts every connection between
+// groups. Nodes that are not listed form a group of their own.
+func (network *Network) Partition(groups ...[]int) {
+	network.mutex.Lock()
+	network.partition = make(map[string]int)
+	for group, indexes := range groups {
+		for _, i := range indexes {
+			network.partition[network.Nodes[i].Address] = group + 1
+		}
+	}
+	var cut []*conn
+	for c := range network.conns {
+		if network.partitionedLocked(c.local, c.remote) {
+			cut = append(cut, c)
+		}
+	}
+	network.mutex.Unlock()
+
+	for _, c := range cut {
+		c.Close()
+	}
+}
+
+// Heal removes the partition. Nodes have to be reconnected with ConnectAll.
+func (network *Network) Heal() {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+
+	network.partition = make(map[string]int)
+}
+
+func (network *Network) SetLatency(latency time.Duration) {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+
+	network.latency = latency
+}
+
+func (network *Network) SetDropRate(rate float64) {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+
+	network.dropRate = rate
+}
+
+// Mine mines the pending transactions of node i and broadcasts the new block.
+func (network *Network) Mine(i int) (chain.Block, error) {
+	result, err := network.Chains[i].Mine(context.Background(), network.Nodes[i].Address)
+	if err != nil {
+		return chain.Block{}, err
+	}
+	network.Nodes[i].BroadcastBlock(result.Block)
+	return result.Block, nil
+}
+
+// Tips returns the hash of the last block of every node.
+func (network *Network) Tips() []string {
+	tips := make([]string, len(network.Chains))
+	for i, blockchain := range network.Chains {
+		tips[i] = blockchain.LastBlock().Hash
+	}
+	return tips
+}
+
+func (network *Network) Converged() bool {
+	tips := network.Tips()
+	for _, tip := range tips {
+		if tip != tips[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// WaitForConvergence polls until all nodes have the same tip or timeout expires.
+func (network *Network) WaitForConvergence(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for !network.Converged() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("chain tips did not converge: %v", network.Tips())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func (network *Network) connectedPeers(node *p2p.Node) []string {
+	node.Mutex.Lock()
+	defer node.Mutex.Unlock()
+
+	peers := make([]string, 0, len(node.Connections))
+	for peerID := range node.Connections {
+		peers = append(peers, peerID)
+	}
+	return peers
+}
+
+func (network *Network) partitioned(a, b string) bool {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+
+	return network.partitionedLocked(a, b)
+}
+
+func (network *Network) partitionedLocked(a, b string) bool {
+	return network.partition[a] != network.partition[b]
+}
+
+// filter is the InboundFilter of every node and drops messages at DropRate.
+func (network *Network) filter(peerID, message string) bool {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+
+	return network.dropRate == 0 || network.random.Float64() >= network.dropRate
+}
+
+func (network *Network) track(c *conn) {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+
+	network.conns[c] = struct{}{}
+}
+
+func (network *Network) untrack(c *conn) {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+
+	delete(network.conns, c)
+}
+
+type transport struct {
+	network *Network
+	inner   *p2p.MemoryTransport
+	address string
+}
+
+func (t *transport) Listen(address string) (net.Listener, error) {
+	inner, err := t.inner.Listen(address)
+	if err != nil {
+		return nil, err
+	}
+	return &listener{Listener: inner, network: t.network}, nil
+}
+
+func (t *transport) Dial(address string) (net.Conn, error) {
+	if t.network.partitioned(t.address, address) {
+		return nil, p2p.ErrConnectionRefused
+	}
+	inner, err := t.inner.Dial(address)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{Conn: inner, network: t.network, local: t.address, remote: address}
+	t.network.track(c)
+	return c, nil
+}
+
+type listener struct {
+	net.Listener
+	network *Network
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	inner, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{
+		Conn:    inner,
+		network: l.network,
+		local:   inner.LocalAddr().String(),
+		remote:  inner.RemoteAddr().String(),
+	}
+	l.network.track(c)
+	return c, nil
+}
+
+// conn delays writes by the network latency and fails them across a partition.
+type conn struct {
+	net.Conn
+	network *Network
+	local   string
+	remote  string
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	c.network.mutex.Lock()
+	latency := c.network.latency
+	cut := c.network.partitionedLocked(c.local, c.remote)
+	c.network.mutex.Unlock()
+
+	if cut {
+		c.Close()
+		return 0, net.ErrClosed
+	}
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *conn) Close() error {
+	c.network.untrack(c)
+	return c.Conn.Close()
+}
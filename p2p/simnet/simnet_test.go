@@ -0,0 +1,198 @@
+package simnet
+
+import (
+	"blockchain/chain"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newNetwork(t *testing.T, config Config) *Network {
+	t.Helper()
+	network, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(network.Close)
+	return network
+}
+
+func mine(t *testing.T, network *Network, i, blocks int) chain.Block {
+	t.Helper()
+	var block chain.Block
+	for k := 0; k < blocks; k++ {
+		var err error
+		block, err = network.Mine(i)
+		// A block may arrive from a peer while this one is mined
+		if errors.Is(err, chain.ErrChainChanged) {
+			k--
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return block
+}
+
+// waitForTip polls until the nodes have the block with hash as their tip.
+func waitForTip(t *testing.T, network *Network, hash string, nodes ...int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tips := network.Tips()
+		reached := true
+		for _, i := range nodes {
+			reached = reached && tips[i] == hash
+		}
+		if reached {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("nodes %v did not reach tip %s: %v", nodes, hash, tips)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func signedTransaction(t *testing.T) chain.Transaction {
+	t.Helper()
+	sender, receiver := chain.Wallet{}, chain.Wallet{}
+	sender.KeyGen()
+	receiver.KeyGen()
+	transaction, err := chain.NewTransaction(sender.PrivateKey, sender.PublicKey, receiver.PublicKey, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transaction
+}
+
+// TestPartitionHeal forks the chain on both sides of a partition and checks that
+// after healing every node follows the longer side, and that the transaction
+// mined only on the shorter side goes back to its pool.
+func TestPartitionHeal(t *testing.T) {
+	network := newNetwork(t, Config{Nodes: 4, Difficulty: 1, Latency: time.Millisecond, Seed: 1})
+	err := network.ConnectAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mine(t, network, 0, 2)
+	err = network.WaitForConvergence(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forkHeight := network.Chains[0].Len() - 1
+
+	network.Partition([]int{0, 1}, []int{2, 3})
+	longer := mine(t, network, 0, 3)
+	waitForTip(t, network, longer.Hash, 0, 1)
+	transaction := signedTransaction(t)
+	err = network.Chains[2].AddTransactionToPool(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shorter := mine(t, network, 2, 1)
+	waitForTip(t, network, shorter.Hash, 2, 3)
+	if network.Converged() {
+		t.Fatal("tips converged across the partition")
+	}
+
+	network.Heal()
+	err = network.ConnectAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = network.WaitForConvergence(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tip := network.Tips()[0]; tip != longer.Hash {
+		t.Fatalf("nodes converged on %s, want the longer branch ending in %s", tip, longer.Hash)
+	}
+	for i, blockchain := range network.Chains {
+		if blockchain.Len() != forkHeight+4 {
+			t.Errorf("node %d has %d blocks, want %d", i, blockchain.Len(), forkHeight+4)
+		}
+	}
+	_, pending, err := network.Chains[2].TransactionByID(transaction.TransactionId)
+	if err != nil || !pending {
+		t.Fatalf("transaction of the replaced branch is not pending on node 2 (pending %v, %v)", pending, err)
+	}
+}
+
+// TestGossipWithDrops relays transactions and blocks while messages are dropped.
+// Missed blocks are fetched once a later block reveals them, and lost requests
+// are sent again.
+func TestGossipWithDrops(t *testing.T) {
+	network := newNetwork(t, Config{Nodes: 4, Difficulty: 1, Seed: 7})
+	err := network.ConnectAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	network.SetDropRate(0.2)
+	for k := 0; k < 10; k++ {
+		transaction := signedTransaction(t)
+		i := k % len(network.Nodes)
+		err := network.Chains[i].AddTransactionToPool(transaction)
+		if err != nil {
+			t.Fatal(err)
+		}
+		network.Nodes[i].BroadcastTransaction(transaction)
+		mine(t, network, (k+1)%len(network.Nodes), 1)
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// A dropped announcement is only made up for by the next block, so one is
+	// mined on the longest chain once nothing is dropped anymore
+	network.SetDropRate(0)
+	longest := 0
+	for i, blockchain := range network.Chains {
+		if blockchain.Len() > network.Chains[longest].Len() {
+			longest = i
+		}
+	}
+	tip := mine(t, network, longest, 1)
+	err = network.WaitForConvergence(10 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if network.Tips()[0] != tip.Hash {
+		t.Fatalf("nodes converged on %s, want %s", network.Tips()[0], tip.Hash)
+	}
+	for i, blockchain := range network.Chains {
+		if !blockchain.IsValid() {
+			t.Errorf("chain of node %d is invalid", i)
+		}
+	}
+}
+
+// TestLateJoiner connects nodes to a peer that is more than a batch of headers
+// ahead, one of them with a short fork of its own. They have to sync and switch
+// to its chain.
+func TestLateJoiner(t *testing.T) {
+	network := newNetwork(t, Config{Nodes: 3, Difficulty: 1})
+	// Mined before anyone is connected, announcing every block would exceed the
+	// rate limit of the peers
+	tip := mine(t, network, 0, maxHeaders+100)
+	mine(t, network, 2, 2)
+
+	err := network.Connect(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForTip(t, network, tip.Hash, 1)
+	err = network.Connect(2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = network.WaitForConvergence(20 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if network.Chains[2].Len() != maxHeaders+101 {
+		t.Fatalf("late node has %d blocks, want %d", network.Chains[2].Len(), maxHeaders+101)
+	}
+}
+
+// maxHeaders is the number of headers a peer sends in one message.
+const maxHeaders = 500
@@ -0,0 +1,617 @@
+package p2p
+
+import (
+	"blockchain/chain"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	maxHeadersPerMessage = 500
+	blocksPerRequest     = 16
+	maxBlocksInFlight    = 64
+	maxPartialBlocks     = 16
+	syncTimeout          = 2 * time.Minute
+	// blockRequestTimeout is how long a request for headers or bodies may go
+	// unanswered before it is taken as lost
+	blockRequestTimeout = 5 * time.Second
+	// maxSyncBodiesAhead bounds how far past the first block not connected yet
+	// bodies are requested, and so the bodies held while a missing one is
+	// requested again
+	maxSyncBodiesAhead = 256
+)
+
+// syncState tracks a headers-first synchronization with one peer. The header chain
+// is downloaded and validated from that peer first, the block bodies are then
+// requested from all connected peers in parallel.
+type syncState struct {
+	peer     *Peer
+	forkHash string
+	headers  []chain.BlockHeader
+	index    map[string]int
+	bodies   map[string]chain.Block
+	// applied is the number of headers whose blocks are connected, their bodies
+	// are not kept any more
+	applied   int
+	inFlight  map[string]blockRequest
+	lacking   map[*Peer]bool
+	completed bool
+	started   time.Time
+	// updated is when the last headers arrived from peer
+	updated time.Time
+}
+
+// blockRequest is a block body requested from peer.
+type blockRequest struct {
+	peer *Peer
+	sent time.Time
+}
+
+// partialBlock is a compact block waiting for transactions missing from the pool.
+type partialBlock struct {
+	header       chain.BlockHeader
+	transactions []*chain.Transaction
+	peer         *Peer
+}
+
+type PrefilledTransaction struct {
+	Index       int               `json:"index"`
+	Transaction chain.Transaction `json:"transaction"`
+}
+
+// ShortTransactionID identifies a transaction inside a compact block. It is salted
+// with the block hash, so collisions cannot be prepared in advance.
+func ShortTransactionID(blockHash, transactionID string) string {
+	hash := sha256.Sum256([]byte(blockHash + transactionID))
+	return hex.EncodeToString(hash[:6])
+}
+
+func (node *Node) sendGetHeaders(peer *Peer, locator []string) {
+	node.sendMessage(peer, Message{Type: MessageGetHeaders, Locator: locator})
+}
+
+// RequestSync asks peer for the headers following our tip.
+func (node *Node) RequestSync(peer *Peer, blockchain *chain.Blockchain) {
+	node.sendGetHeaders(peer, blockchain.Locator())
+}
+
+func (node *Node) handleHeaders(peer *Peer, headers []chain.BlockHeader, blockchain *chain.Blockchain) error {
+	node.syncMutex.Lock()
+	defer node.syncMutex.Unlock()
+
+	received := len(headers)
+	if len(headers) == 0 {
+		// Nothing follows our tip, so the peer is not ahead of us
+		peer.observeHeight(blockchain.Len() - 1)
+	} else if parentHeight, ok := blockchain.HeightOf(headers[0].PreviousHash); ok {
+		peer.observeHeight(parentHeight + len(headers))
+	}
+	state := node.sync
+	continuation := state != nil && state.peer == peer && !state.completed &&
+		(len(headers) == 0 || headers[0].PreviousHash == state.headers[len(state.headers)-1].Hash)
+	if continuation {
+		err := blockchain.ValidateHeaders(state.headers[len(state.headers)-1].Hash, headers)
+		if err != nil {
+			node.sync = nil
+			return err
+		}
+		for _, header := range headers {
+			state.index[header.Hash] = len(state.headers)
+			state.headers = append(state.headers, header)
+		}
+		state.updated = time.Now()
+		if forkHeight, ok := blockchain.HeightOf(state.forkHash); ok {
+			peer.observeHeight(forkHeight + len(state.headers))
+		}
+	} else {
+		if state != nil && state.peer != peer && time.Since(state.started) < syncTimeout {
+			// Another synchronization is running, this peer is asked again later
+			return nil
+		}
+		// Skip the headers of blocks we already have
+		for len(headers) > 0 {
+			if _, ok := blockchain.HeightOf(headers[0].Hash); !ok {
+				break
+			}
+			headers = headers[1:]
+		}
+		if len(headers) == 0 {
+			return nil
+		}
+		if _, ok := blockchain.HeightOf(headers[0].PreviousHash); !ok {
+			logger.Info("Headers do not connect to our chain", "peer", peer.ID, "block", headers[0].PreviousHash)
+			return nil
+		}
+		err := blockchain.ValidateHeaders(headers[0].PreviousHash, headers)
+		if err != nil {
+			return err
+		}
+		state = &syncState{
+			peer:     peer,
+			forkHash: headers[0].PreviousHash,
+			index:    make(map[string]int),
+			bodies:   make(map[string]chain.Block),
+			inFlight: make(map[string]blockRequest),
+			lacking:  make(map[*Peer]bool),
+			started:  time.Now(),
+			updated:  time.Now(),
+		}
+		for _, header := range headers {
+			state.index[header.Hash] = len(state.headers)
+			state.headers = append(state.headers, header)
+		}
+		node.sync = state
+	}
+
+	if received == maxHeadersPerMessage {
+		node.sendGetHeaders(peer, []string{state.headers[len(state.headers)-1].Hash})
+		time.AfterFunc(blockRequestTimeout, func() { node.checkStalledSync(state, blockchain) })
+		return nil
+	}
+
+	forkHeight, ok := blockchain.HeightOf(state.forkHash)
+	if !ok || forkHeight+1+len(state.headers) <= blockchain.Len() {
+		node.sync = nil
+		return nil
+	}
+	logger.Info("Syncing blocks", "peer", peer.ID, "blocks", len(state.headers))
+	state.completed = true
+	node.requestBodies(state, blockchain)
+	return nil
+}
+
+// requestBodies spreads requests for missing block bodies over the connected
+// peers. It must be called with syncMutex held.
+func (node *Node) requestBodies(state *syncState, blockchain *chain.Blockchain) {
+	peers := []*Peer{state.peer}
+	for _, peer := range node.connectedPeers() {
+		if peer != state.peer && !state.lacking[peer] {
+			peers = append(peers, peer)
+		}
+	}
+	for hash, request := range state.inFlight {
+		// The request or its answer may have been lost, the body is asked for again
+		if request.peer.isClosed() || time.Since(request.sent) >= blockRequestTimeout {
+			delete(state.inFlight, hash)
+		}
+	}
+	// Wait until a whole batch fits, so responses do not trigger tiny requests
+	if len(state.inFlight) > maxBlocksInFlight-blocksPerRequest {
+		return
+	}
+
+	window := maxSyncBodiesAhead
+	if forkHeight, ok := blockchain.HeightOf(state.forkHash); ok && state.applied == 0 {
+		// A branch replacing our blocks is only connected once it is longer
+		window = max(window, blockchain.Len()-forkHeight)
+	}
+	requests := make(map[*Peer][]string)
+	next := 0
+	for _, header := range state.headers[state.applied:min(len(state.headers), state.applied+window)] {
+		if len(state.inFlight) >= maxBlocksInFlight {
+			break
+		}
+		if _, ok := state.bodies[header.Hash]; ok {
+			continue
+		}
+		if _, ok := state.inFlight[header.Hash]; ok {
+			continue
+		}
+		peer := peers[(next/blocksPerRequest)%len(peers)]
+		next++
+		requests[peer] = append(requests[peer], header.Hash)
+		state.inFlight[header.Hash] = blockRequest{peer: peer, sent: time.Now()}
+	}
+	for peer, hashes := range requests {
+		for len(hashes) > 0 {
+			batch := hashes[:min(blocksPerRequest, len(hashes))]
+			hashes = hashes[len(batch):]
+			node.sendMessage(peer, Message{Type: MessageGetBlocks, Hashes: batch})
+		}
+	}
+	if len(requests) > 0 {
+		time.AfterFunc(blockRequestTimeout, func() { node.checkStalledSync(state, blockchain) })
+	}
+}
+
+// checkStalledSync runs when requests of state may have timed out. Missing
+// bodies are requested again, a synchronization still waiting for the headers of
+// its peer is given up.
+func (node *Node) checkStalledSync(state *syncState, blockchain *chain.Blockchain) {
+	node.syncMutex.Lock()
+	defer node.syncMutex.Unlock()
+
+	if node.sync != state {
+		return
+	}
+	if state.completed {
+		node.requestBodies(state, blockchain)
+		return
+	}
+	if time.Since(state.updated) >= blockRequestTimeout {
+		logger.Info("Sync peer did not send the headers", "peer", state.peer.ID)
+		node.sync = nil
+		node.requestSyncFromAhead(blockchain)
+	}
+}
+
+func (node *Node) handleGetBlocks(peer *Peer, hashes []string, blockchain *chain.Blockchain) {
+	var blocks []chain.Block
+	var missing []string
+	for _, hash := range hashes[:min(len(hashes), blocksPerRequest)] {
+		block, ok := blockchain.GetBlockByHash(hash)
+		if ok {
+			blocks = append(blocks, block)
+		} else {
+			missing = append(missing, hash)
+		}
+	}
+	if len(blocks) > 0 {
+		node.sendMessage(peer, Message{Type: MessageBlocks, Blocks: blocks})
+	}
+	if len(missing) > 0 {
+		node.sendMessage(peer, Message{Type: MessageNotFound, Hashes: missing})
+	}
+}
+
+func (node *Node) handleNotFound(peer *Peer, hashes []string, blockchain *chain.Blockchain) {
+	node.syncMutex.Lock()
+	defer node.syncMutex.Unlock()
+
+	state := node.sync
+	if state == nil {
+		return
+	}
+	if peer == state.peer {
+		logger.Info("Sync peer does not have the blocks it announced", "peer", peer.ID)
+		node.sync = nil
+		return
+	}
+	state.lacking[peer] = true
+	for _, hash := range hashes {
+		if state.inFlight[hash].peer == peer {
+			delete(state.inFlight, hash)
+		}
+	}
+	node.requestBodies(state, blockchain)
+}
+
+// syncPeerGone releases the requests of a disconnected peer.
+func (node *Node) syncPeerGone(peer *Peer, blockchain *chain.Blockchain) {
+	node.syncMutex.Lock()
+	defer node.syncMutex.Unlock()
+
+	for hash, partial := range node.partials {
+		if partial.peer == peer {
+			delete(node.partials, hash)
+		}
+	}
+	state := node.sync
+	if state == nil {
+		return
+	}
+	if peer == state.peer {
+		node.sync = nil
+		return
+	}
+	delete(state.lacking, peer)
+	if state.completed {
+		node.requestBodies(state, blockchain)
+	}
+}
+
+// handleBlock connects a block received from peer. Blocks that do not extend our
+// tip make us ask peer for its headers, which starts a synchronization if its
+// chain is longer.
+func (node *Node) handleBlock(peer *Peer, block chain.Block, blockchain *chain.Blockchain) error {
+	handled, err := node.addSyncBody(block, blockchain)
+	if handled || err != nil {
+		return err
+	}
+
+	err = blockchain.AcceptBlock(block)
+	if height, ok := blockchain.HeightOf(block.Hash); ok {
+		peer.observeHeight(height)
+	}
+	switch {
+	case err == nil:
+		logger.Info("Accepted block", "peer", peer.ID, "block", block.Hash)
+		node.relayBlock(peer, block)
+		node.connectOrphans(block.Hash, blockchain)
+	case errors.Is(err, chain.ErrKnownBlock):
+	case errors.Is(err, chain.ErrForkBlock):
+		node.RequestSync(peer, blockchain)
+	case errors.Is(err, chain.ErrUnknownParent):
+		// Only blocks with valid proof of work may take space in the orphan pool
+		err := blockchain.ValidateHeaders(block.PreviousHash, []chain.BlockHeader{block.Header()})
+		if err != nil {
+			return err
+		}
+		node.Orphans.Add(block)
+		missing := node.Orphans.MissingAncestor(block.Hash)
+		if _, ok := blockchain.HeightOf(missing); ok {
+			// A synchronization connected the ancestor meanwhile, the orphans fork
+			// off our chain
+			node.RequestSync(peer, blockchain)
+			return nil
+		}
+		logger.Debug("Orphan block", "peer", peer.ID, "block", block.Hash, "missing", missing)
+		node.sendMessage(peer, Message{Type: MessageGetBlocks, Hashes: []string{missing}})
+	default:
+		logger.Info("Could not accept block", "peer", peer.ID, "block", block.Hash, "err", err)
+		return err
+	}
+	return nil
+}
+
+// connectOrphans connects the orphans descending from the block hash.
+func (node *Node) connectOrphans(hash string, blockchain *chain.Blockchain) {
+	parents := []string{hash}
+	for len(parents) > 0 {
+		parent := parents[0]
+		parents = parents[1:]
+		for _, block := range node.Orphans.TakeChildren(parent) {
+			err := blockchain.AcceptBlock(block)
+			if err != nil {
+				logger.Info("Could not connect orphan block", "block", block.Hash, "err", err)
+				continue
+			}
+			logger.Info("Connected orphan block", "block", block.Hash)
+			node.relayBlock(nil, block)
+			parents = append(parents, block.Hash)
+		}
+	}
+}
+
+// addSyncBody stores block if it belongs to the running synchronization and
+// connects the downloaded blocks as soon as they follow the connected ones.
+func (node *Node) addSyncBody(block chain.Block, blockchain *chain.Blockchain) (bool, error) {
+	node.syncMutex.Lock()
+	defer node.syncMutex.Unlock()
+
+	state := node.sync
+	if state == nil {
+		return false, nil
+	}
+	i, ok := state.index[block.Hash]
+	if !ok {
+		return false, nil
+	}
+	if i < state.applied {
+		return true, nil
+	}
+	// The header hash commits to the transactions, so the body must hash to it
+	if block.CalculateHash() != state.headers[i].Hash {
+		return true, fmt.Errorf("%w: body of %s does not match its header", chain.ErrInvalidBlock, block.Hash)
+	}
+	state.bodies[block.Hash] = block
+	delete(state.inFlight, block.Hash)
+	err := node.applySyncBodies(state, blockchain)
+	if err != nil || node.sync != state {
+		return true, err
+	}
+	if state.applied < len(state.headers) {
+		node.requestBodies(state, blockchain)
+		return true, nil
+	}
+
+	node.sync = nil
+	logger.Info("Synced", "peer", state.peer.ID, "height", blockchain.Len()-1, "block", blockchain.LastBlock().Hash)
+	node.relayBlock(state.peer, blockchain.LastBlock())
+	node.connectOrphans(blockchain.LastBlock().Hash, blockchain)
+	node.requestSyncFromAhead(blockchain)
+	return true, nil
+}
+
+// applySyncBodies connects the blocks whose bodies arrived in a row after the
+// connected ones and drops their bodies. It ends the synchronization if they
+// cannot be connected. It must be called with syncMutex held.
+func (node *Node) applySyncBodies(state *syncState, blockchain *chain.Blockchain) error {
+	end := state.applied
+	for end < len(state.headers) {
+		if _, ok := state.bodies[state.headers[end].Hash]; !ok {
+			break
+		}
+		end++
+	}
+	if end == state.applied {
+		return nil
+	}
+	parent := state.forkHash
+	if state.applied > 0 {
+		parent = state.headers[state.applied-1].Hash
+	}
+	blocks := make([]chain.Block, 0, end-state.applied)
+	for _, header := range state.headers[state.applied:end] {
+		blocks = append(blocks, state.bodies[header.Hash])
+	}
+	// Blocks relayed by other peers may have been connected meanwhile
+	for len(blocks) > 0 {
+		if _, ok := blockchain.HeightOf(blocks[0].Hash); !ok {
+			break
+		}
+		parent = blocks[0].Hash
+		blocks = blocks[1:]
+	}
+
+	switch {
+	case len(blocks) == 0:
+	case blockchain.LastBlock().Hash == parent:
+		for _, block := range blocks {
+			err := blockchain.AcceptBlock(block)
+			if err != nil && !errors.Is(err, chain.ErrKnownBlock) {
+				node.sync = nil
+				return err
+			}
+		}
+	default:
+		err := blockchain.ReplaceChain(parent, blocks)
+		if errors.Is(err, chain.ErrShorterChain) {
+			if end < len(state.headers) {
+				// The branch is not longer than our chain yet
+				return nil
+			}
+			// The chain of the peer may have grown while its blocks were downloaded
+			node.sync = nil
+			node.RequestSync(state.peer, blockchain)
+			return nil
+		}
+		if err != nil {
+			node.sync = nil
+			return err
+		}
+	}
+	for _, header := range state.headers[state.applied:end] {
+		delete(state.bodies, header.Hash)
+	}
+	state.applied = end
+	logger.Debug("Connected synced blocks", "peer", state.peer.ID, "height", blockchain.Len()-1)
+	return nil
+}
+
+// requestSyncFromAhead asks the peers known to be ahead of us for headers again,
+// their headers were ignored while another synchronization was running.
+func (node *Node) requestSyncFromAhead(blockchain *chain.Blockchain) {
+	height := int64(blockchain.Len() - 1)
+	for _, peer := range node.connectedPeers() {
+		if peer.bestHeight.Load() > height {
+			node.RequestSync(peer, blockchain)
+		}
+	}
+}
+
+// relayBlock announces block as a compact block to all peers except source.
+func (node *Node) relayBlock(source *Peer, block chain.Block) {
+	header := block.Header()
+	msg := Message{Type: MessageCompactBlock, Header: &header}
+	for i, t := range block.Transactions {
+		// System transactions are never in the pool of the receiver
+		if t.FromAddress == "" {
+			msg.Prefilled = append(msg.Prefilled, PrefilledTransaction{Index: i, Transaction: t})
+		} else {
+			msg.ShortIDs = append(msg.ShortIDs, ShortTransactionID(block.Hash, t.TransactionId))
+		}
+	}
+	for _, peer := range node.connectedPeers() {
+		if peer != source {
+			node.sendMessage(peer, msg)
+		}
+	}
+}
+
+func (node *Node) handleCompactBlock(peer *Peer, header chain.BlockHeader, shortIDs []string, prefilled []PrefilledTransaction, blockchain *chain.Blockchain) error {
+	if height, ok := blockchain.HeightOf(header.Hash); ok {
+		peer.observeHeight(height)
+		return nil
+	}
+	if parentHeight, ok := blockchain.HeightOf(header.PreviousHash); ok {
+		peer.observeHeight(parentHeight + 1)
+	}
+	err := blockchain.ValidateHeaders(header.PreviousHash, []chain.BlockHeader{header})
+	if err != nil {
+		return err
+	}
+	if len(shortIDs)+len(prefilled) != header.TransactionCount {
+		return fmt.Errorf("%w: compact block %s has the wrong number of transactions", chain.ErrInvalidBlock, header.Hash)
+	}
+
+	transactions := make([]*chain.Transaction, header.TransactionCount)
+	for _, p := range prefilled {
+		if p.Index < 0 || p.Index >= len(transactions) || transactions[p.Index] != nil {
+			return fmt.Errorf("%w: compact block %s has an invalid prefilled index", chain.ErrInvalidBlock, header.Hash)
+		}
+		t := p.Transaction
+		transactions[p.Index] = &t
+	}
+	pool := make(map[string]chain.Transaction)
+	for _, t := range blockchain.GetPendingTransactions() {
+		pool[ShortTransactionID(header.Hash, t.TransactionId)] = t
+	}
+	var missing []int
+	next := 0
+	for i := range transactions {
+		if transactions[i] != nil {
+			continue
+		}
+		if t, ok := pool[shortIDs[next]]; ok {
+			transactions[i] = &t
+		} else {
+			missing = append(missing, i)
+		}
+		next++
+	}
+
+	if len(missing) == 0 {
+		return node.handleBlock(peer, assembleBlock(header, transactions), blockchain)
+	}
+
+	node.syncMutex.Lock()
+	if len(node.partials) >= maxPartialBlocks {
+		for hash := range node.partials {
+			delete(node.partials, hash)
+			break
+		}
+	}
+	node.partials[header.Hash] = &partialBlock{header: header, transactions: transactions, peer: peer}
+	node.syncMutex.Unlock()
+
+	node.sendMessage(peer, Message{Type: MessageGetBlockTransactions, Hash: header.Hash, Indexes: missing})
+	return nil
+}
+
+func (node *Node) handleGetBlockTransactions(peer *Peer, hash string, indexes []int, blockchain *chain.Blockchain) {
+	block, ok := blockchain.GetBlockByHash(hash)
+	if !ok {
+		node.sendMessage(peer, Message{Type: MessageNotFound, Hashes: []string{hash}})
+		return
+	}
+	var transactions []chain.Transaction
+	for _, i := range indexes {
+		if i >= 0 && i < len(block.Transactions) {
+			transactions = append(transactions, block.Transactions[i])
+		}
+	}
+	node.sendMessage(peer, Message{Type: MessageBlockTransactions, Hash: hash, Transactions: transactions})
+}
+
+func (node *Node) handleBlockTransactions(peer *Peer, hash string, transactions []chain.Transaction, blockchain *chain.Blockchain) error {
+	node.syncMutex.Lock()
+	partial, ok := node.partials[hash]
+	delete(node.partials, hash)
+	node.syncMutex.Unlock()
+	if !ok {
+		return nil
+	}
+
+	next := 0
+	for i := range partial.transactions {
+		if partial.transactions[i] != nil {
+			continue
+		}
+		if next >= len(transactions) {
+			return fmt.Errorf("%w: missing transactions of compact block %s", chain.ErrInvalidBlock, hash)
+		}
+		t := transactions[next]
+		partial.transactions[i] = &t
+		next++
+	}
+	return node.handleBlock(peer, assembleBlock(partial.header, partial.transactions), blockchain)
+}
+
+func assembleBlock(header chain.BlockHeader, transactions []*chain.Transaction) chain.Block {
+	block := chain.Block{
+		Transactions: make([]chain.Transaction, len(transactions)),
+		Timestamp:    header.Timestamp,
+		PreviousHash: header.PreviousHash,
+		Nonce:        header.Nonce,
+		Hash:         header.Hash,
+		Capacity:     header.Capacity,
+	}
+	for i, t := range transactions {
+		block.Transactions[i] = *t
+	}
+	return block
+}
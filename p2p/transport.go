@@ -0,0 +1,141 @@
+package p2p
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// Transport opens the raw connections a Node runs its TLS handshake over.
+type Transport interface {
+	Listen(address string) (net.Listener, error)
+	Dial(address string) (net.Conn, error)
+}
+
+type TCPTransport struct{}
+
+func (TCPTransport) Listen(address string) (net.Listener, error) {
+	return net.Listen("tcp", address)
+}
+
+func (TCPTransport) Dial(address string) (net.Conn, error) {
+	return net.Dial("tcp", address)
+}
+
+var ErrConnectionRefused = errors.New("connection refused")
+
+// MemoryNetwork connects MemoryTransports in the same process through net.Pipe.
+// Addresses are arbitrary strings that only have to be unique in the network.
+type MemoryNetwork struct {
+	mutex     sync.Mutex
+	listeners map[string]*memoryListener
+}
+
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{listeners: make(map[string]*memoryListener)}
+}
+
+// Transport returns a transport whose dialed connections report localAddress as
+// their local address, so the accepting side knows who is calling.
+func (network *MemoryNetwork) Transport(localAddress string) *MemoryTransport {
+	return &MemoryTransport{network: network, address: localAddress}
+}
+
+type MemoryTransport struct {
+	network *MemoryNetwork
+	address string
+}
+
+func (transport *MemoryTransport) Listen(address string) (net.Listener, error) {
+	network := transport.network
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+
+	if _, ok := network.listeners[address]; ok {
+		return nil, errors.New("address already in use: " + address)
+	}
+	listener := &memoryListener{
+		network: network,
+		address: memoryAddr(address),
+		conns:   make(chan net.Conn),
+		closed:  make(chan struct{}),
+	}
+	network.listeners[address] = listener
+	return listener, nil
+}
+
+func (transport *MemoryTransport) Dial(address string) (net.Conn, error) {
+	network := transport.network
+	network.mutex.Lock()
+	listener, ok := network.listeners[address]
+	network.mutex.Unlock()
+	if !ok {
+		return nil, ErrConnectionRefused
+	}
+
+	client, server := net.Pipe()
+	local, remote := memoryAddr(transport.address), memoryAddr(address)
+	select {
+	case listener.conns <- &memoryConn{Conn: server, local: remote, remote: local}:
+		return &memoryConn{Conn: client, local: local, remote: remote}, nil
+	case <-listener.closed:
+		client.Close()
+		server.Close()
+		return nil, ErrConnectionRefused
+	}
+}
+
+type memoryListener struct {
+	network   *MemoryNetwork
+	address   memoryAddr
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (listener *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-listener.conns:
+		return conn, nil
+	case <-listener.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (listener *memoryListener) Close() error {
+	listener.closeOnce.Do(func() {
+		listener.network.mutex.Lock()
+		delete(listener.network.listeners, string(listener.address))
+		listener.network.mutex.Unlock()
+		close(listener.closed)
+	})
+	return nil
+}
+
+func (listener *memoryListener) Addr() net.Addr {
+	return listener.address
+}
+
+type memoryAddr string
+
+func (addr memoryAddr) Network() string {
+	return "memory"
+}
+
+func (addr memoryAddr) String() string {
+	return string(addr)
+}
+
+type memoryConn struct {
+	net.Conn
+	local  memoryAddr
+	remote memoryAddr
+}
+
+func (conn *memoryConn) LocalAddr() net.Addr {
+	return conn.local
+}
+
+func (conn *memoryConn) RemoteAddr() net.Addr {
+	return conn.remote
+}
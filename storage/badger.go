@@ -1,24 +1,54 @@
 package storage
 
 import (
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"blockchain/chain"
+	"blockchain/logging"
 
 	"github.com/dgraph-io/badger/v4"
 )
 
+// Types of storage a node can run on. The memory storage loses the chain when
+// the node stops.
 const (
-	blockPrefix       = "block_"
-	transactionPrefix = "tx_"
-	seqPrefix         = "seq_"
-	blockSeqKey       = "seq_block_sequence"
-	txSeqKey          = "seq_tx_sequence"
+	TypeBadger = "badger"
+	TypeMemory = "memory"
 )
 
-func keyHasPrefix(key, prefix string) bool {
-	return len(key) >= len(prefix) && key[:len(prefix)] == prefix
+// Keys of the chain, under the namespace of the current chain. Blocks are keyed
+// by their height as a fixed-width big-endian number, so they sort in chain
+// order, and tipKey points at the last one. Pool entries are keyed by the
+// transaction ID, so they can be removed when the transaction is mined.
+const (
+	blockPrefix = "blk_"
+	poolPrefix  = "pool_"
+	seqPrefix   = "seq_"
+	poolSeqKey  = "seq_pool"
+	tipKey      = "tip"
+)
+
+// tipEntry is the value of tipKey.
+type tipEntry struct {
+	Height int    `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// poolEntry is a pending transaction, Seq keeps the order it arrived in.
+type poolEntry struct {
+	Seq         int64             `json:"seq"`
+	Transaction chain.Transaction `json:"transaction"`
+}
+
+func blockKey(height int) string {
+	return blockPrefix + string(binary.BigEndian.AppendUint64(nil, uint64(height)))
 }
 
 func (bs *Storage) getNextSeq(txn *badger.Txn, seqKey string) (int64, error) {
@@ -47,115 +77,228 @@ func (bs *Storage) setNextSeq(txn *badger.Txn, seqKey string, seq int64) error {
 	return txn.Set([]byte(seqKey), seqData)
 }
 
+var logger = logging.For(logging.SubsystemStorage)
+
 type Storage struct {
 	db *badger.DB
+	// ns is the namespace of the current chain, it is only changed by Reset
+	ns atomic.Pointer[namespace]
+	// dryRun is set while Migrate checks migrations without applying them
+	dryRun bool
+	// failPoint, if set by a test, is called before each step of Reset and
+	// aborts it with the error it returns, like a crash would
+	failPoint func(step string) error
 }
 
+// NewBadgerStorage opens the database at path and migrates it to SchemaVersion.
+// It fails with ErrNewerSchema for databases written by a newer version and with
+// ErrUnsupportedSchema for ones too old to migrate.
 func NewBadgerStorage(path string) (*Storage, error) {
-	opts := badger.DefaultOptions(path)
-	db, err := badger.Open(opts)
+	db, err := openDB(path)
 	if err != nil {
 		return nil, err
 	}
-	return &Storage{db: db}, nil
+	bs := &Storage{db: db}
+	err = bs.openNamespace()
+	if err == nil {
+		_, err = bs.migrate(migrations, SchemaVersion)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return bs, nil
 }
 
-func (bs *Storage) Close() {
-	bs.db.Close()
+func openDB(path string) (*badger.DB, error) {
+	return badger.Open(badger.DefaultOptions(path).WithLogger(badgerLogger{}))
 }
 
-func (bs *Storage) Load(difficulty, maxBlockSize int, miningReward float64) (*chain.Blockchain, error) {
-	blockchain := &chain.Blockchain{Storage: bs}
+// badgerLogger passes the messages of Badger on to the storage logger. Its
+// informational messages are frequent and only of interest when debugging.
+type badgerLogger struct{}
 
-	err := bs.db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchValues = true
-		it := txn.NewIterator(opts)
-		defer it.Close()
+func (badgerLogger) Errorf(format string, args ...any) {
+	logger.Error(strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
 
-		for it.Rewind(); it.Valid(); it.Next() {
-			item := it.Item()
-			err := item.Value(func(val []byte) error {
-				key := string(item.Key())
-				if keyHasPrefix(key, blockPrefix) {
-					var block chain.Block
-					if err := json.Unmarshal(val, &block); err != nil {
-						return err
-					}
-					blockchain.Blocks = append(blockchain.Blocks, block)
-				} else if keyHasPrefix(key, transactionPrefix) {
-					var transaction chain.Transaction
-					if err := json.Unmarshal(val, &transaction); err != nil {
-						return err
-					}
-					blockchain.PendingTransactions = append(blockchain.PendingTransactions, transaction)
-				}
-				return nil
-			})
-			if err != nil {
-				return err
-			}
-		}
-		return nil
-	})
+func (badgerLogger) Warningf(format string, args ...any) {
+	logger.Warn(strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func (badgerLogger) Infof(format string, args ...any) {
+	logger.Debug(strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
 
+func (badgerLogger) Debugf(format string, args ...any) {
+	logger.Debug(strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func (bs *Storage) Close() {
+	bs.db.Close()
+}
+
+// Shutdown flushes the database to disk and closes it. It stops waiting when ctx
+// is done, Badger then replays its value log on the next start.
+func (bs *Storage) Shutdown(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		err := bs.db.Sync()
+		done <- errors.Join(err, bs.db.Close())
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Load returns the chain with its pool. Blocks are not read, the chain asks for
+// them when it needs them.
+func (bs *Storage) Load(params chain.ChainParams) (*chain.Blockchain, error) {
+	pool, err := bs.pool(bs.namespace())
 	if err != nil {
 		return nil, err
 	}
-
-	blockchain.Difficulty = difficulty
-	blockchain.MaxBlockSize = maxBlockSize
-	blockchain.MiningReward = miningReward
-
+	blockchain := &chain.Blockchain{Storage: bs, PendingTransactions: pool}
+	blockchain.SetParams(params)
 	return blockchain, nil
 }
 
-func (bs *Storage) AddBlock(b chain.Block) error {
-	err := bs.db.Update(func(txn *badger.Txn) error {
-		seq, err := bs.getNextSeq(txn, blockSeqKey)
+func (bs *Storage) Tip() (chain.Block, int, error) {
+	var block chain.Block
+	var tip tipEntry
+	ns := bs.namespace()
+	err := bs.db.View(func(txn *badger.Txn) error {
+		err := getJSON(txn, ns.key(tipKey), &tip)
 		if err != nil {
 			return err
 		}
+		return getJSON(txn, ns.key(blockKey(tip.Height)), &block)
+	})
+	return block, tip.Height, err
+}
 
-		blockData, err := json.Marshal(b)
-		if err != nil {
-			return err
-		}
+func (bs *Storage) AddBlock(b chain.Block) error {
+	ns := bs.namespace()
+	return bs.db.Update(func(txn *badger.Txn) error {
+		return bs.addBlock(txn, ns, b)
+	})
+}
+
+// addBlock stores b on top of the tip of ns.
+func (bs *Storage) addBlock(txn *badger.Txn, ns namespace, b chain.Block) error {
+	var tip tipEntry
+	height := 0
+	err := getJSON(txn, ns.key(tipKey), &tip)
+	if err == nil {
+		height = tip.Height + 1
+	} else if !errors.Is(err, chain.ErrNotFound) {
+		return err
+	}
+	return bs.putBlock(txn, ns, b, height)
+}
 
-		key := fmt.Sprintf("%s%06d_%s", blockPrefix, seq, b.Hash)
-		err = txn.Set([]byte(key), blockData)
+// putBlock stores b at height with its index entries, removes its transactions
+// from the pool and makes it the tip.
+func (bs *Storage) putBlock(txn *badger.Txn, ns namespace, b chain.Block, height int) error {
+	err := setJSON(txn, ns.key(blockKey(height)), b)
+	if err != nil {
+		return err
+	}
+	err = bs.indexBlock(txn, ns, b, height)
+	if err != nil {
+		return err
+	}
+	for _, t := range b.Transactions {
+		err = txn.Delete([]byte(ns.key(poolPrefix + t.TransactionId)))
 		if err != nil {
 			return err
 		}
+	}
+	return setJSON(txn, ns.key(tipKey), tipEntry{Height: height, Hash: b.Hash})
+}
 
-		return bs.setNextSeq(txn, blockSeqKey, seq)
+// ReplaceBlocks switches to another branch in a single transaction. A branch too
+// long for one transaction is written like Reset, copying the common blocks.
+func (bs *Storage) ReplaceBlocks(forkHeight int, blocks []chain.Block, restored []chain.Transaction) error {
+	ns := bs.namespace()
+	err := bs.db.Update(func(txn *badger.Txn) error {
+		return bs.replaceBlocks(txn, ns, forkHeight, blocks, restored)
 	})
-
+	if errors.Is(err, badger.ErrTxnTooBig) {
+		logger.Info("Branch is too long for one transaction, rewriting the chain", "fork", forkHeight, "blocks", len(blocks))
+		return bs.rewriteBranch(ns, forkHeight, blocks, restored)
+	}
 	return err
 }
 
-func (bs *Storage) AddTransaction(t chain.Transaction) error {
-	err := bs.db.Update(func(txn *badger.Txn) error {
-		seq, err := bs.getNextSeq(txn, txSeqKey)
+func (bs *Storage) replaceBlocks(txn *badger.Txn, ns namespace, forkHeight int, blocks []chain.Block, restored []chain.Transaction) error {
+	var tip tipEntry
+	err := getJSON(txn, ns.key(tipKey), &tip)
+	if err != nil {
+		return err
+	}
+	if forkHeight > tip.Height {
+		return fmt.Errorf("fork height %d is above the tip at %d", forkHeight, tip.Height)
+	}
+	for height := tip.Height; height > forkHeight; height-- {
+		var block chain.Block
+		err := getJSON(txn, ns.key(blockKey(height)), &block)
 		if err != nil {
 			return err
 		}
-
-		txData, err := json.Marshal(t)
+		err = bs.unindexBlock(txn, ns, block, height)
 		if err != nil {
 			return err
 		}
-
-		key := fmt.Sprintf("%s%06d_%s", transactionPrefix, seq, t.TransactionId)
-		err = txn.Set([]byte(key), txData)
+		err = txn.Delete([]byte(ns.key(blockKey(height))))
+		if err != nil {
+			return err
+		}
+	}
+	var fork chain.Block
+	err = getJSON(txn, ns.key(blockKey(forkHeight)), &fork)
+	if err != nil {
+		return err
+	}
+	err = setJSON(txn, ns.key(tipKey), tipEntry{Height: forkHeight, Hash: fork.Hash})
+	if err != nil {
+		return err
+	}
+	for i, block := range blocks {
+		err := bs.putBlock(txn, ns, block, forkHeight+1+i)
+		if err != nil {
+			return err
+		}
+	}
+	for _, t := range restored {
+		err := bs.addTransaction(txn, ns, t)
 		if err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		return bs.setNextSeq(txn, txSeqKey, seq)
+func (bs *Storage) AddTransaction(t chain.Transaction) error {
+	ns := bs.namespace()
+	return bs.db.Update(func(txn *badger.Txn) error {
+		return bs.addTransaction(txn, ns, t)
 	})
+}
 
-	return err
+func (bs *Storage) addTransaction(txn *badger.Txn, ns namespace, t chain.Transaction) error {
+	seq, err := bs.getNextSeq(txn, ns.key(poolSeqKey))
+	if err != nil {
+		return err
+	}
+	err = setJSON(txn, ns.key(poolPrefix+t.TransactionId), poolEntry{Seq: seq, Transaction: t})
+	if err != nil {
+		return err
+	}
+	return bs.setNextSeq(txn, ns.key(poolSeqKey), seq)
 }
 
 func (storage *Storage) deleteByPrefix(prefix []byte) error {
@@ -210,44 +353,16 @@ func (storage *Storage) deleteByPrefix(prefix []byte) error {
 	return nil
 }
 
-func (bs *Storage) Reset(chain *chain.Blockchain) error {
-	err := bs.db.Update(func(txn *badger.Txn) error {
-		err := bs.deleteByPrefix([]byte(blockPrefix))
-		if err != nil {
-			return err
-		}
-		err = bs.deleteByPrefix([]byte(transactionPrefix))
-		if err != nil {
-			return err
-		}
-		err = bs.deleteByPrefix([]byte(seqPrefix))
-		if err != nil {
-			return err
-		}
-		return nil
-	})
+const healthCheckKey = "health_check"
 
-	if err != nil {
-		return err
+// CheckWritable writes a short-lived key to make sure the database still accepts
+// writes.
+func (bs *Storage) CheckWritable() error {
+	if bs.db.IsClosed() {
+		return errors.New("database is closed")
 	}
-
-	err = bs.db.Update(func(txn *badger.Txn) error {
-		for _, block := range chain.Blocks {
-			err := bs.AddBlock(block)
-			if err != nil {
-				return err
-			}
-		}
-
-		for _, transaction := range chain.PendingTransactions {
-			err := bs.AddTransaction(transaction)
-			if err != nil {
-				return err
-			}
-		}
-
-		return nil
+	return bs.db.Update(func(txn *badger.Txn) error {
+		value := []byte(time.Now().UTC().Format(time.RFC3339Nano))
+		return txn.SetEntry(badger.NewEntry([]byte(healthCheckKey), value).WithTTL(time.Minute))
 	})
-
-	return err
 }
@@ -0,0 +1,20 @@
+package storage_test
+
+import (
+	"testing"
+
+	"blockchain/chain"
+	"blockchain/storage"
+	"blockchain/storage/storagetest"
+)
+
+func TestBadgerConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) chain.Storage {
+		s, err := storage.NewBadgerStorage(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(s.Close)
+		return s
+	})
+}
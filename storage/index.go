@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"blockchain/chain"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// The explorer indexes are written in the same transaction as the block they
+// describe. Addresses are PEM encoded keys, so their keys use a hash of them.
+const (
+	indexPrefix        = "idx_"
+	hashIndexPrefix    = "idx_hash_"
+	txIndexPrefix      = "idx_tx_"
+	addressIndexPrefix = "idx_addrtx_"
+	summaryIndexPrefix = "idx_balance_"
+)
+
+// txIndexEntry is where a transaction is: the block key is built from the height
+// without another lookup.
+type txIndexEntry struct {
+	Height int    `json:"height"`
+	Hash   string `json:"hash"`
+	Index  int    `json:"index"`
+}
+
+func addressKey(address string) string {
+	sum := sha256.Sum256([]byte(address))
+	return hex.EncodeToString(sum[:])
+}
+
+func addressTransactionsPrefix(address string) string {
+	return addressIndexPrefix + addressKey(address) + "_"
+}
+
+func getJSON(txn *badger.Txn, key string, value any) error {
+	item, err := txn.Get([]byte(key))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return chain.ErrNotFound
+		}
+		return err
+	}
+	return item.Value(func(val []byte) error {
+		return json.Unmarshal(val, value)
+	})
+}
+
+func setJSON(txn *badger.Txn, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return txn.Set([]byte(key), data)
+}
+
+// indexBlock adds the index entries of block at height.
+func (bs *Storage) indexBlock(txn *badger.Txn, ns namespace, block chain.Block, height int) error {
+	err := setJSON(txn, ns.key(hashIndexPrefix+block.Hash), height)
+	if err != nil {
+		return err
+	}
+	for i, t := range block.Transactions {
+		entry := txIndexEntry{Height: height, Hash: block.Hash, Index: i}
+		err = setJSON(txn, ns.key(txIndexPrefix+t.TransactionId), entry)
+		if err != nil {
+			return err
+		}
+		err = bs.indexAddress(txn, ns, t.ToAddress, entry, t.Amount)
+		if err != nil {
+			return err
+		}
+		// A transaction to the sender itself counts once, as a credit, like in
+		// Blockchain.GetBalance
+		if t.FromAddress != t.ToAddress {
+			err = bs.indexAddress(txn, ns, t.FromAddress, entry, -t.Amount)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (bs *Storage) indexAddress(txn *badger.Txn, ns namespace, address string, entry txIndexEntry, amount float64) error {
+	if address == "" {
+		return nil
+	}
+	var summary chain.AddressSummary
+	err := getJSON(txn, ns.key(summaryIndexPrefix+addressKey(address)), &summary)
+	if err != nil && !errors.Is(err, chain.ErrNotFound) {
+		return err
+	}
+	summary.Balance += amount
+	summary.TransactionCount++
+	err = setJSON(txn, ns.key(summaryIndexPrefix+addressKey(address)), summary)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s%012d_%06d", addressTransactionsPrefix(address), entry.Height, entry.Index)
+	return setJSON(txn, ns.key(key), entry)
+}
+
+// unindexBlock removes the index entries of block at height, it undoes
+// indexBlock when the block is replaced by another branch.
+func (bs *Storage) unindexBlock(txn *badger.Txn, ns namespace, block chain.Block, height int) error {
+	err := txn.Delete([]byte(ns.key(hashIndexPrefix + block.Hash)))
+	if err != nil {
+		return err
+	}
+	for i, t := range block.Transactions {
+		err = txn.Delete([]byte(ns.key(txIndexPrefix + t.TransactionId)))
+		if err != nil {
+			return err
+		}
+		entry := txIndexEntry{Height: height, Hash: block.Hash, Index: i}
+		err = bs.unindexAddress(txn, ns, t.ToAddress, entry, t.Amount)
+		if err != nil {
+			return err
+		}
+		if t.FromAddress != t.ToAddress {
+			err = bs.unindexAddress(txn, ns, t.FromAddress, entry, -t.Amount)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (bs *Storage) unindexAddress(txn *badger.Txn, ns namespace, address string, entry txIndexEntry, amount float64) error {
+	if address == "" {
+		return nil
+	}
+	var summary chain.AddressSummary
+	err := getJSON(txn, ns.key(summaryIndexPrefix+addressKey(address)), &summary)
+	if err != nil {
+		return err
+	}
+	summary.Balance -= amount
+	summary.TransactionCount--
+	if summary.TransactionCount > 0 {
+		err = setJSON(txn, ns.key(summaryIndexPrefix+addressKey(address)), summary)
+	} else {
+		err = txn.Delete([]byte(ns.key(summaryIndexPrefix + addressKey(address))))
+	}
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s%012d_%06d", addressTransactionsPrefix(address), entry.Height, entry.Index)
+	return txn.Delete([]byte(ns.key(key)))
+}
+
+func (bs *Storage) blockByHeight(txn *badger.Txn, ns namespace, height int) (chain.Block, error) {
+	var block chain.Block
+	err := getJSON(txn, ns.key(blockKey(height)), &block)
+	return block, err
+}
+
+func (bs *Storage) BlockByHeight(height int) (chain.Block, error) {
+	var block chain.Block
+	ns := bs.namespace()
+	err := bs.db.View(func(txn *badger.Txn) error {
+		var err error
+		block, err = bs.blockByHeight(txn, ns, height)
+		return err
+	})
+	return block, err
+}
+
+func (bs *Storage) BlockByHash(hash string) (chain.Block, int, error) {
+	var block chain.Block
+	var height int
+	ns := bs.namespace()
+	err := bs.db.View(func(txn *badger.Txn) error {
+		err := getJSON(txn, ns.key(hashIndexPrefix+hash), &height)
+		if err != nil {
+			return err
+		}
+		block, err = bs.blockByHeight(txn, ns, height)
+		return err
+	})
+	return block, height, err
+}
+
+func (bs *Storage) HeightByHash(hash string) (int, error) {
+	var height int
+	ns := bs.namespace()
+	err := bs.db.View(func(txn *badger.Txn) error {
+		return getJSON(txn, ns.key(hashIndexPrefix+hash), &height)
+	})
+	return height, err
+}
+
+// location resolves an index entry to the transaction it points at.
+func (bs *Storage) location(txn *badger.Txn, ns namespace, entry txIndexEntry) (chain.TransactionLocation, error) {
+	block, err := bs.blockByHeight(txn, ns, entry.Height)
+	if err != nil {
+		return chain.TransactionLocation{}, err
+	}
+	if entry.Index >= len(block.Transactions) {
+		return chain.TransactionLocation{}, chain.ErrNotFound
+	}
+	return chain.TransactionLocation{
+		Transaction: block.Transactions[entry.Index],
+		BlockHash:   entry.Hash,
+		BlockHeight: entry.Height,
+		Index:       entry.Index,
+	}, nil
+}
+
+func (bs *Storage) TransactionByID(id string) (chain.TransactionLocation, error) {
+	var location chain.TransactionLocation
+	ns := bs.namespace()
+	err := bs.db.View(func(txn *badger.Txn) error {
+		var entry txIndexEntry
+		err := getJSON(txn, ns.key(txIndexPrefix+id), &entry)
+		if err != nil {
+			return err
+		}
+		location, err = bs.location(txn, ns, entry)
+		return err
+	})
+	return location, err
+}
+
+func (bs *Storage) AddressTransactions(address string, offset, limit int) ([]chain.TransactionLocation, error) {
+	locations := []chain.TransactionLocation{}
+	ns := bs.namespace()
+	err := bs.db.View(func(txn *badger.Txn) error {
+		prefix := []byte(ns.key(addressTransactionsPrefix(address)))
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		// Reverse iteration starts at the last key not greater than the seek key
+		skipped := 0
+		for it.Seek(append(prefix, 0xff)); it.ValidForPrefix(prefix) && len(locations) < limit; it.Next() {
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			var entry txIndexEntry
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &entry)
+			})
+			if err != nil {
+				return err
+			}
+			location, err := bs.location(txn, ns, entry)
+			if err != nil {
+				return err
+			}
+			locations = append(locations, location)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+func (bs *Storage) AddressSummary(address string) (chain.AddressSummary, error) {
+	var summary chain.AddressSummary
+	ns := bs.namespace()
+	err := bs.db.View(func(txn *badger.Txn) error {
+		err := getJSON(txn, ns.key(summaryIndexPrefix+addressKey(address)), &summary)
+		if errors.Is(err, chain.ErrNotFound) {
+			return nil
+		}
+		return err
+	})
+	return summary, err
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"blockchain/chain"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Mining jobs are written with a TTL, Badger hides them once it runs out and
+// drops them on compaction.
+const jobPrefix = "job_"
+
+// SaveMiningJob stores job, replacing the previous version with the same ID, and
+// keeps it for ttl from now.
+func (bs *Storage) SaveMiningJob(job chain.MiningJob, ttl time.Duration) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return bs.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry([]byte(jobPrefix+job.ID), data).WithTTL(ttl))
+	})
+}
+
+func (bs *Storage) MiningJob(id string) (chain.MiningJob, error) {
+	var job chain.MiningJob
+	err := bs.db.View(func(txn *badger.Txn) error {
+		return getJSON(txn, jobPrefix+id, &job)
+	})
+	return job, err
+}
+
+// MiningJobs lists the stored jobs newest first, along with their total number.
+func (bs *Storage) MiningJobs(offset, limit int) ([]chain.MiningJob, int, error) {
+	var jobs []chain.MiningJob
+	err := bs.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(jobPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			var job chain.MiningJob
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &job)
+			})
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartedAt.After(jobs[j].StartedAt) })
+	total := len(jobs)
+	if offset >= total {
+		return []chain.MiningJob{}, total, nil
+	}
+	return jobs[offset:min(offset+limit, total)], total, nil
+}
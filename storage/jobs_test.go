@@ -0,0 +1,93 @@
+package storage_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"blockchain/chain"
+	"blockchain/storage"
+)
+
+type jobStore interface {
+	SaveMiningJob(job chain.MiningJob, ttl time.Duration) error
+	MiningJob(id string) (chain.MiningJob, error)
+	MiningJobs(offset, limit int) ([]chain.MiningJob, int, error)
+}
+
+func TestMiningJobs(t *testing.T) {
+	backends := []struct {
+		name string
+		open func(t *testing.T) jobStore
+	}{
+		{storage.TypeBadger, func(t *testing.T) jobStore {
+			s, err := storage.NewBadgerStorage(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(s.Close)
+			return s
+		}},
+		{storage.TypeMemory, func(t *testing.T) jobStore {
+			return storage.NewMemoryStorage()
+		}},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			s := backend.open(t)
+			started := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			saves := []struct {
+				id     string
+				status string
+				after  time.Duration
+				ttl    time.Duration
+			}{
+				{"first", "pending", 0, time.Hour},
+				// Expires right away
+				{"second", "pending", time.Minute, time.Nanosecond},
+				{"third", "pending", 2 * time.Minute, time.Hour},
+				// Replaces the first version
+				{"first", "successful", 0, time.Hour},
+			}
+			for _, save := range saves {
+				job := chain.MiningJob{ID: save.id, Status: save.status, StartedAt: started.Add(save.after)}
+				err := s.SaveMiningJob(job, save.ttl)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			job, err := s.MiningJob("first")
+			if err != nil || job.Status != "successful" {
+				t.Fatalf("first job is %+v (%v), want the successful version", job, err)
+			}
+			_, err = s.MiningJob("second")
+			if !errors.Is(err, chain.ErrNotFound) {
+				t.Fatalf("expired job: got error %v, want %v", err, chain.ErrNotFound)
+			}
+
+			pages := []struct {
+				offset, limit int
+				want          []string
+			}{
+				{0, 10, []string{"third", "first"}},
+				{1, 1, []string{"first"}},
+				{2, 10, []string{}},
+			}
+			for _, page := range pages {
+				jobs, total, err := s.MiningJobs(page.offset, page.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := []string{}
+				for _, job := range jobs {
+					got = append(got, job.ID)
+				}
+				if total != 2 || !reflect.DeepEqual(got, page.want) {
+					t.Errorf("jobs at offset %d, limit %d are %v of %d, want %v of 2", page.offset, page.limit, got, total, page.want)
+				}
+			}
+		})
+	}
+}
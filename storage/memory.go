@@ -0,0 +1,347 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"blockchain/chain"
+)
+
+// MemoryStorage keeps the chain in memory with the semantics of the Badger
+// storage: blocks by height below a tip, the pool in arrival order and indexes
+// that change together with the blocks they describe. Every change is applied
+// under one lock after it was checked, so it is applied completely or not at
+// all. It is meant for tests and throwaway networks.
+type MemoryStorage struct {
+	mutex sync.RWMutex
+	state memoryState
+	// jobs are the mining jobs with their expiry, Reset keeps them like the
+	// Badger storage does
+	jobs map[string]memoryJob
+}
+
+type memoryJob struct {
+	job     chain.MiningJob
+	expires time.Time
+}
+
+type memoryState struct {
+	blocks  []chain.Block
+	heights map[string]int
+	// transactions and addresses are the indexes of Storage, addresses lists
+	// the entries of an address oldest first
+	transactions map[string]txIndexEntry
+	addresses    map[string][]txIndexEntry
+	summaries    map[string]chain.AddressSummary
+	pool         map[string]poolEntry
+	poolSeq      int64
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{state: newMemoryState(), jobs: make(map[string]memoryJob)}
+}
+
+func newMemoryState() memoryState {
+	return memoryState{
+		heights:      make(map[string]int),
+		transactions: make(map[string]txIndexEntry),
+		addresses:    make(map[string][]txIndexEntry),
+		summaries:    make(map[string]chain.AddressSummary),
+		pool:         make(map[string]poolEntry),
+	}
+}
+
+func (ms *MemoryStorage) Load(params chain.ChainParams) (*chain.Blockchain, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	entries := make([]poolEntry, 0, len(ms.state.pool))
+	for _, entry := range ms.state.pool {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+	blockchain := &chain.Blockchain{Storage: ms}
+	for _, entry := range entries {
+		blockchain.PendingTransactions = append(blockchain.PendingTransactions, entry.Transaction)
+	}
+	blockchain.SetParams(params)
+	return blockchain, nil
+}
+
+func (ms *MemoryStorage) Tip() (chain.Block, int, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	if len(ms.state.blocks) == 0 {
+		return chain.Block{}, 0, chain.ErrNotFound
+	}
+	height := len(ms.state.blocks) - 1
+	return ms.state.blocks[height], height, nil
+}
+
+func (ms *MemoryStorage) AddBlock(b chain.Block) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.state.putBlock(b)
+	return nil
+}
+
+func (ms *MemoryStorage) AddTransaction(t chain.Transaction) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.state.addTransaction(t)
+	return nil
+}
+
+func (ms *MemoryStorage) ReplaceBlocks(forkHeight int, blocks []chain.Block, restored []chain.Transaction) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	tip := len(ms.state.blocks) - 1
+	if tip < 0 || forkHeight < 0 {
+		return chain.ErrNotFound
+	}
+	if forkHeight > tip {
+		return fmt.Errorf("fork height %d is above the tip at %d", forkHeight, tip)
+	}
+	for height := tip; height > forkHeight; height-- {
+		ms.state.unindexBlock(ms.state.blocks[height], height)
+	}
+	ms.state.blocks = ms.state.blocks[:forkHeight+1]
+	for _, block := range blocks {
+		ms.state.putBlock(block)
+	}
+	for _, t := range restored {
+		ms.state.addTransaction(t)
+	}
+	return nil
+}
+
+func (ms *MemoryStorage) Reset(blocks []chain.Block, pool []chain.Transaction) error {
+	state := newMemoryState()
+	for _, block := range blocks {
+		state.putBlock(block)
+	}
+	for _, t := range pool {
+		state.addTransaction(t)
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.state = state
+	return nil
+}
+
+func (ms *MemoryStorage) BlockByHeight(height int) (chain.Block, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	if height < 0 || height >= len(ms.state.blocks) {
+		return chain.Block{}, chain.ErrNotFound
+	}
+	return ms.state.blocks[height], nil
+}
+
+func (ms *MemoryStorage) BlockByHash(hash string) (chain.Block, int, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	height, ok := ms.state.heights[hash]
+	if !ok {
+		return chain.Block{}, 0, chain.ErrNotFound
+	}
+	return ms.state.blocks[height], height, nil
+}
+
+func (ms *MemoryStorage) HeightByHash(hash string) (int, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	height, ok := ms.state.heights[hash]
+	if !ok {
+		return 0, chain.ErrNotFound
+	}
+	return height, nil
+}
+
+func (ms *MemoryStorage) TransactionByID(id string) (chain.TransactionLocation, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	entry, ok := ms.state.transactions[id]
+	if !ok {
+		return chain.TransactionLocation{}, chain.ErrNotFound
+	}
+	return ms.state.location(entry)
+}
+
+func (ms *MemoryStorage) AddressTransactions(address string, offset, limit int) ([]chain.TransactionLocation, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	locations := []chain.TransactionLocation{}
+	entries := ms.state.addresses[address]
+	for i := len(entries) - 1 - offset; i >= 0 && len(locations) < limit; i-- {
+		location, err := ms.state.location(entries[i])
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, location)
+	}
+	return locations, nil
+}
+
+func (ms *MemoryStorage) AddressSummary(address string) (chain.AddressSummary, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	return ms.state.summaries[address], nil
+}
+
+// putBlock works like Storage.putBlock, the indexes are updated in the same
+// order, so balances are summed up the same way.
+func (state *memoryState) putBlock(b chain.Block) {
+	height := len(state.blocks)
+	state.blocks = append(state.blocks, b)
+	state.heights[b.Hash] = height
+	for i, t := range b.Transactions {
+		entry := txIndexEntry{Height: height, Hash: b.Hash, Index: i}
+		state.transactions[t.TransactionId] = entry
+		state.indexAddress(t.ToAddress, entry, t.Amount)
+		if t.FromAddress != t.ToAddress {
+			state.indexAddress(t.FromAddress, entry, -t.Amount)
+		}
+	}
+	for _, t := range b.Transactions {
+		delete(state.pool, t.TransactionId)
+	}
+}
+
+func (state *memoryState) indexAddress(address string, entry txIndexEntry, amount float64) {
+	if address == "" {
+		return
+	}
+	summary := state.summaries[address]
+	summary.Balance += amount
+	summary.TransactionCount++
+	state.summaries[address] = summary
+	state.addresses[address] = append(state.addresses[address], entry)
+}
+
+func (state *memoryState) unindexBlock(block chain.Block, height int) {
+	delete(state.heights, block.Hash)
+	for _, t := range block.Transactions {
+		delete(state.transactions, t.TransactionId)
+		state.unindexAddress(t.ToAddress, height, t.Amount)
+		if t.FromAddress != t.ToAddress {
+			state.unindexAddress(t.FromAddress, height, -t.Amount)
+		}
+	}
+}
+
+// unindexAddress removes the entries of address at height. Blocks are removed
+// from the tip down, so they are the last ones.
+func (state *memoryState) unindexAddress(address string, height int, amount float64) {
+	if address == "" {
+		return
+	}
+	summary := state.summaries[address]
+	summary.Balance -= amount
+	summary.TransactionCount--
+	if summary.TransactionCount > 0 {
+		state.summaries[address] = summary
+	} else {
+		delete(state.summaries, address)
+	}
+	entries := state.addresses[address]
+	for len(entries) > 0 && entries[len(entries)-1].Height >= height {
+		entries = entries[:len(entries)-1]
+	}
+	if len(entries) > 0 {
+		state.addresses[address] = entries
+	} else {
+		delete(state.addresses, address)
+	}
+}
+
+func (state *memoryState) addTransaction(t chain.Transaction) {
+	state.poolSeq++
+	state.pool[t.TransactionId] = poolEntry{Seq: state.poolSeq, Transaction: t}
+}
+
+func (state *memoryState) location(entry txIndexEntry) (chain.TransactionLocation, error) {
+	block := state.blocks[entry.Height]
+	if entry.Index >= len(block.Transactions) {
+		return chain.TransactionLocation{}, chain.ErrNotFound
+	}
+	return chain.TransactionLocation{
+		Transaction: block.Transactions[entry.Index],
+		BlockHash:   entry.Hash,
+		BlockHeight: entry.Height,
+		Index:       entry.Index,
+	}, nil
+}
+
+// CheckWritable always succeeds, memory accepts writes as long as the process
+// runs.
+func (ms *MemoryStorage) CheckWritable() error {
+	return nil
+}
+
+// Shutdown does nothing, the chain is lost with the process.
+func (ms *MemoryStorage) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// SaveMiningJob stores job, replacing the previous version with the same ID, and
+// keeps it for ttl from now.
+func (ms *MemoryStorage) SaveMiningJob(job chain.MiningJob, ttl time.Duration) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	now := time.Now()
+	for id, stored := range ms.jobs {
+		if !now.Before(stored.expires) {
+			delete(ms.jobs, id)
+		}
+	}
+	ms.jobs[job.ID] = memoryJob{job: job, expires: now.Add(ttl)}
+	return nil
+}
+
+func (ms *MemoryStorage) MiningJob(id string) (chain.MiningJob, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	stored, ok := ms.jobs[id]
+	if !ok || !time.Now().Before(stored.expires) {
+		return chain.MiningJob{}, chain.ErrNotFound
+	}
+	return stored.job, nil
+}
+
+// MiningJobs lists the stored jobs newest first, along with their total number.
+func (ms *MemoryStorage) MiningJobs(offset, limit int) ([]chain.MiningJob, int, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	now := time.Now()
+	var jobs []chain.MiningJob
+	for _, stored := range ms.jobs {
+		if now.Before(stored.expires) {
+			jobs = append(jobs, stored.job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartedAt.After(jobs[j].StartedAt) })
+	total := len(jobs)
+	if offset >= total {
+		return []chain.MiningJob{}, total, nil
+	}
+	return jobs[offset:min(offset+limit, total)], total, nil
+}
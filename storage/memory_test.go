@@ -0,0 +1,15 @@
+package storage_test
+
+import (
+	"testing"
+
+	"blockchain/chain"
+	"blockchain/storage"
+	"blockchain/storage/storagetest"
+)
+
+func TestMemoryConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) chain.Storage {
+		return storage.NewMemoryStorage()
+	})
+}
@@ -0,0 +1,13 @@
+package storage
+
+import "blockchain/metrics"
+
+var sizeGauge = metrics.NewGauge("badger_size_bytes", "Size of the Badger database on disk by part.", "part")
+
+// CollectMetrics updates the size of the database, it is meant to run before
+// every scrape.
+func (bs *Storage) CollectMetrics() {
+	lsm, vlog := bs.db.Size()
+	sizeGauge.Set(float64(lsm), "lsm")
+	sizeGauge.Set(float64(vlog), "vlog")
+}
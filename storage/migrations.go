@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"blockchain/chain"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// SchemaVersion is the version of the layout this storage writes. It is stored
+// under schemaVersionKey, databases with an older version are migrated when they
+// are opened and databases with a newer one are refused.
+const (
+	SchemaVersion    = 2
+	schemaVersionKey = "schema_version"
+)
+
+// Version 1 is the layout of the first releases. Its blocks were hashed without
+// their transactions, so they do not validate any more and cannot be migrated.
+const oldestSchemaVersion = 2
+
+var (
+	ErrNewerSchema       = errors.New("database was written by a newer version")
+	ErrUnsupportedSchema = errors.New("database was written by an unsupported older version")
+)
+
+// Migration upgrades the database to Version from the version before it.
+// Migrations must be safe to run again, a crash may happen after a migration
+// and before its version is stored. They write the upgraded chain with rewrite,
+// which keeps a dry run from changing the current chain.
+type Migration struct {
+	Version     int
+	Description string
+	apply       func(bs *Storage) error
+}
+
+// migrations upgrade the databases from oldestSchemaVersion to SchemaVersion.
+var migrations []Migration
+
+// The layout of version 1 keyed blocks and pool entries by a sequence number.
+// It is only recognized to refuse it.
+const (
+	legacyBlockPrefix       = "block_"
+	legacyTransactionPrefix = "tx_"
+)
+
+// Migrate opens the database at path, migrates it to SchemaVersion and closes
+// it, returning the migrations that ran. With dryRun the migrations write to a
+// scratch namespace that is removed afterwards, so the chain and the schema
+// version stay as they are, but data they cannot convert is reported all the
+// same.
+func Migrate(path string, dryRun bool) ([]Migration, error) {
+	return migrateDatabase(path, dryRun, migrations, SchemaVersion)
+}
+
+// migrateDatabase is Migrate with the migrations to version latest.
+func migrateDatabase(path string, dryRun bool, migrations []Migration, latest int) ([]Migration, error) {
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	bs := &Storage{db: db, dryRun: dryRun}
+	err = bs.openNamespace()
+	if err != nil {
+		return nil, err
+	}
+	current := bs.namespace()
+	applied, err := bs.migrate(migrations, latest)
+	if dryRun {
+		err = errors.Join(err, bs.removeNamespaces(current))
+	}
+	return applied, err
+}
+
+// migrate runs the migrations the database needs to reach version latest one at
+// a time, storing the version reached after each of them.
+func (bs *Storage) migrate(migrations []Migration, latest int) ([]Migration, error) {
+	version, stored, err := bs.schemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version > latest {
+		return nil, fmt.Errorf("%w: version %d, this node supports up to %d", ErrNewerSchema, version, latest)
+	}
+	if version > 0 && version < oldestSchemaVersion {
+		return nil, fmt.Errorf("%w: version %d, remove the database and synchronize again", ErrUnsupportedSchema, version)
+	}
+	if version == 0 {
+		if bs.dryRun {
+			return nil, nil
+		}
+		// A new database, the empty namespace only ever holds version 1
+		err := bs.rewrite(func(namespace) error { return nil })
+		if err != nil {
+			return nil, err
+		}
+		return nil, bs.setSchemaVersion(latest)
+	}
+
+	if !stored && version == latest && !bs.dryRun {
+		return nil, bs.setSchemaVersion(version)
+	}
+
+	var applied []Migration
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+		logger.Info("Migrating storage", "version", migration.Version, "migration", migration.Description, "dryRun", bs.dryRun)
+		err := migration.apply(bs)
+		if err != nil {
+			return applied, fmt.Errorf("migrate storage to version %d: %w", migration.Version, err)
+		}
+		applied = append(applied, migration)
+		if !bs.dryRun {
+			err = bs.setSchemaVersion(migration.Version)
+			if err != nil {
+				return applied, err
+			}
+		}
+	}
+	return applied, nil
+}
+
+// schemaVersion returns the stored version, or the version recognized from the
+// layout for databases written before it was stored. 0 is an empty database.
+func (bs *Storage) schemaVersion() (version int, stored bool, err error) {
+	ns := bs.namespace()
+	err = bs.db.View(func(txn *badger.Txn) error {
+		err := getJSON(txn, schemaVersionKey, &version)
+		if !errors.Is(err, chain.ErrNotFound) {
+			stored = err == nil
+			return err
+		}
+		switch {
+		case hasKeys(txn, ns.key(tipKey)):
+			version = 2
+		case hasKeys(txn, ns.key(legacyBlockPrefix)) || hasKeys(txn, ns.key(legacyTransactionPrefix)):
+			version = 1
+		}
+		return nil
+	})
+	return version, stored, err
+}
+
+func (bs *Storage) setSchemaVersion(version int) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		return setJSON(txn, schemaVersionKey, version)
+	})
+}
+
+// hasKeys reports whether there is a key starting with prefix.
+func hasKeys(txn *badger.Txn, prefix string) bool {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = []byte(prefix)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	it.Rewind()
+	return it.Valid()
+}
@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"blockchain/chain"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// openUnmigrated opens the database at dir without migrating it.
+func openUnmigrated(t *testing.T, dir string) *Storage {
+	t.Helper()
+	db, err := openDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Storage{db: db}
+	err = s.openNamespace()
+	if err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+	return s
+}
+
+func storedVersion(t *testing.T, s *Storage) int {
+	t.Helper()
+	version, _, err := s.schemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func versions(applied []Migration) []int {
+	versions := []int{}
+	for _, migration := range applied {
+		versions = append(versions, migration.Version)
+	}
+	return versions
+}
+
+// dropPool is a migration that copies the blocks, but not the pool, to a fresh
+// namespace.
+func dropPool(bs *Storage) error {
+	_, tip, err := bs.Tip()
+	if err != nil {
+		return err
+	}
+	return bs.rewrite(func(next namespace) error {
+		for height := 0; height <= tip; height++ {
+			block, err := bs.BlockByHeight(height)
+			if err != nil {
+				return err
+			}
+			err = bs.writeBlock(next, block)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func TestMigrateStepwise(t *testing.T) {
+	blocks := []chain.Block{
+		{Hash: "genesis", Transactions: []chain.Transaction{transfer("genesis-reward", "", "alice", 5)}},
+		{Hash: "block-1", PreviousHash: "genesis", Transactions: []chain.Transaction{transfer("block-1-t", "alice", "bob", 2)}},
+	}
+	pool := []chain.Transaction{transfer("pending", "bob", "carol", 1)}
+	dir := t.TempDir()
+	s, err := NewBadgerStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Reset(blocks, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := readChain(t, s)
+	s.Close()
+
+	failing := false
+	testMigrations := []Migration{
+		{Version: SchemaVersion + 1, Description: "drop the pool", apply: dropPool},
+		{Version: SchemaVersion + 2, Description: "fail on request", apply: func(*Storage) error {
+			if failing {
+				return errCrash
+			}
+			return nil
+		}},
+	}
+	latest := SchemaVersion + 2
+
+	applied, err := migrateDatabase(dir, true, testMigrations, latest)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if got := versions(applied); !reflect.DeepEqual(got, []int{SchemaVersion + 1, SchemaVersion + 2}) {
+		t.Fatalf("dry run applied versions %v", got)
+	}
+	s = openUnmigrated(t, dir)
+	if got := readChain(t, s); !reflect.DeepEqual(got, before) {
+		t.Fatalf("after the dry run the storage holds\n%+v\nwant\n%+v", got, before)
+	}
+	if version := storedVersion(t, s); version != SchemaVersion {
+		t.Fatalf("dry run stored version %d, want %d", version, SchemaVersion)
+	}
+	if found := namespaces(t, s); len(found) != 1 {
+		t.Fatalf("dry run left namespaces %v", found)
+	}
+	s.Close()
+
+	// The version reached before a failure is kept, so the next attempt goes on
+	// from there
+	failing = true
+	applied, err = migrateDatabase(dir, false, testMigrations, latest)
+	if !errors.Is(err, errCrash) || !reflect.DeepEqual(versions(applied), []int{SchemaVersion + 1}) {
+		t.Fatalf("failing migration applied %v and returned %v", versions(applied), err)
+	}
+	s = openUnmigrated(t, dir)
+	if version := storedVersion(t, s); version != SchemaVersion+1 {
+		t.Fatalf("stored version is %d, want %d", version, SchemaVersion+1)
+	}
+	got := readChain(t, s)
+	if !reflect.DeepEqual(got.Blocks, before.Blocks) || len(got.Pool) != 0 {
+		t.Fatalf("after the first migration the storage holds %+v", got)
+	}
+	s.Close()
+
+	failing = false
+	applied, err = migrateDatabase(dir, false, testMigrations, latest)
+	if err != nil || !reflect.DeepEqual(versions(applied), []int{SchemaVersion + 2}) {
+		t.Fatalf("second attempt applied %v and returned %v", versions(applied), err)
+	}
+
+	// This node only knows SchemaVersion
+	_, err = NewBadgerStorage(dir)
+	if !errors.Is(err, ErrNewerSchema) {
+		t.Fatalf("opening a newer database: got error %v, want %v", err, ErrNewerSchema)
+	}
+	_, err = Migrate(dir, true)
+	if !errors.Is(err, ErrNewerSchema) {
+		t.Fatalf("dry run on a newer database: got error %v, want %v", err, ErrNewerSchema)
+	}
+	s = openUnmigrated(t, dir)
+	defer s.Close()
+	if version := storedVersion(t, s); version != latest {
+		t.Fatalf("refused database has version %d, want %d", version, latest)
+	}
+}
+
+// TestMigrateLegacyLayout builds a database in the layout of version 1, which
+// is refused without being changed.
+func TestMigrateLegacyLayout(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := map[string]any{
+		legacyBlockPrefix + "000001_genesis":       chain.Block{Hash: "genesis"},
+		legacyTransactionPrefix + "000001_pending": transfer("pending", "alice", "bob", 1),
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		for key, value := range legacy {
+			err := setJSON(txn, key, value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Migrate(dir, true)
+	if !errors.Is(err, ErrUnsupportedSchema) {
+		t.Fatalf("dry run: got error %v, want %v", err, ErrUnsupportedSchema)
+	}
+	_, err = NewBadgerStorage(dir)
+	if !errors.Is(err, ErrUnsupportedSchema) {
+		t.Fatalf("open: got error %v, want %v", err, ErrUnsupportedSchema)
+	}
+
+	s := openUnmigrated(t, dir)
+	defer s.Close()
+	err = s.db.View(func(txn *badger.Txn) error {
+		for key := range legacy {
+			_, err := txn.Get([]byte(key))
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("legacy keys were changed: %v", err)
+	}
+	if version := storedVersion(t, s); version != 1 {
+		t.Fatalf("legacy database has version %d, want 1", version)
+	}
+}
@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"blockchain/chain"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// The chain, its pool and its indexes are kept under a namespace, a key prefix.
+// Reset writes the new chain under a fresh namespace and then switches to it by
+// updating namespaceKey in a single transaction, so a crash at any point leaves
+// either the old or the new chain. Databases written before namespaces existed
+// keep their keys without a prefix, in the empty namespace, in the layout of
+// schema version 1, which is refused.
+const (
+	namespaceKey    = "namespace"
+	namespacePrefix = "ns_"
+)
+
+// Steps of Reset, passed to the fail point of tests
+const (
+	resetStepPrepare = "prepare"
+	resetStepWrite   = "write"
+	resetStepSwitch  = "switch"
+	resetStepCleanup = "cleanup"
+)
+
+// legacyPrefixes are the chain keys of the empty namespace.
+var legacyPrefixes = []string{legacyBlockPrefix, legacyTransactionPrefix, seqPrefix, indexPrefix}
+
+type namespace string
+
+func namespaceOf(id int) namespace {
+	if id == 0 {
+		return ""
+	}
+	return namespace(fmt.Sprintf("%s%06d/", namespacePrefix, id))
+}
+
+func (ns namespace) key(key string) string {
+	return string(ns) + key
+}
+
+func (ns namespace) id() int {
+	id, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(string(ns), namespacePrefix), "/"))
+	return id
+}
+
+func (bs *Storage) namespace() namespace {
+	return *bs.ns.Load()
+}
+
+// openNamespace reads the current namespace and removes the other ones, which
+// are left over by a Reset that was interrupted.
+func (bs *Storage) openNamespace() error {
+	var current namespace
+	err := bs.db.View(func(txn *badger.Txn) error {
+		var name string
+		err := getJSON(txn, namespaceKey, &name)
+		if errors.Is(err, chain.ErrNotFound) {
+			return nil
+		}
+		current = namespace(name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	bs.ns.Store(&current)
+	return bs.removeNamespaces(current)
+}
+
+// removeNamespaces deletes the chain data of all namespaces but keep.
+func (bs *Storage) removeNamespaces(keep namespace) error {
+	var stale []namespace
+	err := bs.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = []byte(namespacePrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			name, _, _ := strings.Cut(string(it.Item().Key()), "/")
+			ns := namespace(name + "/")
+			if ns != keep && (len(stale) == 0 || stale[len(stale)-1] != ns) {
+				stale = append(stale, ns)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if keep != "" {
+		stale = append(stale, "")
+	}
+	for _, ns := range stale {
+		err := bs.deleteNamespace(ns)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (bs *Storage) deleteNamespace(ns namespace) error {
+	if ns != "" {
+		return bs.deleteByPrefix([]byte(ns))
+	}
+	for _, prefix := range legacyPrefixes {
+		err := bs.deleteByPrefix([]byte(prefix))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (bs *Storage) reachFailPoint(step string) error {
+	if bs.failPoint == nil {
+		return nil
+	}
+	return bs.failPoint(step)
+}
+
+// Reset replaces the stored chain and pool with blocks and pool. It is crash
+// safe: until the new chain is completely written the old one stays current.
+func (bs *Storage) Reset(blocks []chain.Block, pool []chain.Transaction) error {
+	return bs.rewrite(func(next namespace) error {
+		for _, block := range blocks {
+			err := bs.writeBlock(next, block)
+			if err != nil {
+				return err
+			}
+		}
+		for _, transaction := range pool {
+			err := bs.writeTransaction(next, transaction)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// rewriteBranch replaces the blocks of old above forkHeight like ReplaceBlocks,
+// but by copying the chain to a fresh namespace.
+func (bs *Storage) rewriteBranch(old namespace, forkHeight int, blocks []chain.Block, restored []chain.Transaction) error {
+	return bs.rewrite(func(next namespace) error {
+		for height := 0; height <= forkHeight; height++ {
+			var block chain.Block
+			err := bs.db.View(func(txn *badger.Txn) error {
+				var err error
+				block, err = bs.blockByHeight(txn, old, height)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			err = bs.writeBlock(next, block)
+			if err != nil {
+				return err
+			}
+		}
+		for _, block := range blocks {
+			err := bs.writeBlock(next, block)
+			if err != nil {
+				return err
+			}
+		}
+		pool, err := bs.pool(old)
+		if err != nil {
+			return err
+		}
+		for _, transaction := range append(pool, restored...) {
+			if bs.isIndexed(next, transaction.TransactionId) {
+				continue
+			}
+			err := bs.writeTransaction(next, transaction)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// pool reads the pool of ns in the order the transactions arrived in.
+func (bs *Storage) pool(ns namespace) ([]chain.Transaction, error) {
+	var entries []poolEntry
+	err := bs.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(ns.key(poolPrefix))
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			var entry poolEntry
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &entry)
+			})
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+	pool := make([]chain.Transaction, 0, len(entries))
+	for _, entry := range entries {
+		pool = append(pool, entry.Transaction)
+	}
+	return pool, nil
+}
+
+// isIndexed reports whether the transaction with id is in a block of ns.
+func (bs *Storage) isIndexed(ns namespace, id string) bool {
+	err := bs.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(ns.key(txIndexPrefix + id)))
+		return err
+	})
+	return err == nil
+}
+
+// writeBlock and writeTransaction write to a namespace that is not current yet,
+// one transaction per item.
+func (bs *Storage) writeBlock(ns namespace, block chain.Block) error {
+	err := bs.reachFailPoint(resetStepWrite)
+	if err != nil {
+		return err
+	}
+	return bs.db.Update(func(txn *badger.Txn) error {
+		return bs.addBlock(txn, ns, block)
+	})
+}
+
+func (bs *Storage) writeTransaction(ns namespace, transaction chain.Transaction) error {
+	err := bs.reachFailPoint(resetStepWrite)
+	if err != nil {
+		return err
+	}
+	return bs.db.Update(func(txn *badger.Txn) error {
+		return bs.addTransaction(txn, ns, transaction)
+	})
+}
+
+// rewrite writes a chain to the namespace following the current one with write
+// and switches to it once write is done.
+func (bs *Storage) rewrite(write func(next namespace) error) error {
+	old := bs.namespace()
+	next := namespaceOf(old.id() + 1)
+
+	// A Reset interrupted before may have left a part of next behind
+	err := bs.reachFailPoint(resetStepPrepare)
+	if err != nil {
+		return err
+	}
+	err = bs.deleteNamespace(next)
+	if err != nil {
+		return err
+	}
+
+	err = write(next)
+	if err != nil {
+		return err
+	}
+	if bs.dryRun {
+		// Following migrations read next, Migrate removes it in the end
+		bs.ns.Store(&next)
+		return nil
+	}
+
+	err = bs.reachFailPoint(resetStepSwitch)
+	if err != nil {
+		return err
+	}
+	err = bs.db.Update(func(txn *badger.Txn) error {
+		return setJSON(txn, namespaceKey, string(next))
+	})
+	if err != nil {
+		return err
+	}
+	bs.ns.Store(&next)
+
+	// The new chain is in place, leftovers of the old one are removed on the next
+	// start if this fails
+	err = bs.reachFailPoint(resetStepCleanup)
+	if err == nil {
+		err = bs.deleteNamespace(old)
+	}
+	if err != nil {
+		logger.Warn("Could not delete the replaced chain", "err", err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"blockchain/chain"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var errCrash = errors.New("crash")
+
+// storedChain is what a node reads back from the storage after a restart.
+type storedChain struct {
+	Blocks    []string
+	Pool      []string
+	Summaries map[string]chain.AddressSummary
+}
+
+func readChain(t *testing.T, s *Storage) storedChain {
+	t.Helper()
+	stored := storedChain{Summaries: make(map[string]chain.AddressSummary)}
+	_, tip, err := s.Tip()
+	if err != nil {
+		t.Fatalf("tip: %v", err)
+	}
+	for height := 0; height <= tip; height++ {
+		block, err := s.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("block at height %d: %v", height, err)
+		}
+		indexed, err := s.HeightByHash(block.Hash)
+		if err != nil || indexed != height {
+			t.Fatalf("block %s is indexed at %d (%v), want %d", block.Hash, indexed, err, height)
+		}
+		stored.Blocks = append(stored.Blocks, block.Hash)
+	}
+	blockchain, err := s.Load(chain.RegtestParams)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	for _, transaction := range blockchain.PendingTransactions {
+		stored.Pool = append(stored.Pool, transaction.TransactionId)
+	}
+	for _, address := range []string{"alice", "bob", "carol"} {
+		stored.Summaries[address], err = s.AddressSummary(address)
+		if err != nil {
+			t.Fatalf("summary of %s: %v", address, err)
+		}
+	}
+	return stored
+}
+
+// namespaces lists the namespaces that hold keys.
+func namespaces(t *testing.T, s *Storage) []string {
+	t.Helper()
+	var found []string
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = []byte(namespacePrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			name, _, _ := strings.Cut(string(it.Item().Key()), "/")
+			if len(found) == 0 || found[len(found)-1] != name {
+				found = append(found, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func transfer(id, from, to string, amount float64) chain.Transaction {
+	return chain.Transaction{FromAddress: from, ToAddress: to, Amount: amount, TransactionId: id}
+}
+
+func TestResetFailure(t *testing.T) {
+	oldBlocks := []chain.Block{
+		{Hash: "genesis", Transactions: []chain.Transaction{transfer("genesis-reward", "", "alice", 5)}},
+		{Hash: "old-1", PreviousHash: "genesis", Transactions: []chain.Transaction{transfer("old-1-t", "alice", "bob", 2)}},
+		{Hash: "old-2", PreviousHash: "old-1", Transactions: []chain.Transaction{transfer("old-2-t", "bob", "carol", 1)}},
+	}
+	oldPool := []chain.Transaction{transfer("old-pending", "carol", "alice", 1)}
+	newBlocks := []chain.Block{
+		oldBlocks[0],
+		{Hash: "new-1", PreviousHash: "genesis", Transactions: []chain.Transaction{transfer("new-1-t", "alice", "carol", 3)}},
+	}
+	newPool := []chain.Transaction{transfer("new-pending-2", "carol", "bob", 1), transfer("new-pending-1", "bob", "alice", 1)}
+
+	tests := []struct {
+		step string
+		// call is the call of the fail point with step that fails
+		call int
+		// keepsOld tells whether the old chain is expected after the restart
+		keepsOld bool
+	}{
+		{resetStepPrepare, 1, true},
+		{resetStepWrite, 1, true},
+		{resetStepWrite, len(newBlocks) + 1, true},
+		{resetStepSwitch, 1, true},
+		{resetStepCleanup, 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.step, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := NewBadgerStorage(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.Reset(oldBlocks, oldPool)
+			if err != nil {
+				t.Fatal(err)
+			}
+			old := readChain(t, s)
+
+			calls := 0
+			s.failPoint = func(step string) error {
+				if step != test.step {
+					return nil
+				}
+				calls++
+				if calls == test.call {
+					return errCrash
+				}
+				return nil
+			}
+			err = s.Reset(newBlocks, newPool)
+			// A failed cleanup is left to the next start, the reset itself succeeded
+			if test.keepsOld != errors.Is(err, errCrash) {
+				t.Fatalf("reset returned %v", err)
+			}
+			s.Close()
+
+			s, err = NewBadgerStorage(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			want := old
+			if !test.keepsOld {
+				fresh, err := NewBadgerStorage(t.TempDir())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer fresh.Close()
+				err = fresh.Reset(newBlocks, newPool)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want = readChain(t, fresh)
+			}
+			got := readChain(t, s)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("after the restart the storage holds\n%+v\nwant\n%+v", got, want)
+			}
+			if found := namespaces(t, s); len(found) != 1 {
+				t.Fatalf("namespaces %v are left, want only the current one", found)
+			}
+
+			// The storage recovered, so the same reset now goes through
+			err = s.Reset(newBlocks, newPool)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readChain(t, s); !reflect.DeepEqual(got.Blocks, []string{"genesis", "new-1"}) {
+				t.Fatalf("blocks after a second reset are %v", got.Blocks)
+			}
+		})
+	}
+}
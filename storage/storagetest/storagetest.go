@@ -0,0 +1,396 @@
+// Package storagetest checks that an implementation of chain.Storage behaves like
+// the storage the chain was written against: blocks by height below a tip, the
+// pool in arrival order, indexes that follow the blocks and reorganizations that
+// leave the same state as building the new branch directly.
+package storagetest
+
+import (
+	"blockchain/chain"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Opener returns a new, empty storage and fails t if it cannot be opened. Each
+// case of Run gets its own, and resources of the storage are released by a
+// cleanup of t.
+type Opener func(t *testing.T) chain.Storage
+
+var cases = []struct {
+	name string
+	run  func(t *testing.T, s chain.Storage, open Opener)
+}{
+	{"empty", testEmpty},
+	{"blocks", testBlocks},
+	{"pool", testPool},
+	{"indexes", testIndexes},
+	{"replace blocks", testReplaceBlocks},
+	{"invalid fork", testInvalidFork},
+	{"reset", testReset},
+}
+
+// Run runs all cases as subtests of t against storages returned by open.
+func Run(t *testing.T, open Opener) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.run(t, open(t), open)
+		})
+	}
+}
+
+var params = chain.ChainParams{Name: "storagetest", Difficulty: 1, MaxBlockSize: 5, MiningReward: 5}
+
+// Addresses used by the cases, all amounts are exact in binary so balances do
+// not depend on the order they are summed up in.
+const (
+	alice = "alice"
+	bob   = "bob"
+	carol = "carol"
+)
+
+func transfer(id, from, to string, amount float64) chain.Transaction {
+	return chain.Transaction{FromAddress: from, ToAddress: to, Amount: amount, TransactionId: id}
+}
+
+func reward(id, to string) chain.Transaction {
+	return chain.Transaction{ToAddress: to, Amount: params.MiningReward, TransactionId: id}
+}
+
+// block returns a block on top of previous. The storage does not check proof of
+// work, so the hash is only made unique.
+func block(hash, previous string, transactions ...chain.Transaction) chain.Block {
+	return chain.Block{Hash: hash, PreviousHash: previous, Transactions: transactions, Capacity: params.MaxBlockSize}
+}
+
+var (
+	genesis = block("genesis", "", reward("genesis-reward", alice))
+	a1      = block("a1", "genesis", reward("a1-reward", bob), transfer("a1-t1", alice, bob, 1.5))
+	a2      = block("a2", "a1", reward("a2-reward", bob), transfer("a2-t1", bob, carol, 2), transfer("a2-t2", carol, carol, 0.5))
+	b1      = block("b1", "genesis", reward("b1-reward", carol), transfer("b1-t1", alice, carol, 0.25))
+	b2      = block("b2", "b1", reward("b2-reward", carol))
+	b3      = block("b3", "b2", reward("b3-reward", alice), transfer("a2-t1", bob, carol, 2))
+)
+
+func addBlocks(t *testing.T, s chain.Storage, blocks ...chain.Block) {
+	t.Helper()
+	for _, b := range blocks {
+		err := s.AddBlock(b)
+		if err != nil {
+			t.Fatalf("add block %s: %v", b.Hash, err)
+		}
+	}
+}
+
+func addTransactions(t *testing.T, s chain.Storage, transactions ...chain.Transaction) {
+	t.Helper()
+	for _, tx := range transactions {
+		err := s.AddTransaction(tx)
+		if err != nil {
+			t.Fatalf("add transaction %s: %v", tx.TransactionId, err)
+		}
+	}
+}
+
+func pool(t *testing.T, s chain.Storage) []string {
+	t.Helper()
+	blockchain, err := s.Load(params)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	ids := []string{}
+	for _, tx := range blockchain.PendingTransactions {
+		ids = append(ids, tx.TransactionId)
+	}
+	return ids
+}
+
+func expectPool(t *testing.T, s chain.Storage, want ...string) {
+	t.Helper()
+	got := pool(t, s)
+	if want == nil {
+		want = []string{}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("pool is %v, want %v", got, want)
+	}
+}
+
+func expectNotFound(t *testing.T, what string, err error) {
+	t.Helper()
+	if !errors.Is(err, chain.ErrNotFound) {
+		t.Errorf("%s: got error %v, want %v", what, err, chain.ErrNotFound)
+	}
+}
+
+func testEmpty(t *testing.T, s chain.Storage, open Opener) {
+	_, _, err := s.Tip()
+	expectNotFound(t, "tip", err)
+	_, err = s.BlockByHeight(0)
+	expectNotFound(t, "block at height 0", err)
+	_, _, err = s.BlockByHash("genesis")
+	expectNotFound(t, "block by hash", err)
+	_, err = s.HeightByHash("genesis")
+	expectNotFound(t, "height by hash", err)
+	_, err = s.TransactionByID("genesis-reward")
+	expectNotFound(t, "transaction", err)
+	err = s.ReplaceBlocks(0, []chain.Block{b1}, nil)
+	expectNotFound(t, "replace blocks", err)
+	locations, err := s.AddressTransactions(alice, 0, 10)
+	if err != nil {
+		t.Fatalf("address transactions: %v", err)
+	}
+	if locations == nil || len(locations) != 0 {
+		t.Errorf("address transactions are %v, want an empty list", locations)
+	}
+	summary, err := s.AddressSummary(alice)
+	if err != nil {
+		t.Fatalf("address summary: %v", err)
+	}
+	if summary != (chain.AddressSummary{}) {
+		t.Errorf("summary is %+v, want zero", summary)
+	}
+
+	blockchain, err := s.Load(params)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if blockchain.Storage != s || blockchain.Params.Name != params.Name || len(blockchain.PendingTransactions) != 0 {
+		t.Errorf("load returned storage %v, params %q and %d pending transactions",
+			blockchain.Storage, blockchain.Params.Name, len(blockchain.PendingTransactions))
+	}
+}
+
+func testBlocks(t *testing.T, s chain.Storage, open Opener) {
+	blocks := []chain.Block{genesis, a1, a2}
+	addBlocks(t, s, blocks...)
+	tip, height, err := s.Tip()
+	if err != nil {
+		t.Fatalf("tip: %v", err)
+	}
+	if height != 2 || !reflect.DeepEqual(tip, a2) {
+		t.Errorf("tip is %s at %d, want a2 at 2", tip.Hash, height)
+	}
+	for h, want := range blocks {
+		got, err := s.BlockByHeight(h)
+		if err != nil {
+			t.Fatalf("block at height %d: %v", h, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("block at height %d is %+v, want %+v", h, got, want)
+		}
+		got, gotHeight, err := s.BlockByHash(want.Hash)
+		if err != nil {
+			t.Fatalf("block %s: %v", want.Hash, err)
+		}
+		if gotHeight != h || !reflect.DeepEqual(got, want) {
+			t.Errorf("block %s is %s at %d, want height %d", want.Hash, got.Hash, gotHeight, h)
+		}
+		gotHeight, err = s.HeightByHash(want.Hash)
+		if err != nil || gotHeight != h {
+			t.Errorf("height of %s is %d (%v), want %d", want.Hash, gotHeight, err, h)
+		}
+	}
+	_, err = s.BlockByHeight(3)
+	expectNotFound(t, "block above the tip", err)
+	_, err = s.BlockByHeight(-1)
+	expectNotFound(t, "block at a negative height", err)
+}
+
+func testPool(t *testing.T, s chain.Storage, open Opener) {
+	t1 := transfer("t1", alice, bob, 1)
+	t2 := transfer("t2", alice, carol, 1)
+	t3 := transfer("t3", bob, carol, 1)
+	addBlocks(t, s, genesis)
+	addTransactions(t, s, t3, t1, t2)
+	expectPool(t, s, "t3", "t1", "t2")
+	addBlocks(t, s, block("mined", "genesis", reward("mined-reward", alice), t1))
+	expectPool(t, s, "t3", "t2")
+	// A transaction added again arrives after the others
+	addTransactions(t, s, t3)
+	expectPool(t, s, "t2", "t3")
+}
+
+func testIndexes(t *testing.T, s chain.Storage, open Opener) {
+	addBlocks(t, s, genesis, a1, a2)
+	location, err := s.TransactionByID("a2-t1")
+	if err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+	want := chain.TransactionLocation{Transaction: a2.Transactions[1], BlockHash: "a2", BlockHeight: 2, Index: 1}
+	if !reflect.DeepEqual(location, want) {
+		t.Errorf("transaction location is %+v, want %+v", location, want)
+	}
+
+	summaries := map[string]chain.AddressSummary{
+		alice: {Balance: 5 - 1.5, TransactionCount: 2},
+		bob:   {Balance: 1.5 + 5 + 5 - 2, TransactionCount: 4},
+		// The transfer of carol to carol counts once
+		carol: {Balance: 2 + 0.5, TransactionCount: 2},
+	}
+	for address, want := range summaries {
+		got, err := s.AddressSummary(address)
+		if err != nil {
+			t.Fatalf("summary of %s: %v", address, err)
+		}
+		if got != want {
+			t.Errorf("summary of %s is %+v, want %+v", address, got, want)
+		}
+	}
+
+	// Newest first, by height and then by index in the block
+	pages := []struct {
+		offset, limit int
+		want          []string
+	}{
+		{0, 10, []string{"a2-t1", "a2-reward", "a1-t1", "a1-reward"}},
+		{1, 2, []string{"a2-reward", "a1-t1"}},
+		{3, 10, []string{"a1-reward"}},
+		{4, 10, []string{}},
+		{0, 0, []string{}},
+	}
+	for _, page := range pages {
+		locations, err := s.AddressTransactions(bob, page.offset, page.limit)
+		if err != nil {
+			t.Fatalf("transactions of bob: %v", err)
+		}
+		got := []string{}
+		for _, location := range locations {
+			got = append(got, location.Transaction.TransactionId)
+		}
+		if locations == nil || !reflect.DeepEqual(got, page.want) {
+			t.Errorf("transactions of bob at offset %d, limit %d are %v, want %v", page.offset, page.limit, got, page.want)
+		}
+	}
+}
+
+// testReplaceBlocks checks that a reorganization leaves the state of a storage
+// that got the new branch directly.
+func testReplaceBlocks(t *testing.T, s chain.Storage, open Opener) {
+	addBlocks(t, s, genesis, a1, a2)
+	pending := transfer("pending", bob, alice, 1)
+	mined := transfer("b1-t1", alice, carol, 0.25)
+	addTransactions(t, s, pending, mined)
+	// a1-t1 and a2-t2 are not in the new branch, a2-t1 is
+	restored := []chain.Transaction{a1.Transactions[1], a2.Transactions[2]}
+	err := s.ReplaceBlocks(0, []chain.Block{b1, b2, b3}, restored)
+	if err != nil {
+		t.Fatalf("replace blocks: %v", err)
+	}
+
+	direct := open(t)
+	addBlocks(t, direct, genesis, b1, b2, b3)
+	addTransactions(t, direct, append([]chain.Transaction{pending}, restored...)...)
+	compare(t, s, direct)
+}
+
+func testInvalidFork(t *testing.T, s chain.Storage, open Opener) {
+	addBlocks(t, s, genesis, a1)
+	addTransactions(t, s, transfer("pending", bob, alice, 1))
+	before := snapshot(t, s)
+	for _, forkHeight := range []int{-1, 2} {
+		err := s.ReplaceBlocks(forkHeight, []chain.Block{b2, b3}, []chain.Transaction{transfer("restored", alice, bob, 1)})
+		if err == nil {
+			t.Fatalf("replacing blocks above height %d succeeded", forkHeight)
+		}
+		after := snapshot(t, s)
+		if !reflect.DeepEqual(before, after) {
+			t.Errorf("replacing blocks above height %d failed but changed the storage:\n got %+v\nwant %+v", forkHeight, after, before)
+		}
+	}
+}
+
+func testReset(t *testing.T, s chain.Storage, open Opener) {
+	addBlocks(t, s, genesis, a1, a2)
+	addTransactions(t, s, transfer("old", alice, bob, 1))
+	p1 := transfer("p1", carol, alice, 1)
+	p2 := transfer("p2", carol, bob, 1)
+	err := s.Reset([]chain.Block{genesis, b1}, []chain.Transaction{p2, p1})
+	if err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+
+	direct := open(t)
+	addBlocks(t, direct, genesis, b1)
+	addTransactions(t, direct, p2, p1)
+	compare(t, s, direct)
+
+	err = s.Reset(nil, nil)
+	if err != nil {
+		t.Fatalf("reset to nothing: %v", err)
+	}
+	testEmpty(t, s, open)
+}
+
+// state is what can be read from a storage about the blocks, transactions and
+// addresses the cases use.
+type state struct {
+	Blocks       []chain.Block
+	Heights      map[string]int
+	Pool         []string
+	Transactions map[string]chain.TransactionLocation
+	Addresses    map[string][]chain.TransactionLocation
+	Summaries    map[string]chain.AddressSummary
+}
+
+func snapshot(t *testing.T, s chain.Storage) state {
+	t.Helper()
+	st := state{
+		Heights:      make(map[string]int),
+		Transactions: make(map[string]chain.TransactionLocation),
+		Addresses:    make(map[string][]chain.TransactionLocation),
+		Summaries:    make(map[string]chain.AddressSummary),
+	}
+	_, tip, err := s.Tip()
+	if errors.Is(err, chain.ErrNotFound) {
+		tip = -1
+	} else if err != nil {
+		t.Fatalf("tip: %v", err)
+	}
+	for height := 0; height <= tip; height++ {
+		b, err := s.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("block at height %d: %v", height, err)
+		}
+		st.Blocks = append(st.Blocks, b)
+	}
+
+	for _, b := range []chain.Block{genesis, a1, a2, b1, b2, b3} {
+		height, err := s.HeightByHash(b.Hash)
+		if err == nil {
+			st.Heights[b.Hash] = height
+		} else if !errors.Is(err, chain.ErrNotFound) {
+			t.Fatalf("height of %s: %v", b.Hash, err)
+		}
+		for _, tx := range b.Transactions {
+			location, err := s.TransactionByID(tx.TransactionId)
+			if err == nil {
+				st.Transactions[tx.TransactionId] = location
+			} else if !errors.Is(err, chain.ErrNotFound) {
+				t.Fatalf("transaction %s: %v", tx.TransactionId, err)
+			}
+		}
+	}
+	for _, address := range []string{alice, bob, carol} {
+		locations, err := s.AddressTransactions(address, 0, 100)
+		if err != nil {
+			t.Fatalf("transactions of %s: %v", address, err)
+		}
+		st.Addresses[address] = locations
+		st.Summaries[address], err = s.AddressSummary(address)
+		if err != nil {
+			t.Fatalf("summary of %s: %v", address, err)
+		}
+	}
+	st.Pool = pool(t, s)
+	return st
+}
+
+// compare fails t if got reads differently from want.
+func compare(t *testing.T, got, want chain.Storage) {
+	t.Helper()
+	gotState := snapshot(t, got)
+	wantState := snapshot(t, want)
+	if !reflect.DeepEqual(gotState, wantState) {
+		t.Errorf("state differs from a storage written directly:\n got %+v\nwant %+v", gotState, wantState)
+	}
+}